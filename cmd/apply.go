@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"github.com/adityasaky/gittuf/gittuf"
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <proposal>",
+	Short: "Apply a signed proposal to the gittuf namespace",
+	RunE:  runApply,
+	Args:  cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+
+	if err := fetchProposal(store, args[0]); err != nil {
+		return err
+	}
+
+	proposal, err := store.LoadProposal(args[0])
+	if err != nil {
+		return err
+	}
+
+	repoRoot, err := gittuf.GetRepoRootDir()
+	if err != nil {
+		return err
+	}
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	return gittuf.ApplyProposal(repoRoot, store, proposal, snapshotSigners)
+}
@@ -5,9 +5,7 @@ import (
 
 	"github.com/adityasaky/gittuf/gittuf"
 	"github.com/adityasaky/gittuf/internal/gitstore"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	tufdata "github.com/theupdateframework/go-tuf/data"
 )
 
 var commitCmd = &cobra.Command{
@@ -17,20 +15,12 @@ var commitCmd = &cobra.Command{
 	Args:  cobra.MinimumNArgs(1),
 }
 
-var (
-	roleExpires string
-)
+var roleExpires string
 
 func init() {
 	rootCmd.AddCommand(commitCmd)
 
-	commitCmd.Flags().StringArrayVarP(
-		&roleKeyPaths,
-		"role-key",
-		"",
-		[]string{},
-		"Path to signing key for role",
-	)
+	addRoleSignerFlags(commitCmd)
 
 	commitCmd.Flags().StringVarP(
 		&roleExpires,
@@ -60,27 +50,17 @@ func runCommit(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	var roleKeys []tufdata.PrivateKey
-	if len(roleKeyPaths) > 0 {
-		for _, k := range roleKeyPaths {
-			logrus.Debug("Loading key from", k)
-			privKey, err := gittuf.LoadEd25519PrivateKeyFromSslib(k)
-			if err != nil {
-				return err
-			}
-			roleKeys = append(roleKeys, privKey)
-		}
-	} else {
-		userConfigPath, err := gittuf.FindConfigPath()
-		if err != nil {
-			return err
-		}
-		userConfig, err := gittuf.ReadConfig(userConfigPath)
-		if err != nil {
-			return err
-		}
-		roleKeys = append(roleKeys, userConfig.PrivateKey)
+	roleSigners, err := loadRoleSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(roleSigners)
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
 	}
+	defer gittuf.CloseSigners(snapshotSigners)
 
 	branchName, err := gittuf.GetRefNameForHEAD()
 	if err != nil {
@@ -93,24 +73,29 @@ func runCommit(cmd *cobra.Command, args []string) error {
 	}
 
 	// TODO: should gittuf.Commit infer target name or should we do it here?
-	newRoleMb, target, err := gittuf.Commit(state, branchName, roleKeys, expires, args...)
+	newRoleMb, target, err := gittuf.Commit(state, branchName, roleSigners, expires, args...)
 	if err != nil {
 		return err
 	}
 
 	// All errors after this point should undo the commit
 
+	roleName, err := gittuf.GetRoleNameForTarget(target)
+	if err != nil {
+		return gittuf.UndoLastCommit(err)
+	}
+
 	newRoleBytes, err := json.Marshal(newRoleMb)
 	if err != nil {
 		return gittuf.UndoLastCommit(err)
 	}
 
-	err = state.StageMetadataAndCommit(branchName, newRoleBytes)
+	err = state.StageMetadataAndCommit(roleName, newRoleBytes, gittuf.NewSnapshotter(snapshotSigners))
 	if err != nil {
 		return gittuf.UndoLastCommit(err)
 	}
 
-	err = store.UpdateTrustedState(target, state.Tip())
+	err = gittuf.TrustState(store, target, state, allowExpired)
 	if err != nil {
 		return gittuf.UndoLastCommit(err)
 	}
@@ -1,17 +1,26 @@
 package cmd
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/adityasaky/gittuf/gittuf"
 	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
 	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
 )
 
 var (
 	roleKeyPaths []string
+	signingKeys  []string
+	proposalID   string
 	long         bool
+	snapshotKeys []string
+	allowExpired bool
 )
 
 // Borrowed from go-tuf
@@ -26,6 +35,106 @@ func parseExpires(e string, role string) (time.Time, error) {
 	return time.Now().AddDate(0, 0, days).UTC(), nil
 }
 
+/*
+parseDuration parses a duration such as 14d. Days are supported in addition
+to the units accepted by time.ParseDuration.
+*/
+func parseDuration(d string) (time.Duration, error) {
+	if len(d) == 0 {
+		return 0, nil
+	}
+	if strings.HasSuffix(d, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(d, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %s", d)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(d)
+}
+
+// loadSigners returns signers for the specified signing keys, see
+// gittuf.LoadSigner.
+func loadSigners(signingKeys []string) ([]tufkeys.Signer, error) {
+	signers := []tufkeys.Signer{}
+	for _, k := range signingKeys {
+		logrus.Debug("Loading signer for ", k)
+		signer, err := gittuf.LoadSigner(k)
+		if err != nil {
+			return []tufkeys.Signer{}, err
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+/*
+addRoleSignerFlags adds the flags for the keys that sign a branch or tag role
+and authorize the changes it records, see loadRoleSigners.
+*/
+func addRoleSignerFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(
+		&roleKeyPaths,
+		"role-key",
+		"",
+		[]string{},
+		"Signing key for role, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+	)
+
+	cmd.Flags().StringArrayVarP(
+		&signingKeys,
+		"signing-key",
+		"",
+		[]string{},
+		"Signing key for role, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+	)
+}
+
+/*
+loadRoleSigners returns signers for the keys specified with --role-key and
+--signing-key. If none are specified, the signer in the user's gittuf config
+is used. The caller must close them with gittuf.CloseSigners.
+*/
+func loadRoleSigners() ([]tufkeys.Signer, error) {
+	if len(roleKeyPaths) > 0 || len(signingKeys) > 0 {
+		return loadSigners(append(roleKeyPaths, signingKeys...))
+	}
+
+	userConfigPath, err := gittuf.FindConfigPath()
+	if err != nil {
+		return []tufkeys.Signer{}, err
+	}
+	userConfig, err := gittuf.ReadConfig(userConfigPath)
+	if err != nil {
+		return []tufkeys.Signer{}, err
+	}
+	return []tufkeys.Signer{userConfig.Signer}, nil
+}
+
+// loadSnapshotSigners returns signers for the keys specified with
+// --snapshot-key. The caller must close them with gittuf.CloseSigners.
+func loadSnapshotSigners() ([]tufkeys.Signer, error) {
+	return loadSigners(snapshotKeys)
+}
+
+// fetchProposal updates the state and the specified proposal from the default
+// remote, if one is configured.
+func fetchProposal(store *gitstore.GitStore, id string) error {
+	remotes, err := store.Repository().Remotes()
+	if err != nil {
+		return err
+	}
+	if len(remotes) == 0 {
+		return nil
+	}
+	if !store.State().TipHash().IsZero() {
+		if err := store.State().FetchFromRemote(gitstore.DefaultRemote); err != nil {
+			return err
+		}
+	}
+	return store.FetchProposal(gitstore.DefaultRemote, id)
+}
+
 func getGitStore() (*gitstore.GitStore, error) {
 	dir, err := gittuf.GetRepoRootDir()
 	if err != nil {
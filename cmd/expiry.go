@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adityasaky/gittuf/gittuf"
+	"github.com/spf13/cobra"
+)
+
+var expiryCmd = &cobra.Command{
+	Use:   "expiry",
+	Short: "Inspect expiry of gittuf metadata",
+}
+
+var expiryCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "List the expiry of every role and fail if any role is expiring",
+	Long: `List the version and expiry of every role in the current state. The command
+fails if any role has expired or will expire within the window set by --within.`,
+	RunE:         runExpiryCheck,
+	SilenceUsage: true,
+}
+
+var expiryWithin string
+
+func init() {
+	expiryCheckCmd.Flags().StringVarP(
+		&expiryWithin,
+		"within",
+		"",
+		"",
+		"Also fail for roles expiring within this window, such as 14d or 36h",
+	)
+
+	expiryCmd.AddCommand(expiryCheckCmd)
+	rootCmd.AddCommand(expiryCmd)
+}
+
+func runExpiryCheck(cmd *cobra.Command, args []string) error {
+	window, err := parseDuration(expiryWithin)
+	if err != nil {
+		return err
+	}
+
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+
+	expiries, err := gittuf.GetRoleExpiries(store.State())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deadline := now.Add(window)
+	expiring := 0
+	for _, e := range expiries {
+		status := "ok"
+		if !e.Expires.After(now) {
+			status = "expired"
+			expiring++
+		} else if !e.Expires.After(deadline) {
+			status = "expiring"
+			expiring++
+		}
+		fmt.Printf("%-24s %-8d %-26s %s\n", e.Role, e.Version, e.Expires.Format(time.RFC3339), status)
+	}
+
+	if expiring > 0 {
+		return fmt.Errorf("%d of %d roles have expired or expire within %s", expiring, len(expiries), window)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/adityasaky/gittuf/internal/gitstore"
 	"github.com/spf13/cobra"
 	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
 )
 
 var initCmd = &cobra.Command{
@@ -19,10 +20,16 @@ var initCmd = &cobra.Command{
 var (
 	rootPrivKeyPaths    []string
 	targetsPrivKeyPaths []string
+	rootPubKeyPaths     []string
+	targetsPubKeyPaths  []string
+	snapshotPubKeyPaths []string
+	timestampKeyPaths   []string
 	rootExpires         string
 	targetsExpires      string
 	rootThreshold       int
 	targetsThreshold    int
+	snapshotThreshold   int
+	timestampThreshold  int
 )
 
 func init() {
@@ -33,7 +40,7 @@ func init() {
 		"root-key",
 		"",
 		[]string{},
-		"Path to private key that must be loaded for signing root metadata",
+		"Signing key for root metadata, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
 	)
 
 	initCmd.Flags().StringArrayVarP(
@@ -41,7 +48,47 @@ func init() {
 		"targets-key",
 		"",
 		[]string{},
-		"Path to private key that must be loaded for signing targets metadata",
+		"Signing key for targets metadata, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+	)
+
+	initCmd.Flags().StringArrayVarP(
+		&rootPubKeyPaths,
+		"root-public-key",
+		"",
+		[]string{},
+		"Public key for root metadata whose holder signs separately using gittuf sign",
+	)
+
+	initCmd.Flags().StringArrayVarP(
+		&targetsPubKeyPaths,
+		"targets-public-key",
+		"",
+		[]string{},
+		"Public key for targets metadata whose holder signs separately using gittuf sign",
+	)
+
+	initCmd.Flags().StringArrayVarP(
+		&snapshotPubKeyPaths,
+		"snapshot-public-key",
+		"",
+		[]string{},
+		"Public key for snapshot metadata, in addition to those specified using --snapshot-key",
+	)
+
+	initCmd.Flags().StringArrayVarP(
+		&timestampKeyPaths,
+		"timestamp-public-key",
+		"",
+		[]string{},
+		"Public key for timestamp metadata, typically held online by the server",
+	)
+
+	initCmd.Flags().StringVarP(
+		&proposalID,
+		"propose",
+		"",
+		"",
+		"Record the metadata as a proposal with the specified ID instead of applying it",
 	)
 
 	initCmd.Flags().StringVarP(
@@ -75,26 +122,36 @@ func init() {
 		1,
 		"Threshold of signatures needed for targets role",
 	)
+
+	initCmd.Flags().IntVarP(
+		&snapshotThreshold,
+		"snapshot-threshold",
+		"",
+		1,
+		"Threshold of signatures needed for snapshot role",
+	)
+
+	initCmd.Flags().IntVarP(
+		&timestampThreshold,
+		"timestamp-threshold",
+		"",
+		1,
+		"Threshold of signatures needed for timestamp role",
+	)
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
-	var rootPrivKeys []tufdata.PrivateKey
-	for _, p := range rootPrivKeyPaths {
-		rootPrivKey, err := gittuf.LoadEd25519PrivateKeyFromSslib(p)
-		if err != nil {
-			return err
-		}
-		rootPrivKeys = append(rootPrivKeys, rootPrivKey)
+	rootSigners, err := loadSigners(rootPrivKeyPaths)
+	if err != nil {
+		return err
 	}
+	defer gittuf.CloseSigners(rootSigners)
 
-	var targetsPrivKeys []tufdata.PrivateKey
-	for _, p := range targetsPrivKeyPaths {
-		targetsPrivKey, err := gittuf.LoadEd25519PrivateKeyFromSslib(p)
-		if err != nil {
-			return err
-		}
-		targetsPrivKeys = append(targetsPrivKeys, targetsPrivKey)
+	targetsSigners, err := loadSigners(targetsPrivKeyPaths)
+	if err != nil {
+		return err
 	}
+	defer gittuf.CloseSigners(targetsSigners)
 
 	rootExpiresTime, err := parseExpires(rootExpires, "root")
 	if err != nil {
@@ -106,33 +163,45 @@ func runInit(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	var rootPublicKeys []tufdata.PublicKey
-	for _, privKey := range rootPrivKeys {
-		rootPubKey, err := gittuf.GetEd25519PublicKeyFromPrivateKey(&privKey)
-		if err != nil {
-			return err
-		}
-		rootPublicKeys = append(rootPublicKeys, rootPubKey)
+	rootPublicKeys, err := getPublicKeys(rootSigners, rootPubKeyPaths)
+	if err != nil {
+		return err
 	}
 
-	var targetsPublicKeys []tufdata.PublicKey
-	for _, privKey := range targetsPrivKeys {
-		targetsPubKey, err := gittuf.GetEd25519PublicKeyFromPrivateKey(&privKey)
-		if err != nil {
-			return err
-		}
-		targetsPublicKeys = append(targetsPublicKeys, targetsPubKey)
+	targetsPublicKeys, err := getPublicKeys(targetsSigners, targetsPubKeyPaths)
+	if err != nil {
+		return err
+	}
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	snapshotPublicKeys, err := getPublicKeys(snapshotSigners, snapshotPubKeyPaths)
+	if err != nil {
+		return err
+	}
+
+	timestampPublicKeys, err := getPublicKeys([]tufkeys.Signer{}, timestampKeyPaths)
+	if err != nil {
+		return err
 	}
 
 	roles, err := gittuf.Init(
-		rootPrivKeys,
+		rootSigners,
 		rootExpiresTime,
 		rootThreshold,
 		rootPublicKeys,
 		targetsPublicKeys,
-		targetsPrivKeys,
+		targetsSigners,
 		targetsExpiresTime,
 		targetsThreshold,
+		snapshotPublicKeys,
+		snapshotThreshold,
+		timestampPublicKeys,
+		timestampThreshold,
 		args...)
 	if err != nil {
 		return err
@@ -148,10 +217,50 @@ func runInit(cmd *cobra.Command, args []string) error {
 		metadata[k] = roleBytes
 	}
 
+	if len(proposalID) > 0 {
+		if err := gitstore.InitNamespace("."); err != nil {
+			return err
+		}
+		store, err := gitstore.LoadGitStore(".")
+		if err != nil {
+			return err
+		}
+		_, err = store.CreateProposal(proposalID, metadata, nil)
+		return err
+	}
+
 	// TODO: Should we undo git init if this call fails?
 	store, err := gitstore.InitGitStore(".", rootPublicKeys, metadata)
 	if err != nil {
 		return err
 	}
-	return store.State().Commit()
+	return store.State().Commit(gittuf.NewSnapshotter(snapshotSigners))
+}
+
+// getPublicKeys returns the public keys of the signers along with the public
+// keys at the specified paths, skipping duplicates.
+func getPublicKeys(signers []tufkeys.Signer, pubKeyPaths []string) ([]*tufdata.PublicKey, error) {
+	publicKeys := []*tufdata.PublicKey{}
+	for _, signer := range signers {
+		publicKeys = append(publicKeys, signer.PublicData())
+	}
+	for _, p := range pubKeyPaths {
+		pubKey, err := gittuf.LoadPublicKey(p)
+		if err != nil {
+			return []*tufdata.PublicKey{}, err
+		}
+		publicKeys = append(publicKeys, pubKey)
+	}
+
+	seen := map[string]bool{}
+	uniqueKeys := []*tufdata.PublicKey{}
+	for _, k := range publicKeys {
+		keyID := k.IDs()[0]
+		if seen[keyID] {
+			continue
+		}
+		seen[keyID] = true
+		uniqueKeys = append(uniqueKeys, k)
+	}
+	return uniqueKeys, nil
 }
@@ -6,9 +6,9 @@ import (
 	"os"
 	"strings"
 
+	"github.com/adityasaky/gittuf/gittuf"
 	"github.com/adityasaky/gittuf/internal/gitstore"
 	"github.com/spf13/cobra"
-	tufdata "github.com/theupdateframework/go-tuf/data"
 )
 
 var keysCmd = &cobra.Command{
@@ -24,7 +24,7 @@ var keysLsCmd = &cobra.Command{
 
 var keysAddCmd = &cobra.Command{
 	Use:   "add",
-	Short: "Add specified key to gittuf namespace",
+	Short: "Add specified keys to the root role, see gittuf root add-key",
 	Args:  cobra.MinimumNArgs(1),
 	RunE:  runKeysAdd,
 }
@@ -38,12 +38,30 @@ var keysCatCmd = &cobra.Command{
 
 var keysRmCmd = &cobra.Command{
 	Use:   "rm",
-	Short: "Remove specified keys",
+	Short: "Remove specified keys from the root role, see gittuf root remove-key",
 	Args:  cobra.MinimumNArgs(1),
 	RunE:  runKeysRm,
 }
 
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a passphrase protected signing key",
+	Long:  "Generate a signing key, writing the encrypted private key to the specified path and the public key to <path>.pub",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runKeysGenerate,
+}
+
+var keyType string
+
 func init() {
+	keysGenerateCmd.Flags().StringVarP(
+		&keyType,
+		"type",
+		"",
+		gittuf.KeyTypeNameEd25519,
+		"Type of key to generate, one of ed25519, ecdsa, or rsa",
+	)
+
 	keysLsCmd.Flags().BoolVarP(
 		&long,
 		"long",
@@ -56,6 +74,7 @@ func init() {
 	keysCmd.AddCommand(keysAddCmd)
 	keysCmd.AddCommand(keysCatCmd)
 	keysCmd.AddCommand(keysRmCmd)
+	keysCmd.AddCommand(keysGenerateCmd)
 
 	rootCmd.AddCommand(keysCmd)
 }
@@ -81,28 +100,10 @@ func runKeysLs(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// The keys tree mirrors the root role's keys, so keys can only be added or
+// removed with a root update.
 func runKeysAdd(cmd *cobra.Command, args []string) error {
-	store, err := getGitStore()
-	if err != nil {
-		return err
-	}
-
-	var keys []tufdata.PublicKey
-
-	for _, n := range args {
-		c, err := os.ReadFile(n)
-		if err != nil {
-			return err
-		}
-		var k tufdata.PublicKey
-		err = json.Unmarshal(c, &k)
-		if err != nil {
-			return err
-		}
-		keys = append(keys, k)
-	}
-
-	return store.State().StageKeysAndCommit(keys)
+	return runRootAddKey(cmd, args)
 }
 
 func runKeysCat(cmd *cobra.Command, args []string) error {
@@ -124,16 +125,54 @@ func runKeysCat(cmd *cobra.Command, args []string) error {
 }
 
 func runKeysRm(cmd *cobra.Command, args []string) error {
-	store, err := getGitStore()
+	keyIDs := []string{}
+
+	for _, n := range args {
+		keyIDs = append(keyIDs, strings.TrimSuffix(n, ".pub"))
+	}
+
+	return runRootRemoveKey(cmd, keyIDs)
+}
+
+func runKeysGenerate(cmd *cobra.Command, args []string) error {
+	privKeyPath := args[0]
+	pubKeyPath := privKeyPath + ".pub"
+	for _, p := range []string{privKeyPath, pubKeyPath} {
+		if _, err := os.Stat(p); err == nil {
+			return fmt.Errorf("%s already exists", p)
+		}
+	}
+
+	privKey, err := gittuf.GenerateKey(keyType)
 	if err != nil {
 		return err
 	}
 
-	keyIDs := []string{}
+	pubKey, err := gittuf.GetPublicKeyFromPrivateKey(privKey)
+	if err != nil {
+		return err
+	}
+	pubKeyContents, err := json.Marshal(pubKey)
+	if err != nil {
+		return err
+	}
 
-	for _, n := range args {
-		keyIDs = append(keyIDs, strings.TrimSuffix(n, ".pub"))
+	passphrase, err := gittuf.GetNewPassphrase()
+	if err != nil {
+		return err
+	}
+	privKeyContents, err := gittuf.EncryptPrivateKey(privKey, passphrase)
+	if err != nil {
+		return err
 	}
 
-	return store.State().RemoveKeys(keyIDs)
+	if err := os.WriteFile(privKeyPath, privKeyContents, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(pubKeyPath, pubKeyContents, 0644); err != nil {
+		return err
+	}
+
+	fmt.Println(pubKey.IDs()[0])
+	return nil
 }
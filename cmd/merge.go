@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	"github.com/adityasaky/gittuf/gittuf"
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/spf13/cobra"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <branch> [git commit args]",
+	Short: "Merges a branch and records the merge commit",
+	Long: `Merge a branch into the current branch and record the merge commit in the
+gittuf state. The commits being merged need not be authorized. Instead, the
+changes the merge makes to the current branch are checked against the rules
+using the keys signing the merge, the same way they are verified when the
+state is pulled. A merge commit is always created. If the merge has
+conflicts, resolve them and record the merge using gittuf commit.`,
+	RunE: runMerge,
+	Args: cobra.MinimumNArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+
+	addRoleSignerFlags(mergeCmd)
+
+	mergeCmd.Flags().StringVarP(
+		&roleExpires,
+		"role-expires",
+		"",
+		"",
+		"Expiry for role metadata in days",
+	)
+}
+
+func runMerge(cmd *cobra.Command, args []string) error {
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+	state := store.State()
+
+	remotes, err := store.Repository().Remotes()
+	if err != nil {
+		return err
+	}
+	if len(remotes) > 0 {
+		err = state.FetchFromRemote(gitstore.DefaultRemote)
+		if err != nil {
+			return err
+		}
+	}
+
+	roleSigners, err := loadRoleSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(roleSigners)
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	branchName, err := gittuf.GetRefNameForHEAD()
+	if err != nil {
+		return err
+	}
+
+	expires, err := parseExpires(roleExpires, "targets")
+	if err != nil {
+		return err
+	}
+
+	newRoleMb, target, err := gittuf.Merge(state, branchName, args[0], roleSigners, expires, args[1:]...)
+	if err != nil {
+		return err
+	}
+
+	// All errors after this point should undo the merge
+
+	roleName, err := gittuf.GetRoleNameForTarget(target)
+	if err != nil {
+		return gittuf.AbortMerge(gittuf.UndoLastCommit(err))
+	}
+
+	newRoleBytes, err := json.Marshal(newRoleMb)
+	if err != nil {
+		return gittuf.AbortMerge(gittuf.UndoLastCommit(err))
+	}
+
+	err = state.StageMetadataAndCommit(roleName, newRoleBytes, gittuf.NewSnapshotter(snapshotSigners))
+	if err != nil {
+		return gittuf.AbortMerge(gittuf.UndoLastCommit(err))
+	}
+
+	err = gittuf.TrustState(store, target, state, allowExpired)
+	if err != nil {
+		return gittuf.AbortMerge(gittuf.UndoLastCommit(err))
+	}
+
+	return nil
+}
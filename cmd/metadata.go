@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/adityasaky/gittuf/gittuf"
 	"github.com/adityasaky/gittuf/internal/gitstore"
@@ -48,6 +49,19 @@ var metadataRmCmd = &cobra.Command{
 	RunE:  runMetadataRm,
 }
 
+var metadataResignCmd = &cobra.Command{
+	Use:   "resign [role]...",
+	Short: "Refresh the expiry of the specified roles and sign them again",
+	Long: `Increment the version of each specified role, update its expiry, and sign it
+with the specified keys. All updated roles are written in a single state commit.`,
+	RunE: runMetadataResign,
+}
+
+var (
+	resignExpires  string
+	expiringWithin string
+)
+
 func init() {
 	metadataLsCmd.Flags().BoolVarP(
 		&long,
@@ -57,11 +71,36 @@ func init() {
 		"Use a long listing format",
 	)
 
+	metadataResignCmd.Flags().StringArrayVarP(
+		&signingKeys,
+		"signing-key",
+		"",
+		[]string{},
+		"Signing key, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+	)
+
+	metadataResignCmd.Flags().StringVarP(
+		&resignExpires,
+		"expires",
+		"",
+		"",
+		"Expiry for the metadata in days, the default expiry of each role is used if unset",
+	)
+
+	metadataResignCmd.Flags().StringVarP(
+		&expiringWithin,
+		"all-expiring-within",
+		"",
+		"",
+		"Also resign all roles that expire within the specified duration, such as 14d",
+	)
+
 	metadataCmd.AddCommand(metadataInitCmd)
 	metadataCmd.AddCommand(metadataLsCmd)
 	metadataCmd.AddCommand(metadataAddCmd)
 	metadataCmd.AddCommand(metadataCatCmd)
 	metadataCmd.AddCommand(metadataRmCmd)
+	metadataCmd.AddCommand(metadataResignCmd)
 
 	rootCmd.AddCommand(metadataCmd)
 }
@@ -86,10 +125,11 @@ func runMetadataLs(cmd *cobra.Command, args []string) error {
 	}
 
 	for _, e := range currentTree.Entries {
+		name := fmt.Sprintf("%s.json", gitstore.MetadataRoleName(e.Name))
 		if long {
-			fmt.Println(e.Mode.String(), e.Hash.String(), e.Name)
+			fmt.Println(e.Mode.String(), e.Hash.String(), name)
 		} else {
-			fmt.Println(e.Name)
+			fmt.Println(name)
 		}
 	}
 	return nil
@@ -110,7 +150,14 @@ func runMetadataAdd(cmd *cobra.Command, args []string) error {
 		}
 		metadata[n] = c
 	}
-	return store.State().StageAndCommitMultipleMetadata(metadata)
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	return store.State().StageAndCommitMultipleMetadata(metadata, gittuf.NewSnapshotter(snapshotSigners))
 }
 
 func runMetadataCat(cmd *cobra.Command, args []string) error {
@@ -143,5 +190,87 @@ func runMetadataRm(cmd *cobra.Command, args []string) error {
 		roles = append(roles, strings.TrimSuffix(n, ".json"))
 	}
 
-	return store.State().RemoveMetadata(roles)
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	return store.State().RemoveMetadata(roles, gittuf.NewSnapshotter(snapshotSigners))
+}
+
+func runMetadataResign(cmd *cobra.Command, args []string) error {
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+	state := store.State()
+
+	remotes, err := store.Repository().Remotes()
+	if err != nil {
+		return err
+	}
+	if len(remotes) > 0 {
+		err = state.FetchFromRemote(gitstore.DefaultRemote)
+		if err != nil {
+			return err
+		}
+	}
+
+	roles := []string{}
+	for _, n := range args {
+		roles = append(roles, strings.TrimSuffix(n, ".json"))
+	}
+
+	if len(expiringWithin) > 0 {
+		window, err := parseDuration(expiringWithin)
+		if err != nil {
+			return err
+		}
+		expiring, err := gittuf.GetRolesExpiringWithin(state, window)
+		if err != nil {
+			return err
+		}
+		for _, e := range expiring {
+			roles = append(roles, e.Role)
+		}
+	}
+
+	if len(roles) == 0 {
+		fmt.Println("No roles to resign")
+		return nil
+	}
+
+	var expires time.Time
+	if len(resignExpires) > 0 {
+		expires, err = parseExpires(resignExpires, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	signers, err := loadSigners(signingKeys)
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(signers)
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	updated, err := gittuf.ResignRoles(state, roles, signers, expires)
+	if err != nil {
+		return err
+	}
+
+	state.StageMultipleMetadata(updated)
+	for _, roleName := range roles {
+		if roleName == gitstore.SnapshotRole {
+			state.StageSnapshot()
+		}
+	}
+	return state.Commit(gittuf.NewSnapshotter(snapshotSigners))
 }
@@ -17,10 +17,13 @@ var newRuleCmd = &cobra.Command{
 }
 
 var (
+	ruleParent      string
 	ruleName        string
 	ruleThreshold   int
 	ruleTerminating bool
 	protectPaths    []string
+	pathHashPrefix  []string
+	ruleOperations  []string
 	allowedKeyPaths []string
 )
 
@@ -32,7 +35,7 @@ func init() {
 		"role-key",
 		"",
 		[]string{},
-		"Path to signing key for role",
+		"Signing key for role, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
 	)
 
 	newRuleCmd.Flags().StringVarP(
@@ -43,6 +46,14 @@ func init() {
 		"Name of rule, used for delegation name",
 	)
 
+	newRuleCmd.Flags().StringVarP(
+		&ruleParent,
+		"parent",
+		"",
+		"targets",
+		"Name of the rule that delegates the new rule, the top level targets role by default",
+	)
+
 	newRuleCmd.Flags().IntVarP(
 		&ruleThreshold,
 		"rule-threshold",
@@ -67,6 +78,22 @@ func init() {
 		"Path to protect",
 	)
 
+	newRuleCmd.Flags().StringArrayVarP(
+		&pathHashPrefix,
+		"protect-path-hash-prefix",
+		"",
+		[]string{},
+		"Prefix of the SHA-256 hash of paths to protect, cannot be combined with --protect-path",
+	)
+
+	newRuleCmd.Flags().StringArrayVarP(
+		&ruleOperations,
+		"allow-operation",
+		"",
+		[]string{},
+		"Operation the rule authorizes, one of create, modify, delete, rename, copy, mode, symlink, or submodule, defaults to all",
+	)
+
 	newRuleCmd.Flags().StringArrayVarP(
 		&allowedKeyPaths,
 		"allow-key",
@@ -74,6 +101,14 @@ func init() {
 		[]string{},
 		"Key allowed to sign metadata for protected paths",
 	)
+
+	newRuleCmd.Flags().StringVarP(
+		&proposalID,
+		"propose",
+		"",
+		"",
+		"Record the rule as a proposal with the specified ID instead of applying it",
+	)
 }
 
 func runNewRule(cmd *cobra.Command, args []string) error {
@@ -94,26 +129,23 @@ func runNewRule(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	var roleKeys []tufdata.PrivateKey
-	for _, k := range roleKeyPaths {
-		privKey, err := gittuf.LoadEd25519PrivateKeyFromSslib(k)
-		if err != nil {
-			return err
-		}
-		roleKeys = append(roleKeys, privKey)
+	roleSigners, err := loadSigners(roleKeyPaths)
+	if err != nil {
+		return err
 	}
+	defer gittuf.CloseSigners(roleSigners)
 
-	var allowedKeys []tufdata.PublicKey
+	var allowedKeys []*tufdata.PublicKey
 	for _, k := range allowedKeyPaths {
-		pubKey, err := gittuf.LoadEd25519PublicKeyFromSslib(k)
+		pubKey, err := gittuf.LoadPublicKey(k)
 		if err != nil {
 			return err
 		}
 		allowedKeys = append(allowedKeys, pubKey)
 	}
 
-	newRoleMb, err := gittuf.NewRule(state, roleKeys, ruleName, ruleThreshold,
-		ruleTerminating, protectPaths, allowedKeys)
+	newRoleMb, err := gittuf.NewRule(state, roleSigners, ruleParent, ruleName, ruleThreshold,
+		ruleTerminating, protectPaths, pathHashPrefix, ruleOperations, allowedKeys)
 	if err != nil {
 		return err
 	}
@@ -123,5 +155,16 @@ func runNewRule(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	return state.StageMetadataAndCommit("targets", newRoleBytes)
+	if len(proposalID) > 0 {
+		_, err = store.CreateProposal(proposalID, map[string][]byte{ruleParent: newRoleBytes}, nil)
+		return err
+	}
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	return state.StageMetadataAndCommit(ruleParent, newRoleBytes, gittuf.NewSnapshotter(snapshotSigners))
 }
@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adityasaky/gittuf/gittuf"
+	"github.com/spf13/cobra"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage the repository's policy as a declarative file",
+}
+
+var policyApplyCmd = &cobra.Command{
+	Use:   "apply <policy file>",
+	Short: "Apply a policy file to the delegations",
+	Long: `Compare a policy file with the rules currently in the delegations, print the
+changes needed, and write and sign the resulting metadata. The policy lists
+principals, which name sets of keys, and rules, which are searched in the
+order they are listed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPolicyApply,
+}
+
+var policyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write the current policy in the format read by policy apply",
+	Args:  cobra.NoArgs,
+	RunE:  runPolicyExport,
+}
+
+var policyExplainCmd = &cobra.Command{
+	Use:   "explain <path or target>",
+	Short: "Explain which rules protect a path or ref",
+	Long: `Walk the delegations for a path, Git target such as git:branch=main, or ref
+such as refs/heads/main, and print every rule considered. Changes must be
+signed by a threshold of the keys of one of the consulted rules, which are
+tried in order. Key IDs are shown with principal names from --policy.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPolicyExplain,
+}
+
+var (
+	policyDryRun bool
+	policyOutput string
+
+	explainState  string
+	explainPolicy string
+	explainJSON   bool
+)
+
+func init() {
+	policyApplyCmd.Flags().StringArrayVarP(
+		&roleKeyPaths,
+		"role-key",
+		"",
+		[]string{},
+		"Signing key for roles whose metadata changes, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+	)
+
+	policyApplyCmd.Flags().BoolVarP(
+		&policyDryRun,
+		"dry-run",
+		"",
+		false,
+		"Print the changes without applying them",
+	)
+
+	policyApplyCmd.Flags().StringVarP(
+		&proposalID,
+		"propose",
+		"",
+		"",
+		"Record the changes as a proposal with the specified ID instead of applying them",
+	)
+
+	policyExportCmd.Flags().StringVarP(
+		&policyOutput,
+		"output",
+		"o",
+		"",
+		"Write the policy to a file instead of standard output",
+	)
+
+	policyExplainCmd.Flags().StringVarP(
+		&explainState,
+		"state",
+		"",
+		"",
+		"ID of the state to explain the policy of, the current state by default",
+	)
+
+	policyExplainCmd.Flags().StringVarP(
+		&explainPolicy,
+		"policy",
+		"",
+		"",
+		"Policy file used to show the names of principals",
+	)
+
+	policyExplainCmd.Flags().BoolVarP(
+		&explainJSON,
+		"json",
+		"",
+		false,
+		"Print the explanation as JSON",
+	)
+
+	policyCmd.AddCommand(policyApplyCmd)
+	policyCmd.AddCommand(policyExportCmd)
+	policyCmd.AddCommand(policyExplainCmd)
+	rootCmd.AddCommand(policyCmd)
+}
+
+func runPolicyApply(cmd *cobra.Command, args []string) error {
+	policy, err := gittuf.LoadPolicy(args[0])
+	if err != nil {
+		return err
+	}
+
+	store, state, roleSigners, err := loadRuleChangeContext()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(roleSigners)
+
+	plan, err := gittuf.PlanPolicy(state, policy)
+	if err != nil {
+		return err
+	}
+	if len(plan.Changes) == 0 {
+		fmt.Println("Policy is already applied")
+		return nil
+	}
+	for _, change := range plan.Changes {
+		fmt.Println(change)
+	}
+	if policyDryRun {
+		return nil
+	}
+
+	signed, err := gittuf.SignPolicyPlan(plan, roleSigners, len(proposalID) == 0)
+	if err != nil {
+		return err
+	}
+
+	if len(proposalID) > 0 {
+		_, err = store.CreateProposal(proposalID, signed, nil)
+		return err
+	}
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	state.StageMultipleMetadata(signed)
+	return state.Commit(gittuf.NewSnapshotter(snapshotSigners))
+}
+
+func runPolicyExport(cmd *cobra.Command, args []string) error {
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+
+	policy, err := gittuf.ExportPolicy(store.State())
+	if err != nil {
+		return err
+	}
+	contents, err := policy.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if len(policyOutput) > 0 {
+		return os.WriteFile(policyOutput, contents, 0644)
+	}
+	fmt.Print(string(contents))
+	return nil
+}
+
+func runPolicyExplain(cmd *cobra.Command, args []string) error {
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+	state := store.State()
+	if len(explainState) > 0 {
+		state, err = store.SpecificState(explainState)
+		if err != nil {
+			return err
+		}
+	}
+
+	principalNames := map[string]string{}
+	if len(explainPolicy) > 0 {
+		policy, err := gittuf.LoadPolicy(explainPolicy)
+		if err != nil {
+			return err
+		}
+		principalNames, err = policy.PrincipalNames()
+		if err != nil {
+			return err
+		}
+	}
+
+	explanation, err := gittuf.ExplainTarget(state, args[0], principalNames)
+	if err != nil {
+		return err
+	}
+
+	if explainJSON {
+		contents, err := json.MarshalIndent(explanation, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(contents))
+		return nil
+	}
+
+	fmt.Println("Target:", explanation.Target)
+	fmt.Println("State:", explanation.State)
+	for _, r := range explanation.Rules {
+		status := "does not match"
+		switch {
+		case r.Consulted:
+			status = "matches, consulted"
+		case r.Matched && r.Rule == gittuf.AllowRule:
+			status = "matches, not consulted as other rules match"
+		case r.Matched:
+			status = "matches, delegates further"
+		}
+		fmt.Printf("  %s (delegated by %s): %s\n", r.Rule, r.Parent, status)
+		if !r.Matched {
+			continue
+		}
+		if r.Rule == gittuf.AllowRule {
+			if !r.Consulted {
+				continue
+			}
+			fmt.Println("    any key may sign")
+			continue
+		}
+		terminating := "non-terminating, later rules may also authorize changes"
+		if r.Terminating {
+			terminating = "terminating, later rules are not consulted"
+		}
+		fmt.Printf("    threshold %d, %s\n", r.Threshold, terminating)
+		if len(r.Operations) > 0 {
+			fmt.Printf("    only authorizes %s\n", strings.Join(r.Operations, ", "))
+		}
+		for _, k := range r.Keys {
+			if len(k.Principal) > 0 {
+				fmt.Printf("    key %s (%s)\n", k.KeyID, k.Principal)
+			} else {
+				fmt.Printf("    key %s\n", k.KeyID)
+			}
+		}
+	}
+	fmt.Printf("Changes must meet the threshold of one of: %s\n", strings.Join(explanation.Consulted, ", "))
+	return nil
+}
@@ -21,5 +21,5 @@ func runPull(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	return gittuf.Pull(store, args[0], args[1])
+	return gittuf.Pull(store, args[0], args[1], allowExpired)
 }
@@ -46,6 +46,22 @@ func init() {
 		logrus.DebugLevel.String(),
 		"Verbosity level (debug, info, warn, error, fatal, panic)",
 	)
+
+	rootCmd.PersistentFlags().BoolVarP(
+		&allowExpired,
+		"allow-expired",
+		"",
+		false,
+		"Accept expired metadata, useful when auditing historical states",
+	)
+
+	rootCmd.PersistentFlags().StringArrayVarP(
+		&snapshotKeys,
+		"snapshot-key",
+		"",
+		[]string{},
+		"Signing key for snapshot metadata, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+	)
 }
 
 func preRoot(cmd *cobra.Command, args []string) error {
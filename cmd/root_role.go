@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/adityasaky/gittuf/gittuf"
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/spf13/cobra"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+var rootRoleCmd = &cobra.Command{
+	Use:   "root",
+	Short: "Update the gittuf root of trust",
+	Long: `Update the root role. Each command writes a new version of root metadata that
+must be signed by a threshold of both the current and the new root keys.`,
+}
+
+var rootRotateCmd = &cobra.Command{
+	Use:   "rotate <public key>...",
+	Short: "Replace all root keys with the specified keys",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runRootRotate,
+}
+
+var rootAddKeyCmd = &cobra.Command{
+	Use:   "add-key <public key>...",
+	Short: "Add the specified keys to the root role",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runRootAddKey,
+}
+
+var rootRemoveKeyCmd = &cobra.Command{
+	Use:   "remove-key <key ID>...",
+	Short: "Remove the specified keys from the root role",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runRootRemoveKey,
+}
+
+var rootSetThresholdCmd = &cobra.Command{
+	Use:   "set-threshold <threshold>",
+	Short: "Set the threshold of the root role",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runRootSetThreshold,
+}
+
+var (
+	rootSigningKeys  []string
+	rootRoleExpires  string
+	newRootThreshold int
+)
+
+func init() {
+	for _, c := range []*cobra.Command{rootRotateCmd, rootAddKeyCmd, rootRemoveKeyCmd, rootSetThresholdCmd, keysAddCmd, keysRmCmd} {
+		c.Flags().StringArrayVarP(
+			&rootSigningKeys,
+			"root-key",
+			"",
+			[]string{},
+			"Signing key for root metadata, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+		)
+
+		c.Flags().StringVarP(
+			&rootRoleExpires,
+			"expires",
+			"",
+			"",
+			"Expiry for root metadata in days",
+		)
+
+		c.Flags().StringVarP(
+			&proposalID,
+			"propose",
+			"",
+			"",
+			"Record the root metadata as a proposal with the specified ID instead of applying it",
+		)
+	}
+
+	rootRoleCmd.AddCommand(rootRotateCmd)
+	rootRoleCmd.AddCommand(rootAddKeyCmd)
+	rootRoleCmd.AddCommand(rootRemoveKeyCmd)
+	rootRoleCmd.AddCommand(rootSetThresholdCmd)
+
+	rootRotateCmd.Flags().IntVarP(
+		&newRootThreshold,
+		"root-threshold",
+		"",
+		0,
+		"Threshold of signatures needed for root role, the current threshold is retained if unset",
+	)
+
+	rootCmd.AddCommand(rootRoleCmd)
+}
+
+func runRootRotate(cmd *cobra.Command, args []string) error {
+	keys, err := loadPublicKeys(args)
+	if err != nil {
+		return err
+	}
+	return updateRoot(func(state *gitstore.State, signers []tufkeys.Signer, expires time.Time) (tufdata.Signed, error) {
+		return gittuf.RotateRootKeys(state, signers, keys, newRootThreshold, expires)
+	})
+}
+
+func runRootAddKey(cmd *cobra.Command, args []string) error {
+	keys, err := loadPublicKeys(args)
+	if err != nil {
+		return err
+	}
+	return updateRoot(func(state *gitstore.State, signers []tufkeys.Signer, expires time.Time) (tufdata.Signed, error) {
+		return gittuf.AddRootKeys(state, signers, keys, expires)
+	})
+}
+
+func runRootRemoveKey(cmd *cobra.Command, args []string) error {
+	return updateRoot(func(state *gitstore.State, signers []tufkeys.Signer, expires time.Time) (tufdata.Signed, error) {
+		return gittuf.RemoveRootKeys(state, signers, args, expires)
+	})
+}
+
+func runRootSetThreshold(cmd *cobra.Command, args []string) error {
+	threshold, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	return updateRoot(func(state *gitstore.State, signers []tufkeys.Signer, expires time.Time) (tufdata.Signed, error) {
+		return gittuf.SetRootThreshold(state, signers, threshold, expires)
+	})
+}
+
+// updateRoot creates the new root metadata using newRoot and either writes it
+// to the state or records it as a proposal.
+func updateRoot(newRoot func(*gitstore.State, []tufkeys.Signer, time.Time) (tufdata.Signed, error)) error {
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+	state := store.State()
+
+	remotes, err := store.Repository().Remotes()
+	if err != nil {
+		return err
+	}
+	if len(remotes) > 0 {
+		err = state.FetchFromRemote(gitstore.DefaultRemote)
+		if err != nil {
+			return err
+		}
+	}
+
+	signers, err := loadSigners(rootSigningKeys)
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(signers)
+
+	expires, err := parseExpires(rootRoleExpires, "root")
+	if err != nil {
+		return err
+	}
+
+	rootMb, err := newRoot(state, signers, expires)
+	if err != nil {
+		return err
+	}
+
+	if len(proposalID) > 0 {
+		rootBytes, err := json.Marshal(rootMb)
+		if err != nil {
+			return err
+		}
+		_, err = store.CreateProposal(proposalID, map[string][]byte{"root": rootBytes}, nil)
+		return err
+	}
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	return gittuf.WriteRoot(state, rootMb, snapshotSigners)
+}
+
+func loadPublicKeys(paths []string) ([]*tufdata.PublicKey, error) {
+	keys := []*tufdata.PublicKey{}
+	for _, p := range paths {
+		key, err := gittuf.LoadPublicKey(p)
+		if err != nil {
+			return []*tufdata.PublicKey{}, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,441 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/adityasaky/gittuf/gittuf"
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/spf13/cobra"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+var ruleCmd = &cobra.Command{
+	Use:   "rule",
+	Short: "Manage the rules protecting the repository",
+}
+
+var ruleBinsCmd = &cobra.Command{
+	Use:   "bins",
+	Short: "Manage hash bin delegations",
+}
+
+var ruleBinsCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Delegate the paths of a rule to hash bins",
+	Long: `Delegate all the paths of a rule to a number of hash bins. Each path is
+assigned to a bin using the SHA-256 hash of the path, so the bin responsible
+for a path is found without checking every bin. The bins are named after
+--name-prefix and their index in hex, such as bins-0a, and can delegate paths
+further using new-rule --parent.`,
+	RunE: runRuleBinsCreate,
+}
+
+var ruleLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the rules in the order they are searched",
+	Args:  cobra.NoArgs,
+	RunE:  runRuleLs,
+}
+
+var ruleShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show the paths, keys and threshold of a rule",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runRuleShow,
+}
+
+var ruleUpdateCmd = &cobra.Command{
+	Use:   "update <name>",
+	Short: "Change the paths, keys, threshold or operations of a rule",
+	Long: `Change the paths, keys, threshold or operations of a rule. The metadata of
+the role that delegates the rule is updated, so --role-key must be a key of
+that role.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRuleUpdate,
+}
+
+var ruleRmCmd = &cobra.Command{
+	Use:   "rm <name>",
+	Short: "Remove a rule",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runRuleRm,
+}
+
+var ruleMoveCmd = &cobra.Command{
+	Use:   "move <name>",
+	Short: "Move a rule before another rule with the same parent",
+	Long: `Move a rule before another rule delegated by the same role. Rules are
+searched in order, so this changes which rule is consulted first.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRuleMove,
+}
+
+var (
+	binsParent     string
+	binsNamePrefix string
+	binsCount      int
+
+	updateAddPaths     []string
+	updateRemovePaths  []string
+	updateAddKeyPaths  []string
+	updateRemoveKeyIDs []string
+	updateThreshold    int
+	updateOperations   []string
+	updateAllOps       bool
+
+	moveBefore string
+)
+
+func init() {
+	ruleBinsCreateCmd.Flags().StringArrayVarP(
+		&roleKeyPaths,
+		"role-key",
+		"",
+		[]string{},
+		"Signing key for the parent rule, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+	)
+
+	ruleBinsCreateCmd.Flags().StringVarP(
+		&binsParent,
+		"parent",
+		"",
+		"",
+		"Name of the rule that delegates to the bins",
+	)
+
+	ruleBinsCreateCmd.Flags().StringVarP(
+		&binsNamePrefix,
+		"name-prefix",
+		"",
+		"bins",
+		"Prefix for the names of the bins",
+	)
+
+	ruleBinsCreateCmd.Flags().IntVarP(
+		&binsCount,
+		"count",
+		"",
+		16,
+		"Number of bins, must be a power of two",
+	)
+
+	ruleBinsCreateCmd.Flags().IntVarP(
+		&ruleThreshold,
+		"rule-threshold",
+		"",
+		1,
+		"Threshold of keys that must sign for each bin",
+	)
+
+	ruleBinsCreateCmd.Flags().StringArrayVarP(
+		&allowedKeyPaths,
+		"allow-key",
+		"",
+		[]string{},
+		"Key allowed to sign metadata for the bins",
+	)
+
+	ruleBinsCreateCmd.Flags().StringVarP(
+		&proposalID,
+		"propose",
+		"",
+		"",
+		"Record the bins as a proposal with the specified ID instead of applying them",
+	)
+
+	for _, c := range []*cobra.Command{ruleUpdateCmd, ruleRmCmd, ruleMoveCmd} {
+		c.Flags().StringArrayVarP(
+			&roleKeyPaths,
+			"role-key",
+			"",
+			[]string{},
+			"Signing key for the role that delegates the rule, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+		)
+
+		c.Flags().StringVarP(
+			&proposalID,
+			"propose",
+			"",
+			"",
+			"Record the change as a proposal with the specified ID instead of applying it",
+		)
+	}
+
+	ruleUpdateCmd.Flags().StringArrayVarP(
+		&updateAddPaths,
+		"add-path",
+		"",
+		[]string{},
+		"Path to add to the rule",
+	)
+
+	ruleUpdateCmd.Flags().StringArrayVarP(
+		&updateRemovePaths,
+		"remove-path",
+		"",
+		[]string{},
+		"Path or path hash prefix to remove from the rule",
+	)
+
+	ruleUpdateCmd.Flags().StringArrayVarP(
+		&updateAddKeyPaths,
+		"add-key",
+		"",
+		[]string{},
+		"Key to allow to sign for the rule",
+	)
+
+	ruleUpdateCmd.Flags().StringArrayVarP(
+		&updateRemoveKeyIDs,
+		"remove-key-id",
+		"",
+		[]string{},
+		"ID of a key to no longer allow to sign for the rule",
+	)
+
+	ruleUpdateCmd.Flags().IntVarP(
+		&updateThreshold,
+		"threshold",
+		"",
+		0,
+		"New threshold of keys that must sign for the rule",
+	)
+
+	ruleUpdateCmd.Flags().StringArrayVarP(
+		&updateOperations,
+		"allow-operation",
+		"",
+		[]string{},
+		"Operation the rule authorizes, replacing the rule's operations, one of create, modify, delete, rename, copy, mode, symlink, or submodule",
+	)
+
+	ruleUpdateCmd.Flags().BoolVarP(
+		&updateAllOps,
+		"allow-all-operations",
+		"",
+		false,
+		"Authorize every operation, removing any limit on the rule's operations",
+	)
+
+	ruleMoveCmd.Flags().StringVarP(
+		&moveBefore,
+		"before",
+		"",
+		"",
+		"Name of the rule to move the rule before",
+	)
+
+	ruleBinsCmd.AddCommand(ruleBinsCreateCmd)
+	ruleCmd.AddCommand(ruleBinsCmd)
+	ruleCmd.AddCommand(ruleLsCmd)
+	ruleCmd.AddCommand(ruleShowCmd)
+	ruleCmd.AddCommand(ruleUpdateCmd)
+	ruleCmd.AddCommand(ruleRmCmd)
+	ruleCmd.AddCommand(ruleMoveCmd)
+	rootCmd.AddCommand(ruleCmd)
+}
+
+func runRuleLs(cmd *cobra.Command, args []string) error {
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+
+	rules, err := gittuf.ListRules(store.State())
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		paths := rule.Paths
+		if len(rule.PathHashPrefixes) > 0 {
+			paths = []string{fmt.Sprintf("hash prefixes %s", strings.Join(rule.PathHashPrefixes, ","))}
+		}
+		fmt.Printf("%-24s %-24s %-4d %s\n", rule.Name, rule.Parent, rule.Threshold, strings.Join(paths, " "))
+	}
+	return nil
+}
+
+func runRuleShow(cmd *cobra.Command, args []string) error {
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+
+	rule, err := gittuf.GetRule(store.State(), args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println("Name:", rule.Name)
+	fmt.Println("Parent:", rule.Parent)
+	fmt.Println("Threshold:", rule.Threshold)
+	fmt.Println("Terminating:", rule.Terminating)
+	for _, p := range rule.Paths {
+		fmt.Println("Path:", p)
+	}
+	for _, p := range rule.PathHashPrefixes {
+		fmt.Println("Path hash prefix:", p)
+	}
+	operations := rule.Operations
+	if len(operations) == 0 {
+		operations = gittuf.AllOperations
+	}
+	fmt.Println("Operations:", strings.Join(operations, ", "))
+	for _, keyID := range rule.KeyIDs {
+		fmt.Println("Key:", keyID)
+	}
+	return nil
+}
+
+func runRuleUpdate(cmd *cobra.Command, args []string) error {
+	store, state, roleSigners, err := loadRuleChangeContext()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(roleSigners)
+
+	update := gittuf.RuleUpdate{
+		AddPaths:     updateAddPaths,
+		RemovePaths:  updateRemovePaths,
+		RemoveKeyIDs: updateRemoveKeyIDs,
+		Threshold:    updateThreshold,
+	}
+	if updateAllOps && len(updateOperations) > 0 {
+		return fmt.Errorf("--allow-operation cannot be combined with --allow-all-operations")
+	}
+	if updateAllOps {
+		update.Operations = []string{}
+	} else if len(updateOperations) > 0 {
+		update.Operations = updateOperations
+	}
+	for _, k := range updateAddKeyPaths {
+		pubKey, err := gittuf.LoadPublicKey(k)
+		if err != nil {
+			return err
+		}
+		update.AddKeys = append(update.AddKeys, pubKey)
+	}
+
+	parentName, parentMb, err := gittuf.UpdateRule(state, roleSigners, args[0], update)
+	if err != nil {
+		return err
+	}
+	return applyRuleChange(store, state, parentName, parentMb)
+}
+
+func runRuleRm(cmd *cobra.Command, args []string) error {
+	store, state, roleSigners, err := loadRuleChangeContext()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(roleSigners)
+
+	parentName, parentMb, removed, err := gittuf.RemoveRule(state, roleSigners, args[0])
+	if err != nil {
+		return err
+	}
+	return applyRuleChange(store, state, parentName, parentMb, removed...)
+}
+
+func runRuleMove(cmd *cobra.Command, args []string) error {
+	if len(moveBefore) == 0 {
+		return fmt.Errorf("rule to move before must be specified using --before")
+	}
+
+	store, state, roleSigners, err := loadRuleChangeContext()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(roleSigners)
+
+	parentName, parentMb, err := gittuf.MoveRule(state, roleSigners, args[0], moveBefore)
+	if err != nil {
+		return err
+	}
+	return applyRuleChange(store, state, parentName, parentMb)
+}
+
+// loadRuleChangeContext fetches the latest state and loads the role keys used
+// to sign a change to a rule.
+func loadRuleChangeContext() (*gitstore.GitStore, *gitstore.State, []tufkeys.Signer, error) {
+	store, err := getGitStore()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	state := store.State()
+
+	remotes, err := store.Repository().Remotes()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(remotes) > 0 {
+		err = state.FetchFromRemote(gitstore.DefaultRemote)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	roleSigners, err := loadSigners(roleKeyPaths)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return store, state, roleSigners, nil
+}
+
+/*
+applyRuleChange records the new metadata for the role, along with the removal
+of the metadata of the removed roles, as a proposal if --propose is set, and
+commits them to the state otherwise.
+*/
+func applyRuleChange(store *gitstore.GitStore, state *gitstore.State, roleName string, roleMb tufdata.Signed, removed ...string) error {
+	roleBytes, err := json.Marshal(roleMb)
+	if err != nil {
+		return err
+	}
+
+	if len(proposalID) > 0 {
+		_, err = store.CreateProposal(proposalID, map[string][]byte{roleName: roleBytes}, removed)
+		return err
+	}
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	state.StageMetadata(roleName, roleBytes)
+	state.StageMetadataRemoval(removed)
+	return state.Commit(gittuf.NewSnapshotter(snapshotSigners))
+}
+
+func runRuleBinsCreate(cmd *cobra.Command, args []string) error {
+	if len(binsParent) == 0 {
+		return fmt.Errorf("parent rule must be specified using --parent")
+	}
+
+	store, state, roleSigners, err := loadRuleChangeContext()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(roleSigners)
+
+	var allowedKeys []*tufdata.PublicKey
+	for _, k := range allowedKeyPaths {
+		pubKey, err := gittuf.LoadPublicKey(k)
+		if err != nil {
+			return err
+		}
+		allowedKeys = append(allowedKeys, pubKey)
+	}
+
+	parentMb, err := gittuf.NewHashBins(state, roleSigners, binsParent, binsNamePrefix, binsCount,
+		ruleThreshold, allowedKeys)
+	if err != nil {
+		return err
+	}
+
+	return applyRuleChange(store, state, binsParent, parentMb)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/adityasaky/gittuf/gittuf"
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/spf13/cobra"
+)
+
+var signCmd = &cobra.Command{
+	Use:   "sign <proposal>",
+	Short: "Add signatures to a proposal",
+	Long: `Add signatures to the metadata in a proposal. Each key signs the roles in the
+proposal it is authorized for. If the repository has a remote, the proposal is
+fetched from it before signing and pushed back once signed. Once a threshold
+of signatures is met for every role, the proposal can be applied using gittuf
+apply.`,
+	RunE: runSign,
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+
+	signCmd.Flags().StringArrayVarP(
+		&signingKeys,
+		"signing-key",
+		"",
+		[]string{},
+		"Signing key, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+	)
+}
+
+func runSign(cmd *cobra.Command, args []string) error {
+	if len(signingKeys) == 0 {
+		return fmt.Errorf("at least one signing key must be specified")
+	}
+
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+
+	if err := fetchProposal(store, args[0]); err != nil {
+		return err
+	}
+
+	proposal, err := store.LoadProposal(args[0])
+	if err != nil {
+		return err
+	}
+
+	signers, err := loadSigners(signingKeys)
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(signers)
+
+	if err := gittuf.SignProposal(store.State(), proposal, signers); err != nil {
+		return err
+	}
+
+	remotes, err := store.Repository().Remotes()
+	if err != nil {
+		return err
+	}
+	if len(remotes) == 0 {
+		return nil
+	}
+	return store.PushProposal(gitstore.DefaultRemote, args[0])
+}
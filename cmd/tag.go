@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	"github.com/adityasaky/gittuf/gittuf"
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/spf13/cobra"
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag <name> [git tag args]",
+	Short: "Creates a tag and records it in the gittuf state",
+	Long: `Create a tag using git tag and record the object it points to in the gittuf
+state, signed by keys authorized by the rules protecting git:tag=<name>.
+Recorded tags cannot be moved unless --force is set and the keys of the role
+that delegates the rule protecting the tag approve the move.`,
+	RunE: runTag,
+	Args: cobra.MinimumNArgs(1),
+}
+
+var tagForce bool
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+
+	addRoleSignerFlags(tagCmd)
+
+	tagCmd.Flags().StringVarP(
+		&roleExpires,
+		"role-expires",
+		"",
+		"",
+		"Expiry for role metadata in days",
+	)
+
+	tagCmd.Flags().BoolVarP(
+		&tagForce,
+		"force",
+		"",
+		false,
+		"Move a recorded tag, requires keys of the role delegating the rule protecting the tag",
+	)
+}
+
+func runTag(cmd *cobra.Command, args []string) error {
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+	state := store.State()
+
+	remotes, err := store.Repository().Remotes()
+	if err != nil {
+		return err
+	}
+	if len(remotes) > 0 {
+		err = state.FetchFromRemote(gitstore.DefaultRemote)
+		if err != nil {
+			return err
+		}
+	}
+
+	roleSigners, err := loadRoleSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(roleSigners)
+
+	snapshotSigners, err := loadSnapshotSigners()
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(snapshotSigners)
+
+	expires, err := parseExpires(roleExpires, "targets")
+	if err != nil {
+		return err
+	}
+
+	tagName := args[0]
+	previousID, _ := gittuf.GetTipCommitIDForRef(tagName, gittuf.GitTagRef)
+
+	newRoleMb, target, err := gittuf.Tag(state, tagName, roleSigners, expires, tagForce, args[1:]...)
+	if err != nil {
+		return err
+	}
+
+	// All errors after this point should undo the tag
+
+	roleName, err := gittuf.GetRoleNameForTarget(target)
+	if err != nil {
+		return gittuf.UndoTag(tagName, previousID, err)
+	}
+
+	newRoleBytes, err := json.Marshal(newRoleMb)
+	if err != nil {
+		return gittuf.UndoTag(tagName, previousID, err)
+	}
+
+	err = state.StageMetadataAndCommit(roleName, newRoleBytes, gittuf.NewSnapshotter(snapshotSigners))
+	if err != nil {
+		return gittuf.UndoTag(tagName, previousID, err)
+	}
+
+	err = gittuf.TrustState(store, target, state, allowExpired)
+	if err != nil {
+		return gittuf.UndoTag(tagName, previousID, err)
+	}
+
+	// We always want to explicitly return nil and pass errors to UndoTag
+	return nil
+}
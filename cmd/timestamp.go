@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/adityasaky/gittuf/gittuf"
+	"github.com/spf13/cobra"
+)
+
+var timestampCmd = &cobra.Command{
+	Use:   "timestamp",
+	Short: "Manage the timestamp of the gittuf state",
+}
+
+var timestampRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Sign a new timestamp for the current state",
+	Long: `Sign a new timestamp for the current state and write it to
+refs/gittuf/timestamp. The timestamp has a short expiry and is typically
+refreshed periodically by the server hosting the repository, so that clients
+can tell a stale state from a repository that has not changed.`,
+	RunE: runTimestampRefresh,
+}
+
+var timestampExpires string
+
+func init() {
+	timestampRefreshCmd.Flags().StringArrayVarP(
+		&signingKeys,
+		"timestamp-key",
+		"",
+		[]string{},
+		"Signing key for timestamp metadata, either a path or one of ssh-agent:, gpg:, openpgp:, or pkcs11:",
+	)
+
+	timestampRefreshCmd.Flags().StringVarP(
+		&timestampExpires,
+		"expires",
+		"",
+		"1d",
+		"Expiry for timestamp metadata, such as 1d or 6h",
+	)
+
+	timestampCmd.AddCommand(timestampRefreshCmd)
+	rootCmd.AddCommand(timestampCmd)
+}
+
+func runTimestampRefresh(cmd *cobra.Command, args []string) error {
+	if len(signingKeys) == 0 {
+		return fmt.Errorf("at least one timestamp key must be specified")
+	}
+
+	validity, err := parseDuration(timestampExpires)
+	if err != nil {
+		return err
+	}
+
+	store, err := getGitStore()
+	if err != nil {
+		return err
+	}
+
+	signers, err := loadSigners(signingKeys)
+	if err != nil {
+		return err
+	}
+	defer gittuf.CloseSigners(signers)
+
+	timestampMb, err := gittuf.RefreshTimestamp(store, signers, time.Now().Add(validity).UTC().Round(time.Second))
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.Marshal(timestampMb)
+	if err != nil {
+		return err
+	}
+	return store.WriteTimestamp(contents)
+}
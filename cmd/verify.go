@@ -37,7 +37,7 @@ func runVerifyState(cmd *cobra.Command, args []string) {
 	if err != nil {
 		fmt.Println("Error:", err)
 	}
-	err = gittuf.VerifyState(store, args[0])
+	err = gittuf.VerifyState(store, args[0], allowExpired)
 	if err != nil {
 		fmt.Println("Error:", err)
 	} else {
@@ -46,7 +46,12 @@ func runVerifyState(cmd *cobra.Command, args []string) {
 }
 
 func runVerifyTrustedStates(cmd *cobra.Command, args []string) {
-	err := gittuf.VerifyTrustedStates(args[0], args[1], args[2])
+	store, err := getGitStore()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	err = gittuf.VerifyTrustedStates(store, args[0], args[1], args[2])
 	if err != nil {
 		fmt.Println("Error:", err)
 	} else {
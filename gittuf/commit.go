@@ -2,30 +2,29 @@ package gittuf
 
 import (
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/adityasaky/gittuf/internal/gitstore"
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/sirupsen/logrus"
 	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
 )
 
-func Commit(state *gitstore.State, branchName string, keys []tufdata.PrivateKey, expires time.Time, gitArgs ...string) (tufdata.Signed, string, error) {
+func Commit(state *gitstore.State, branchName string, signers []tufkeys.Signer, expires time.Time, gitArgs ...string) (tufdata.Signed, string, error) {
 	// TODO: Should `commit` check for updated metadata on a remote?
 
 	// TODO: do we need URI IDs for targetName?
 	targetName, _ := CreateGitTarget(branchName, GitBranchRef) // we're passing in BranchRef explicitly, we can skip the error check
+	roleName, _ := GetRoleNameForTarget(targetName)
 
-	keyIDsToUse := []string{}
-	for _, k := range keys {
-		pubKey, err := GetEd25519PublicKeyFromPrivateKey(&k)
-		if err != nil {
-			return tufdata.Signed{}, "", err
-		}
-		keyIDsToUse = append(keyIDsToUse, pubKey.IDs()...)
+	keyIDsToUse := getKeyIDsForSigners(signers)
+	validations, err := verifyStagedChanges(state, keyIDsToUse)
+	if err != nil {
+		return tufdata.Signed{}, "", err
 	}
-	err := verifyStagedFilesCanBeModified(state, keyIDsToUse)
+
+	roleSigners, err := getBranchSigners(state, roleName, targetName, signers, validations)
 	if err != nil {
 		return tufdata.Signed{}, "", err
 	}
@@ -37,19 +36,69 @@ func Commit(state *gitstore.State, branchName string, keys []tufdata.PrivateKey,
 		return tufdata.Signed{}, "", err
 	}
 
-	var targetsRole *tufdata.Targets
-	if state.HasFile(branchName) {
-		keys, threshold, err := ExpectedSignersForTarget(state, targetName)
+	signedRoleMb, err := recordBranchCommit(state, roleName, targetName, commitID, roleSigners, expires)
+	if err != nil {
+		return tufdata.Signed{}, "", UndoLastCommit(err)
+	}
+
+	return signedRoleMb, targetName, nil
+}
+
+/*
+getBranchSigners checks that the signers are authorized to update the branch
+and returns the signers for the branch's role. The branch itself may be
+protected by a rule, including rules for ref patterns such as
+git:branch=release/*. Besides the signers authorized by that rule, the role is
+signed by the signers authorized by the rules that allowed the changes, as the
+role's signatures are what authorize the changes when they are verified.
+*/
+func getBranchSigners(state *gitstore.State, roleName string, targetName string, signers []tufkeys.Signer, validations []*RuleValidation) ([]tufkeys.Signer, error) {
+	operation := OperationModify
+	if !state.HasFile(roleName) {
+		operation = OperationCreate
+	}
+	validation, err := validateRule(state, targetName, []string{operation}, getKeyIDsForSigners(signers))
+	if err != nil {
+		return []tufkeys.Signer{}, err
+	}
+	roleSigners, err := getSignersForRule(state, targetName, validation.AuthorizedBy, signers)
+	if err != nil {
+		return []tufkeys.Signer{}, err
+	}
+
+	used := map[string]bool{}
+	for _, signer := range roleSigners {
+		used[signer.PublicData().IDs()[0]] = true
+	}
+	consulted := map[string]bool{validation.AuthorizedBy: true}
+	for _, v := range validations {
+		if consulted[v.AuthorizedBy] {
+			continue
+		}
+		consulted[v.AuthorizedBy] = true
+		changeSigners, err := getSignersForRule(state, v.Path, v.AuthorizedBy, signers)
 		if err != nil {
-			return tufdata.Signed{}, "", err
+			return []tufkeys.Signer{}, err
 		}
-		if threshold == 0 {
-			targetsRole, err = loadSpecificTargetsWithoutVerification(state, branchName)
-		} else {
-			targetsRole, err = loadSpecificTargets(state, branchName, keys, threshold)
+		for _, signer := range changeSigners {
+			if keyID := signer.PublicData().IDs()[0]; !used[keyID] {
+				used[keyID] = true
+				roleSigners = append(roleSigners, signer)
+			}
 		}
+	}
+	return roleSigners, nil
+}
+
+// recordBranchCommit records the commit as the tip of the branch in the role
+// recording the branch, and returns the signed role.
+func recordBranchCommit(state *gitstore.State, roleName string, targetName string, commitID tufdata.HexBytes, roleSigners []tufkeys.Signer, expires time.Time) (tufdata.Signed, error) {
+	var targetsRole *tufdata.Targets
+	if state.HasFile(roleName) {
+		var err error
+		targetsRole, err = loadRoleForTarget(state, roleName, targetName)
 		if err != nil {
-			return tufdata.Signed{}, "", UndoLastCommit(err)
+			return tufdata.Signed{}, err
 		}
 	} else {
 		targetsRole = tufdata.NewTargets()
@@ -71,49 +120,20 @@ func Commit(state *gitstore.State, branchName string, keys []tufdata.PrivateKey,
 	// Update expiry
 	targetsRole.Expires = expires
 
-	signedRoleMb, err := generateAndSignMbFromStruct(targetsRole, keys)
-	if err != nil {
-		return tufdata.Signed{}, "", UndoLastCommit(err)
-	}
-
-	return signedRoleMb, targetName, nil
+	return generateAndSignMbFromStruct(targetsRole, roleSigners)
 }
 
-func verifyStagedFilesCanBeModified(state *gitstore.State, keyIDs []string) error {
-	mainRepo, err := GetRepoHandler()
-	if err != nil {
-		return err
-	}
-
-	worktree, err := mainRepo.Worktree()
-	if err != nil {
-		return err
-	}
-	worktreeStatus, err := worktree.Status()
+// verifyStagedChanges checks that the keys are authorized to make every
+// staged change, including creating, deleting, renaming and copying files,
+// changing file modes, and changing symlinks and submodules. It returns the
+// validation of each path changed.
+func verifyStagedChanges(state *gitstore.State, keyIDs []string) ([]*RuleValidation, error) {
+	changes, err := getStagedChanges()
 	if err != nil {
-		return err
+		return []*RuleValidation{}, err
 	}
-
-	changes := []*object.Change{}
-
-	for path, status := range worktreeStatus {
-		logrus.Debugf("Checking if %s can be modified", path)
-		if status.Staging == git.Modified {
-			to := path
-			if len(status.Extra) > 0 {
-				to = status.Extra
-			}
-			changes = append(changes, &object.Change{
-				// The other fields in ChangeEntry are never used.
-				// We should reconsider the signature of validateChanges.
-				From: object.ChangeEntry{
-					Name: path,
-				},
-				To: object.ChangeEntry{
-					Name: to,
-				},
-			})
-		}
+	for _, c := range changes {
+		logrus.Debugf("Checking if %s of %s can be staged", strings.Join(c.operations(), ", "), strings.Join(c.paths(), ", "))
 	}
 
 	return validateChanges(state, changes, keyIDs)
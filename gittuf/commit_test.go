@@ -0,0 +1,78 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func TestCommitChangeAuthorizedByOtherRule(t *testing.T) {
+	alice, carol := newTestSigner(t), newTestSigner(t)
+	targetsSigner := newTestSigner(t)
+	store, dir := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+	chdirTest(t, dir)
+	state := store.State()
+	expires := time.Now().AddDate(0, 0, 1)
+
+	// Alice may update main, but only carol may change src/*
+	addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-main", 1, false, []string{"git:branch=main"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+	addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-src", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{carol}))
+
+	writeTestFile(t, dir, "other", "other\n")
+	runGit(t, dir, "add", "other")
+	roleMb, target, err := Commit(state, "main", []tufkeys.Signer{alice}, expires, "-q", "-m", "initial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageTestRefRole(t, state, target, roleMb)
+	stateA := state.Tip()
+
+	writeTestFile(t, dir, "src/a", "a\n")
+	runGit(t, dir, "add", "src/a")
+	if _, _, err := Commit(state, "main", []tufkeys.Signer{alice}, expires, "-q", "-m", "src"); err == nil || !strings.Contains(err.Error(), "unauthorized create of file src/a") {
+		t.Fatalf("expected change to src/a without carol's key to be rejected, got %v", err)
+	}
+
+	roleMb, target, err = Commit(state, "main", []tufkeys.Signer{alice, carol}, expires, "-q", "-m", "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSignedBy(roleMb, carol) {
+		t.Error("expected branch role to be signed by carol, who authorized the change to src/a")
+	}
+	stageTestRefRole(t, state, target, roleMb)
+
+	if err := VerifyTrustedStates(store, target, stateA, state.Tip()); err != nil {
+		t.Errorf("expected change to src/a to be verified, got %v", err)
+	}
+
+	// Resigning the branch role keeps the signature of the key that authorized
+	// the change
+	updated, err := ResignRoles(state, []string{"branch/main"}, []tufkeys.Signer{alice, carol}, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resignedMb tufdata.Signed
+	if err := json.Unmarshal(updated["branch/main"], &resignedMb); err != nil {
+		t.Fatal(err)
+	}
+	if !isSignedBy(resignedMb, alice) || !isSignedBy(resignedMb, carol) {
+		t.Error("expected resigned branch role to be signed by alice and carol")
+	}
+}
+
+func isSignedBy(mb tufdata.Signed, signer tufkeys.Signer) bool {
+	keyIDs := signer.PublicData().IDs()
+	for _, signature := range mb.Signatures {
+		for _, keyID := range keyIDs {
+			if signature.KeyID == keyID {
+				return true
+			}
+		}
+	}
+	return false
+}
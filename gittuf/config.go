@@ -6,7 +6,7 @@ import (
 	"os"
 	"path"
 
-	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
 )
 
 var ConfigPaths = []string{
@@ -19,7 +19,7 @@ type GitTUFConfigFile struct {
 }
 
 type GitTUFConfig struct {
-	PrivateKey tufdata.PrivateKey
+	Signer tufkeys.Signer
 }
 
 func FindConfigPath() (string, error) {
@@ -48,10 +48,10 @@ func ReadConfig(path string) (*GitTUFConfig, error) {
 		return &GitTUFConfig{}, err
 	}
 
-	key, err := LoadEd25519PrivateKeyFromSslib(c.SigningKey)
+	signer, err := LoadSigner(c.SigningKey)
 	if err != nil {
 		return &GitTUFConfig{}, err
 	}
 
-	return &GitTUFConfig{PrivateKey: key}, nil
+	return &GitTUFConfig{Signer: signer}, nil
 }
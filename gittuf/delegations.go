@@ -0,0 +1,250 @@
+package gittuf
+
+import (
+	"fmt"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+)
+
+/*
+delegatedRule is a rule found in the delegations tree. Rules are delegated by
+the top level targets role or by another rule, in which case the delegating
+rule has its own metadata holding the delegations, signed by its keys. A rule
+without operations authorizes every operation.
+*/
+type delegatedRule struct {
+	Parent     string
+	Delegation tufdata.DelegatedRole
+	Keys       map[string]*tufdata.PublicKey
+	Operations []string
+}
+
+func newDelegatedRule(parent string, delegations *tufdata.Delegations, operations map[string][]string, delegation tufdata.DelegatedRole) *delegatedRule {
+	keys := map[string]*tufdata.PublicKey{}
+	for _, keyID := range delegation.KeyIDs {
+		if key, ok := delegations.Keys[keyID]; ok {
+			keys[keyID] = key
+		}
+	}
+	return &delegatedRule{
+		Parent:     parent,
+		Delegation: delegation,
+		Keys:       keys,
+		Operations: operations[delegation.Name],
+	}
+}
+
+// isAllowRule reports whether the rule is the catch all rule, which places no
+// restrictions on who can sign.
+func (r *delegatedRule) isAllowRule() bool {
+	return r.Delegation.Name == AllowRule
+}
+
+/*
+loadRuleDelegations returns the delegations made by the rule. The rule's
+metadata is verified using the keys and threshold its parent delegated to it.
+Rules without metadata make no further delegations. If the rule delegates to
+hash bins, only the bin for the target is returned, or every bin if the
+target is empty. The operations of the delegated rules are also returned.
+*/
+func loadRuleDelegations(state *gitstore.State, rule *delegatedRule, target string) (*tufdata.Delegations, map[string][]string, error) {
+	if rule.isAllowRule() || !state.HasFile(rule.Delegation.Name) {
+		return nil, nil, nil
+	}
+	role, err := loadSpecificTargets(state, rule.Delegation.Name, rule.Keys, rule.Delegation.Threshold)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to verify metadata for rule %s: %w", rule.Delegation.Name, err)
+	}
+	operations, err := getRuleOperations(role)
+	if err != nil {
+		return nil, nil, err
+	}
+	delegations, err := expandDelegations(role, target)
+	return delegations, operations, err
+}
+
+/*
+getRulesForTarget walks the delegations tree in pre-order, the way TUF
+searches for a target, and returns every rule whose paths match the target in
+the order they were visited. A rule's own delegations are visited before its
+siblings. The walk ends after the subtree of a terminating rule, or at the
+allow rule.
+*/
+func getRulesForTarget(state *gitstore.State, target string) ([]*delegatedRule, error) {
+	return walkRulesForTarget(state, target, nil)
+}
+
+// walkRulesForTarget implements getRulesForTarget. If visit is set, it is
+// called for every rule the walk considers, whether or not it matches.
+func walkRulesForTarget(state *gitstore.State, target string, visit func(rule *delegatedRule, matched bool)) ([]*delegatedRule, error) {
+	topLevelTargets, err := loadTopLevelTargets(state)
+	if err != nil {
+		return []*delegatedRule{}, err
+	}
+
+	rules := []*delegatedRule{}
+	visited := map[string]bool{}
+	targetHash := tufdata.PathHexDigest(target)
+
+	var walk func(parent string, delegations *tufdata.Delegations, operations map[string][]string) (bool, error)
+	walk = func(parent string, delegations *tufdata.Delegations, operations map[string][]string) (bool, error) {
+		if delegations == nil {
+			return false, nil
+		}
+		for _, d := range delegations.Roles {
+			rule := newDelegatedRule(parent, delegations, operations, d)
+			if rule.isAllowRule() {
+				if visit != nil {
+					visit(rule, true)
+				}
+				rules = append(rules, rule)
+				return true, nil
+			}
+			if d.Threshold < 1 {
+				return false, fmt.Errorf("rule %s has invalid threshold %d", d.Name, d.Threshold)
+			}
+
+			matches, err := matchesTarget(d, target, targetHash)
+			if err != nil {
+				return false, err
+			}
+			if visit != nil {
+				visit(rule, matches)
+			}
+			if !matches {
+				continue
+			}
+			if visited[d.Name] {
+				return false, fmt.Errorf("rule %s is delegated more than once", d.Name)
+			}
+			visited[d.Name] = true
+			rules = append(rules, rule)
+
+			childDelegations, childOperations, err := loadRuleDelegations(state, rule, target)
+			if err != nil {
+				return false, err
+			}
+			stop, err := walk(d.Name, childDelegations, childOperations)
+			if err != nil {
+				return false, err
+			}
+			if stop || d.Terminating {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	topLevelOperations, err := getRuleOperations(topLevelTargets)
+	if err != nil {
+		return []*delegatedRule{}, err
+	}
+	if _, err := walk("targets", topLevelTargets.Delegations, topLevelOperations); err != nil {
+		return []*delegatedRule{}, err
+	}
+	return rules, nil
+}
+
+/*
+getCandidateRules returns the rules that may authorize a change to the target,
+in the order they must be consulted. Rules that delegate the target further
+are skipped in favour of the rules they delegate to. The allow rule is only
+returned if no other rule matches the target.
+*/
+func getCandidateRules(state *gitstore.State, target string) ([]*delegatedRule, error) {
+	rules, err := getRulesForTarget(state, target)
+	if err != nil {
+		return []*delegatedRule{}, err
+	}
+	return selectCandidateRules(rules, target)
+}
+
+// selectCandidateRules returns the candidates for getCandidateRules from the
+// rules matching the target.
+func selectCandidateRules(rules []*delegatedRule, target string) ([]*delegatedRule, error) {
+	if len(rules) == 1 && rules[0].isAllowRule() {
+		return rules, nil
+	}
+
+	candidates := []*delegatedRule{}
+	for i, rule := range rules {
+		if rule.isAllowRule() {
+			continue
+		}
+		if i+1 < len(rules) && rules[i+1].Parent == rule.Delegation.Name {
+			continue
+		}
+		candidates = append(candidates, rule)
+	}
+	if len(candidates) == 0 {
+		return []*delegatedRule{}, fmt.Errorf("no rule found for target %s", target)
+	}
+	return candidates, nil
+}
+
+// getAllRules returns every rule in the delegations tree in pre-order.
+func getAllRules(state *gitstore.State) ([]*delegatedRule, error) {
+	topLevelTargets, err := loadTopLevelTargets(state)
+	if err != nil {
+		return []*delegatedRule{}, err
+	}
+
+	rules := []*delegatedRule{}
+	visited := map[string]bool{}
+
+	var walk func(parent string, delegations *tufdata.Delegations, operations map[string][]string) error
+	walk = func(parent string, delegations *tufdata.Delegations, operations map[string][]string) error {
+		if delegations == nil {
+			return nil
+		}
+		for _, d := range delegations.Roles {
+			rule := newDelegatedRule(parent, delegations, operations, d)
+			if rule.isAllowRule() {
+				rules = append(rules, rule)
+				continue
+			}
+			if d.Threshold < 1 {
+				return fmt.Errorf("rule %s has invalid threshold %d", d.Name, d.Threshold)
+			}
+			if visited[d.Name] {
+				return fmt.Errorf("rule %s is delegated more than once", d.Name)
+			}
+			visited[d.Name] = true
+			rules = append(rules, rule)
+
+			childDelegations, childOperations, err := loadRuleDelegations(state, rule, "")
+			if err != nil {
+				return err
+			}
+			if err := walk(d.Name, childDelegations, childOperations); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	topLevelOperations, err := getRuleOperations(topLevelTargets)
+	if err != nil {
+		return []*delegatedRule{}, err
+	}
+	if err := walk("targets", topLevelTargets.Delegations, topLevelOperations); err != nil {
+		return []*delegatedRule{}, err
+	}
+	return rules, nil
+}
+
+// findRule returns the rule with the specified name from the delegations
+// tree.
+func findRule(state *gitstore.State, ruleName string) (*delegatedRule, error) {
+	rules, err := getAllRules(state)
+	if err != nil {
+		return &delegatedRule{}, err
+	}
+	for _, rule := range rules {
+		if rule.Delegation.Name == ruleName {
+			return rule, nil
+		}
+	}
+	return &delegatedRule{}, fmt.Errorf("rule %s not found", ruleName)
+}
@@ -0,0 +1,52 @@
+package gittuf
+
+import (
+	"reflect"
+	"testing"
+
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func TestExpectedSignersForTarget(t *testing.T) {
+	rootSigner, targetsSigner := newTestSigner(t), newTestSigner(t)
+	first, second, third, nested := newTestSigner(t), newTestSigner(t), newTestSigner(t), newTestSigner(t)
+
+	tests := []struct {
+		name              string
+		secondTerminating bool
+		nestedTerminating bool
+		target            string
+		expected          []string
+	}{
+		{name: "all matching rules in order", target: "src/b", expected: []string{"first", "second", "third"}},
+		{name: "stop at terminating rule", secondTerminating: true, target: "src/b", expected: []string{"first", "second"}},
+		{name: "delegated rule replaces its parent", target: "src/a", expected: []string{"nested", "second", "third"}},
+		{name: "stop at terminating delegated rule", nestedTerminating: true, target: "src/a", expected: []string{"nested"}},
+		{name: "delegated rule not matching", nestedTerminating: true, target: "src/b", expected: []string{"first", "second", "third"}},
+		{name: "only paths of matching rules", target: "docs/a", expected: []string{"third"}},
+		{name: "allow rule when no rule matches", target: "other", expected: []string{AllowRule}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, _ := newTestStore(t, []tufkeys.Signer{rootSigner}, []tufkeys.Signer{targetsSigner})
+			state := store.State()
+			targetsSigners := []tufkeys.Signer{targetsSigner}
+			addTestRule(t, state, targetsSigners, "targets", "first", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{first}))
+			addTestRule(t, state, targetsSigners, "targets", "second", 1, test.secondTerminating, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{second}))
+			addTestRule(t, state, targetsSigners, "targets", "third", 1, false, []string{"src/*", "docs/*"}, nil, publicKeysForSigners([]tufkeys.Signer{third}))
+			addTestRule(t, state, []tufkeys.Signer{first}, "first", "nested", 1, test.nestedTerminating, []string{"src/a"}, nil, publicKeysForSigners([]tufkeys.Signer{nested}))
+
+			expected, err := ExpectedSignersForTarget(state, test.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rules := []string{}
+			for _, e := range expected {
+				rules = append(rules, e.Rule)
+			}
+			if !reflect.DeepEqual(rules, test.expected) {
+				t.Errorf("expected rules %v, got %v", test.expected, rules)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package gittuf
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/sirupsen/logrus"
+)
+
+// RoleExpiry records when the metadata of a role expires.
+type RoleExpiry struct {
+	Role    string
+	Version int64
+	Expires time.Time
+}
+
+// checkExpiry returns an error if the metadata for the role has expired, unless
+// expired metadata is allowed, in which case a warning is logged.
+func checkExpiry(roleName string, expires time.Time, allowExpired bool) error {
+	if time.Now().Before(expires) {
+		return nil
+	}
+	if allowExpired {
+		logrus.Warnf("Metadata for role %s expired at %s", roleName, expires.Format(time.RFC3339))
+		return nil
+	}
+	return fmt.Errorf("metadata for role %s expired at %s, use --allow-expired to verify it regardless", roleName, expires.Format(time.RFC3339))
+}
+
+/*
+verifyExpiry checks that no role in the state that is used to verify the
+target has expired. This applies to every role except those recording other
+branches and tags. Expiry is only enforced for the newest state being trusted,
+as the states before it, including the last trusted state, are expected to
+have expired over time. Setting allowExpired only logs a warning for each
+expired role, which is meant for audits.
+*/
+func verifyExpiry(state *gitstore.State, target string, allowExpired bool) error {
+	expiries, err := GetRoleExpiries(state)
+	if err != nil {
+		return err
+	}
+	for _, e := range expiries {
+		if refTarget, ok := getTargetForRoleName(e.Role); ok && refTarget != target {
+			continue
+		}
+		if err := checkExpiry(e.Role, e.Expires, allowExpired); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+GetRoleExpiries returns the version and expiry of every role in the state,
+ordered by expiry. The metadata's signatures are not verified.
+*/
+func GetRoleExpiries(state *gitstore.State) ([]RoleExpiry, error) {
+	metadata, err := state.GetAllCurrentMetadata()
+	if err != nil {
+		return []RoleExpiry{}, err
+	}
+
+	expiries := []RoleExpiry{}
+	for roleName, contents := range metadata {
+		var role struct {
+			Version int64     `json:"version"`
+			Expires time.Time `json:"expires"`
+		}
+		if err := unmarshalSignedRole(contents, &role); err != nil {
+			return []RoleExpiry{}, fmt.Errorf("unable to read metadata for role %s: %w", roleName, err)
+		}
+		expiries = append(expiries, RoleExpiry{
+			Role:    roleName,
+			Version: role.Version,
+			Expires: role.Expires,
+		})
+	}
+
+	sort.Slice(expiries, func(i, j int) bool {
+		if expiries[i].Expires.Equal(expiries[j].Expires) {
+			return expiries[i].Role < expiries[j].Role
+		}
+		return expiries[i].Expires.Before(expiries[j].Expires)
+	})
+
+	return expiries, nil
+}
+
+/*
+GetRolesExpiringWithin returns the roles in the state that have expired or
+will expire within the window.
+*/
+func GetRolesExpiringWithin(state *gitstore.State, window time.Duration) ([]RoleExpiry, error) {
+	expiries, err := GetRoleExpiries(state)
+	if err != nil {
+		return []RoleExpiry{}, err
+	}
+
+	deadline := time.Now().Add(window)
+	expiring := []RoleExpiry{}
+	for _, e := range expiries {
+		if !e.Expires.After(deadline) {
+			expiring = append(expiring, e)
+		}
+	}
+	return expiring, nil
+}
@@ -0,0 +1,113 @@
+package gittuf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// commitTestFile commits a change to the file on the branch and stages the
+// branch's role, returning the branch's target.
+func commitTestFile(t *testing.T, state *gitstore.State, dir string, branchName string, path string, signers []tufkeys.Signer, expires time.Time) string {
+	t.Helper()
+	runGit(t, dir, "checkout", "-q", "-B", branchName)
+	writeTestFile(t, dir, path, expires.String()+"\n")
+	runGit(t, dir, "add", path)
+	roleMb, target, err := Commit(state, branchName, signers, expires, "-q", "-m", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageTestRefRole(t, state, target, roleMb)
+	return target
+}
+
+func TestTrustStateExpiry(t *testing.T) {
+	alice := newTestSigner(t)
+	targetsSigner := newTestSigner(t)
+	expired := time.Now().Add(-time.Hour)
+	expires := time.Now().AddDate(0, 0, 1)
+
+	newRepository := func(t *testing.T) (*gitstore.GitStore, *gitstore.State, string) {
+		store, dir := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+		chdirTest(t, dir)
+		return store, store.State(), dir
+	}
+
+	t.Run("expired role for branch covered by allow rule", func(t *testing.T) {
+		store, state, dir := newRepository(t)
+		target := commitTestFile(t, state, dir, "main", "a", []tufkeys.Signer{alice}, expired)
+
+		if err := TrustState(store, target, state, false); err == nil || !strings.Contains(err.Error(), "metadata for role branch/main expired") {
+			t.Fatalf("expected expired branch role to be rejected, got %v", err)
+		}
+		if err := TrustState(store, target, state, true); err != nil {
+			t.Fatalf("expected expired branch role to be allowed, got %v", err)
+		}
+		if err := VerifyState(store, target, false); err == nil || !strings.Contains(err.Error(), "metadata for role branch/main expired") {
+			t.Errorf("expected expired branch role to fail verification, got %v", err)
+		}
+	})
+
+	t.Run("expired rules", func(t *testing.T) {
+		store, state, dir := newRepository(t)
+		addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-src", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+		updated, err := ResignRoles(state, []string{"targets"}, []tufkeys.Signer{targetsSigner}, expired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := state.StageMetadataAndCommit("targets", updated["targets"], testSnapshotter()); err != nil {
+			t.Fatal(err)
+		}
+		target := commitTestFile(t, state, dir, "main", "src/a", []tufkeys.Signer{alice}, expires)
+
+		if err := TrustState(store, target, state, false); err == nil || !strings.Contains(err.Error(), "metadata for role targets expired") {
+			t.Fatalf("expected expired rules to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("expired last trusted state", func(t *testing.T) {
+		store, state, dir := newRepository(t)
+		target := commitTestFile(t, state, dir, "main", "a", []tufkeys.Signer{alice}, expired)
+		if err := TrustState(store, target, state, true); err != nil {
+			t.Fatal(err)
+		}
+		stateA := state.Tip()
+
+		// Only the newest state must not have expired
+		commitTestFile(t, state, dir, "main", "a", []tufkeys.Signer{alice}, expires)
+		if err := VerifyTrustedStates(store, target, stateA, state.Tip()); err != nil {
+			t.Fatalf("expected states to be verified, got %v", err)
+		}
+		if err := TrustState(store, target, state, false); err != nil {
+			t.Errorf("expected newest state to be trusted, got %v", err)
+		}
+	})
+
+	t.Run("expired role for other branch", func(t *testing.T) {
+		store, state, dir := newRepository(t)
+		commitTestFile(t, state, dir, "feature", "b", []tufkeys.Signer{alice}, expired)
+		target := commitTestFile(t, state, dir, "main", "a", []tufkeys.Signer{alice}, expires)
+
+		if err := TrustState(store, target, state, false); err != nil {
+			t.Errorf("expected expired role for another branch to be ignored, got %v", err)
+		}
+	})
+
+	t.Run("resign expired role", func(t *testing.T) {
+		store, state, dir := newRepository(t)
+		target := commitTestFile(t, state, dir, "main", "a", []tufkeys.Signer{alice}, expired)
+		updated, err := ResignRoles(state, []string{"branch/main"}, []tufkeys.Signer{alice}, expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := state.StageMetadataAndCommit("branch/main", updated["branch/main"], testSnapshotter()); err != nil {
+			t.Fatal(err)
+		}
+		if err := TrustState(store, target, state, false); err != nil {
+			t.Errorf("expected resigned role to be trusted, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package gittuf
+
+import (
+	"strings"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+)
+
+// TargetExplanation describes how the rules protecting a target are found.
+type TargetExplanation struct {
+	Target    string             `json:"target"`
+	State     string             `json:"state"`
+	Rules     []*RuleExplanation `json:"rules"`
+	Consulted []string           `json:"consulted"`
+}
+
+/*
+RuleExplanation describes a rule considered while searching for the rules
+protecting a target. Consulted is set for the rules whose keys can authorize
+changes to the target, as opposed to rules that only delegate it further. A
+rule without operations authorizes every operation.
+*/
+type RuleExplanation struct {
+	Rule             string          `json:"rule"`
+	Parent           string          `json:"parent"`
+	Paths            []string        `json:"paths,omitempty"`
+	PathHashPrefixes []string        `json:"path_hash_prefixes,omitempty"`
+	Matched          bool            `json:"matched"`
+	Consulted        bool            `json:"consulted"`
+	Keys             []*ExplainedKey `json:"keys"`
+	Threshold        int             `json:"threshold"`
+	Terminating      bool            `json:"terminating"`
+	Operations       []string        `json:"operations,omitempty"`
+}
+
+// ExplainedKey is a key authorized by a rule, with the name of its principal
+// if known.
+type ExplainedKey struct {
+	KeyID     string `json:"keyid"`
+	Principal string `json:"principal,omitempty"`
+}
+
+/*
+ExplainTarget walks the delegations for the target the same way change
+validation does, and records every rule it considers. The target is a path,
+a Git target, or a full ref name such as refs/heads/main. Principal names
+maps key IDs to names for display and may be empty.
+*/
+func ExplainTarget(state *gitstore.State, target string, principalNames map[string]string) (*TargetExplanation, error) {
+	if strings.HasPrefix(target, "refs/") {
+		gitTarget, err := refToGitTarget(target)
+		if err != nil {
+			return &TargetExplanation{}, err
+		}
+		target = gitTarget
+	}
+
+	explanation := &TargetExplanation{
+		Target:    target,
+		State:     state.Tip(),
+		Rules:     []*RuleExplanation{},
+		Consulted: []string{},
+	}
+	explained := map[string]*RuleExplanation{}
+
+	rules, err := walkRulesForTarget(state, target, func(rule *delegatedRule, matched bool) {
+		r := &RuleExplanation{
+			Rule:             rule.Delegation.Name,
+			Parent:           rule.Parent,
+			Paths:            rule.Delegation.Paths,
+			PathHashPrefixes: rule.Delegation.PathHashPrefixes,
+			Matched:          matched,
+			Keys:             []*ExplainedKey{},
+			Threshold:        rule.Delegation.Threshold,
+			Terminating:      rule.Delegation.Terminating,
+			Operations:       rule.Operations,
+		}
+		if !rule.isAllowRule() {
+			for _, keyID := range rule.Delegation.KeyIDs {
+				r.Keys = append(r.Keys, &ExplainedKey{KeyID: keyID, Principal: principalNames[keyID]})
+			}
+		}
+		explanation.Rules = append(explanation.Rules, r)
+		explained[r.Rule] = r
+	})
+	if err != nil {
+		return &TargetExplanation{}, err
+	}
+
+	candidates, err := selectCandidateRules(rules, target)
+	if err != nil {
+		return &TargetExplanation{}, err
+	}
+	for _, rule := range candidates {
+		explained[rule.Delegation.Name].Consulted = true
+		explanation.Consulted = append(explanation.Consulted, rule.Delegation.Name)
+	}
+
+	return explanation, nil
+}
@@ -0,0 +1,100 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func TestExplainTarget(t *testing.T) {
+	targetsSigner, alice, bob, carol := newTestSigner(t), newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	store := newTestRuleStore(t, targetsSigner, alice, bob, carol)
+	state := store.State()
+	addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-main", 1, true, []string{"git:branch=main"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+	principalNames := map[string]string{alice.PublicData().IDs()[0]: "alice"}
+
+	tests := []struct {
+		target    string
+		gitTarget string
+		matched   []string
+		consulted []string
+	}{
+		{target: "src/a", gitTarget: "src/a", matched: []string{"first", "nested", AllowRule}, consulted: []string{"nested"}},
+		{target: "src/b", gitTarget: "src/b", matched: []string{"first", AllowRule}, consulted: []string{"first"}},
+		{target: "docs/a", gitTarget: "docs/a", matched: []string{"second", AllowRule}, consulted: []string{"second"}},
+		{target: "refs/heads/main", gitTarget: "git:branch=main", matched: []string{"protect-main"}, consulted: []string{"protect-main"}},
+		{target: "other", gitTarget: "other", matched: []string{AllowRule}, consulted: []string{AllowRule}},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			explanation, err := ExplainTarget(state, test.target, principalNames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if explanation.Target != test.gitTarget || explanation.State != state.Tip() {
+				t.Errorf("expected explanation of %s in state %s, got %s in state %s", test.gitTarget, state.Tip(), explanation.Target, explanation.State)
+			}
+
+			matched := []string{}
+			for _, r := range explanation.Rules {
+				if r.Matched {
+					matched = append(matched, r.Rule)
+				}
+				if r.Consulted != containsString(explanation.Consulted, r.Rule) {
+					t.Errorf("expected rule %s to be consulted only if listed in %v", r.Rule, explanation.Consulted)
+				}
+			}
+			if !reflect.DeepEqual(matched, test.matched) {
+				t.Errorf("expected matched rules %v, got %v", test.matched, matched)
+			}
+			if !reflect.DeepEqual(explanation.Consulted, test.consulted) {
+				t.Errorf("expected consulted rules %v, got %v", test.consulted, explanation.Consulted)
+			}
+
+			// The consulted rules are those validation uses
+			expected, err := ExpectedSignersForTarget(state, test.gitTarget)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectedRules := []string{}
+			for _, e := range expected {
+				expectedRules = append(expectedRules, e.Rule)
+			}
+			if !reflect.DeepEqual(explanation.Consulted, expectedRules) {
+				t.Errorf("expected consulted rules to match expected signers %v, got %v", expectedRules, explanation.Consulted)
+			}
+		})
+	}
+
+	t.Run("principal names", func(t *testing.T) {
+		explanation, err := ExplainTarget(state, "src/b", principalNames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range explanation.Rules {
+			if r.Rule != "first" {
+				continue
+			}
+			if len(r.Keys) != 1 || r.Keys[0].KeyID != alice.PublicData().IDs()[0] || r.Keys[0].Principal != "alice" {
+				t.Errorf("expected rule first to list alice's key, got %+v", r.Keys)
+			}
+		}
+
+		contents, err := json.Marshal(explanation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(contents), `"principal":"alice"`) {
+			t.Errorf("expected JSON output to name alice, got %s", contents)
+		}
+	})
+
+	t.Run("invalid ref", func(t *testing.T) {
+		if _, err := ExplainTarget(state, "refs/remotes/origin/main", nil); err == nil || !strings.Contains(err.Error(), "must start with refs/heads/ or refs/tags/") {
+			t.Errorf("expected invalid ref to be rejected, got %v", err)
+		}
+	})
+}
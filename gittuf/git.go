@@ -5,11 +5,13 @@ package gittuf
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	tufdata "github.com/theupdateframework/go-tuf/data"
 )
 
@@ -42,8 +44,7 @@ func GetRefNameForHEAD() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	branchSplit := strings.Split(headRef.Target().String(), "/")
-	return branchSplit[len(branchSplit)-1], nil
+	return headRef.Target().Short(), nil
 }
 
 func GetTipCommitIDForRef(refName string, refType int) (tufdata.HexBytes, error) {
@@ -109,9 +110,6 @@ func UndoLastCommit(cause error) error {
 			return fmt.Errorf("could not undo commit triggered due to error %w", cause)
 		}
 		return cause
-	} else if len(lastCommit.ParentHashes) > 1 {
-		// This is a merge commit
-		return fmt.Errorf("could not undo commit as it is a merge commit, triggered due to error %w", cause)
 	}
 
 	currentWorktree, err := mainRepo.Worktree()
@@ -127,9 +125,55 @@ func UndoLastCommit(cause error) error {
 		return fmt.Errorf("could not undo commit triggered due to error %w", cause)
 	}
 
+	if len(lastCommit.ParentHashes) > 1 {
+		// This is a merge commit, so the merge is left in progress as it was
+		// before the commit
+		if err := restoreMergeState(lastCommit); err != nil {
+			return fmt.Errorf("could not undo merge commit triggered due to error %w", cause)
+		}
+	}
+
 	return cause
 }
 
+/*
+restoreMergeState records the parents of the merge commit other than the first
+as the heads being merged, along with the commit's message, so that the merge
+can be committed again.
+*/
+func restoreMergeState(mergeCommit *object.Commit) error {
+	mergeHeads := []string{}
+	for _, parent := range mergeCommit.ParentHashes[1:] {
+		mergeHeads = append(mergeHeads, parent.String())
+	}
+
+	mergeHeadPath, err := getGitPath("MERGE_HEAD")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(mergeHeadPath, []byte(strings.Join(mergeHeads, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+
+	mergeMsgPath, err := getGitPath("MERGE_MSG")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(mergeMsgPath, []byte(mergeCommit.Message), 0644)
+}
+
+// getGitPath returns the path of the file in the repository's git directory.
+func getGitPath(name string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--git-path", name)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(stdout.String(), "\n"), nil
+}
+
 func convertPlumbingHashToTUFHashHexBytes(hash plumbing.Hash) tufdata.HexBytes {
 	hb := make(tufdata.HexBytes, len(hash))
 	for i := range hash {
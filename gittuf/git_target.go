@@ -2,7 +2,6 @@ package gittuf
 
 import (
 	"fmt"
-	"net/url"
 	"strings"
 )
 
@@ -28,21 +27,18 @@ func CreateGitTarget(refName string, refType int) (string, error) {
 	return "", fmt.Errorf("unknown reference type for %s", refName)
 }
 
+/*
+ParseGitTarget returns the ref name and type of a Git target. Ref names may be
+hierarchical, such as git:branch=feature/login, and rules may use glob
+patterns such as git:branch=release/* as the ref name.
+*/
 func ParseGitTarget(uri string) (string, int, error) {
-	u, err := url.Parse(uri)
-	if err != nil {
-		return "", 0, err
-	}
-	if u.Scheme != "git" {
+	if !IsValidGitTarget(uri) {
 		return "", 0, fmt.Errorf("%s is not a Git object", uri)
 	}
 
-	if len(u.Opaque) == 0 {
-		return "", 0, fmt.Errorf("invalid format for %s", uri)
-	}
-
-	split := strings.Split(u.Opaque, "=") // assuming there aren't multiple key value pairs
-	if len(split) > 2 {
+	split := strings.SplitN(strings.TrimPrefix(uri, GitTargetScheme), "=", 2)
+	if len(split) != 2 || len(split[1]) == 0 {
 		return "", 0, fmt.Errorf("invalid format for %s", uri)
 	}
 
@@ -58,3 +54,41 @@ func ParseGitTarget(uri string) (string, int, error) {
 func IsValidGitTarget(uri string) bool {
 	return strings.HasPrefix(uri, GitTargetScheme)
 }
+
+/*
+GetRoleNameForTarget returns the name of the role recording a Git target.
+Roles for refs are named after the type of the ref and the ref, such as
+branch/main and tag/v1, which keeps a branch and a tag with the same name
+apart, and keeps refs from taking the names of top level roles or rules.
+*/
+func GetRoleNameForTarget(target string) (string, error) {
+	refName, refType, err := ParseGitTarget(target)
+	if err != nil {
+		return "", err
+	}
+	switch refType {
+	case GitBranchRef:
+		return fmt.Sprintf("%s/%s", GitBranchIdentifier, refName), nil
+	case GitTagRef:
+		return fmt.Sprintf("%s/%s", GitTagIdentifier, refName), nil
+	}
+	return "", fmt.Errorf("unknown reference type for %s", target)
+}
+
+// getTargetForRoleName returns the Git target recorded by the role, and false
+// if the role does not record a ref.
+func getTargetForRoleName(roleName string) (string, bool) {
+	split := strings.SplitN(roleName, "/", 2)
+	if len(split) != 2 || len(split[1]) == 0 {
+		return "", false
+	}
+	switch split[0] {
+	case GitBranchIdentifier:
+		target, _ := CreateGitTarget(split[1], GitBranchRef)
+		return target, true
+	case GitTagIdentifier:
+		target, _ := CreateGitTarget(split[1], GitTagRef)
+		return target, true
+	}
+	return "", false
+}
@@ -0,0 +1,171 @@
+package gittuf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func TestParseGitTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		refName string
+		refType int
+		err     string
+	}{
+		{target: "git:branch=main", refName: "main", refType: GitBranchRef},
+		{target: "git:branch=feature/login", refName: "feature/login", refType: GitBranchRef},
+		{target: "git:branch=release/*", refName: "release/*", refType: GitBranchRef},
+		{target: "git:tag=v1.0.0", refName: "v1.0.0", refType: GitTagRef},
+		{target: "git:tag=releases/v1", refName: "releases/v1", refType: GitTagRef},
+		{target: "git:branch=", err: "invalid format"},
+		{target: "git:main", err: "invalid format"},
+		{target: "git:commit=main", err: "invalid Git type commit"},
+		{target: "src/a", err: "is not a Git object"},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			refName, refType, err := ParseGitTarget(test.target)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refName != test.refName || refType != test.refType {
+				t.Errorf("expected ref %s of type %d, got %s of type %d", test.refName, test.refType, refName, refType)
+			}
+		})
+	}
+}
+
+func TestGetRoleNameForTarget(t *testing.T) {
+	tests := []struct {
+		target   string
+		roleName string
+		err      bool
+	}{
+		{target: "git:branch=main", roleName: "branch/main"},
+		{target: "git:branch=feature/login", roleName: "branch/feature/login"},
+		{target: "git:branch=targets", roleName: "branch/targets"},
+		{target: "git:tag=main", roleName: "tag/main"},
+		{target: "git:tag=releases/v1", roleName: "tag/releases/v1"},
+		{target: "src/a", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			roleName, err := GetRoleNameForTarget(test.target)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected target to be rejected, got role %s", roleName)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if roleName != test.roleName {
+				t.Errorf("expected role %s, got %s", test.roleName, roleName)
+			}
+			if target, ok := getTargetForRoleName(roleName); !ok || target != test.target {
+				t.Errorf("expected role %s to record %s, got %s", roleName, test.target, target)
+			}
+		})
+	}
+
+	for _, roleName := range []string{"root", "targets", "protect-src", "branch", "branch/", "feature/login"} {
+		if target, ok := getTargetForRoleName(roleName); ok {
+			t.Errorf("expected role %s to record no ref, got %s", roleName, target)
+		}
+	}
+}
+
+func TestValidateRuleName(t *testing.T) {
+	tests := []struct {
+		ruleName string
+		err      string
+	}{
+		{ruleName: "protect-src"},
+		{ruleName: "team/backend"},
+		{ruleName: "", err: "must be specified"},
+		{ruleName: "root", err: "is reserved"},
+		{ruleName: "targets", err: "is reserved"},
+		{ruleName: "snapshot", err: "is reserved"},
+		{ruleName: "timestamp", err: "is reserved"},
+		{ruleName: AllowRule, err: "is reserved"},
+		{ruleName: "branch/main", err: "reserved for roles recording branches and tags"},
+		{ruleName: "tag/v1", err: "reserved for roles recording branches and tags"},
+	}
+	for _, test := range tests {
+		t.Run(test.ruleName, func(t *testing.T) {
+			err := validateRuleName(test.ruleName)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRefRolesKeptApart(t *testing.T) {
+	alice := newTestSigner(t)
+	store, dir := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{newTestSigner(t)})
+	chdirTest(t, dir)
+	state := store.State()
+	targetsBefore, err := state.GetCurrentMetadataBytes("targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().AddDate(0, 0, 1)
+
+	// A branch and a tag with the same name, and a branch named after a top
+	// level role, each get their own role
+	writeTestFile(t, dir, "a", "a\n")
+	runGit(t, dir, "add", "a")
+	for _, branchName := range []string{"v1", "targets", "feature/login"} {
+		runGit(t, dir, "checkout", "-q", "-B", branchName)
+		writeTestFile(t, dir, "a", branchName+"\n")
+		runGit(t, dir, "add", "a")
+		roleMb, target, err := Commit(state, branchName, []tufkeys.Signer{alice}, expires, "-q", "-m", branchName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stageTestRefRole(t, state, target, roleMb)
+	}
+	roleMb, target, err := Tag(state, "v1", []tufkeys.Signer{alice}, expires, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageTestRefRole(t, state, target, roleMb)
+
+	for _, target := range []string{"git:branch=v1", "git:branch=targets", "git:branch=feature/login", "git:tag=v1"} {
+		role, roleName, err := getTargetsRoleForTarget(state, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(role.Targets) != 1 {
+			t.Errorf("expected role %s to record only %s, got %v", roleName, target, role.Targets)
+		}
+		if _, ok := role.Targets[target]; !ok {
+			t.Errorf("expected role %s to record %s", roleName, target)
+		}
+	}
+
+	targetsAfter, err := state.GetCurrentMetadataBytes("targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(targetsBefore) != string(targetsAfter) {
+		t.Error("expected top level targets to be unchanged by a branch named targets")
+	}
+}
@@ -0,0 +1,247 @@
+package gittuf
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+	tuftargets "github.com/theupdateframework/go-tuf/pkg/targets"
+)
+
+/*
+succinctRoles describes hash bin delegations in the compact form proposed in
+TAP 15. Instead of listing every bin, a role records how many bins there are
+and the keys shared by all of them. A path is assigned to the bin indicated
+by the leading bits of the SHA-256 hash of the path, so the bin for a path is
+found without checking the paths of every bin.
+*/
+type succinctRoles struct {
+	KeyIDs     []string `json:"keyids"`
+	Threshold  int      `json:"threshold"`
+	BitLength  int      `json:"bit_length"`
+	NamePrefix string   `json:"name_prefix"`
+}
+
+/*
+targetsCustom holds the gittuf specific fields of a role's metadata. go-tuf
+does not support succinct delegations or extra fields in delegations, so they
+are recorded here. RuleOperations limits the rules the role delegates to some
+operations, keyed by rule name.
+*/
+type targetsCustom struct {
+	SuccinctRoles  *succinctRoles      `json:"succinct_roles,omitempty"`
+	RuleOperations map[string][]string `json:"rule_operations,omitempty"`
+}
+
+// numBins returns the number of bins described.
+func (s *succinctRoles) numBins() uint64 {
+	return uint64(1) << s.BitLength
+}
+
+// binName returns the name of the bin at index.
+func (s *succinctRoles) binName(index uint64) string {
+	digits := (s.BitLength + 3) / 4
+	return fmt.Sprintf("%s-%0*x", s.NamePrefix, digits, index)
+}
+
+// binForPath returns the index of the bin the path is assigned to.
+func (s *succinctRoles) binForPath(target string) (uint64, error) {
+	digest, err := hex.DecodeString(tufdata.PathHexDigest(target))
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(digest[:8]) >> (64 - s.BitLength), nil
+}
+
+// delegatedRole returns the delegation of the bin at index.
+func (s *succinctRoles) delegatedRole(index uint64) (tufdata.DelegatedRole, error) {
+	hashBins, err := tuftargets.NewHashBins("", s.BitLength)
+	if err != nil {
+		return tufdata.DelegatedRole{}, err
+	}
+	return tufdata.DelegatedRole{
+		Name:             s.binName(index),
+		KeyIDs:           s.KeyIDs,
+		Threshold:        s.Threshold,
+		PathHashPrefixes: hashBins.GetBin(index).HashPrefixes(),
+		Paths:            []string{},
+	}, nil
+}
+
+// getSuccinctRoles returns the hash bins delegated by the role, or nil if the
+// role does not delegate to hash bins.
+func getSuccinctRoles(role *tufdata.Targets) (*succinctRoles, error) {
+	if role.Custom == nil {
+		return nil, nil
+	}
+	var custom targetsCustom
+	if err := json.Unmarshal(*role.Custom, &custom); err != nil {
+		return nil, err
+	}
+	return custom.SuccinctRoles, nil
+}
+
+/*
+expandDelegations returns the delegations made by the role. If the role
+delegates to hash bins, only the bin for the target is returned, or every bin
+if the target is empty.
+*/
+func expandDelegations(role *tufdata.Targets, target string) (*tufdata.Delegations, error) {
+	bins, err := getSuccinctRoles(role)
+	if err != nil {
+		return nil, err
+	}
+	if bins == nil || role.Delegations == nil {
+		return role.Delegations, nil
+	}
+
+	delegations := &tufdata.Delegations{
+		Keys:  role.Delegations.Keys,
+		Roles: []tufdata.DelegatedRole{},
+	}
+	if len(target) > 0 {
+		index, err := bins.binForPath(target)
+		if err != nil {
+			return nil, err
+		}
+		bin, err := bins.delegatedRole(index)
+		if err != nil {
+			return nil, err
+		}
+		delegations.Roles = append(delegations.Roles, bin)
+		return delegations, nil
+	}
+
+	for i := uint64(0); i < bins.numBins(); i++ {
+		bin, err := bins.delegatedRole(i)
+		if err != nil {
+			return nil, err
+		}
+		delegations.Roles = append(delegations.Roles, bin)
+	}
+	return delegations, nil
+}
+
+// matchesTarget reports whether the delegation covers the target. The hash of
+// the target is computed once by the caller rather than for every delegation.
+func matchesTarget(delegation tufdata.DelegatedRole, target string, targetHash string) (bool, error) {
+	if len(delegation.PathHashPrefixes) == 0 {
+		return delegation.MatchesPath(target)
+	}
+	if len(delegation.Paths) > 0 {
+		return false, tufdata.ErrPathsAndPathHashesSet
+	}
+	for _, prefix := range delegation.PathHashPrefixes {
+		if strings.HasPrefix(targetHash, prefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/*
+NewHashBins returns a new version of the parent rule that delegates all of its
+paths to count hash bins, each signed by a threshold of the allowed keys. The
+bins are named after the prefix and their index in hex, and can delegate
+paths further like any other rule. The parent must be a rule that does not
+already delegate other rules.
+*/
+func NewHashBins(
+	state *gitstore.State,
+	roleSigners []tufkeys.Signer,
+	parentName string,
+	namePrefix string,
+	count int,
+	threshold int,
+	allowedKeys []*tufdata.PublicKey) (tufdata.Signed, error) {
+
+	if parentName == "targets" {
+		return tufdata.Signed{}, fmt.Errorf("hash bins must be delegated by a rule, not the top level targets role")
+	}
+	if count < 2 || bits.OnesCount(uint(count)) != 1 {
+		return tufdata.Signed{}, fmt.Errorf("number of bins must be a power of two greater than one, got %d", count)
+	}
+	bitLength := bits.TrailingZeros(uint(count))
+	if bitLength > tuftargets.MaxDelegationHashPrefixBitLen {
+		return tufdata.Signed{}, fmt.Errorf("number of bins must not exceed 2^%d", tuftargets.MaxDelegationHashPrefixBitLen)
+	}
+	if len(namePrefix) == 0 {
+		return tufdata.Signed{}, fmt.Errorf("name prefix for bins must be specified")
+	}
+	if err := validateRuleName(fmt.Sprintf("%s-0", namePrefix)); err != nil {
+		return tufdata.Signed{}, err
+	}
+	if threshold < 1 || threshold > len(allowedKeys) {
+		return tufdata.Signed{}, fmt.Errorf("invalid threshold %d for %d keys", threshold, len(allowedKeys))
+	}
+
+	rules, err := getAllRules(state)
+	if err != nil {
+		return tufdata.Signed{}, err
+	}
+	for _, rule := range rules {
+		if strings.HasPrefix(rule.Delegation.Name, namePrefix+"-") {
+			return tufdata.Signed{}, fmt.Errorf("rule %s conflicts with bins named %s", rule.Delegation.Name, namePrefix)
+		}
+	}
+
+	parentRole, parentKeys, err := loadParentRole(state, parentName)
+	if err != nil {
+		return tufdata.Signed{}, err
+	}
+	for _, signer := range roleSigners {
+		if !isKeyAuthorized(parentKeys, signer.PublicData().IDs()) {
+			return tufdata.Signed{}, fmt.Errorf("key %s is not authorized to sign for %s", signer.PublicData().IDs()[0], parentName)
+		}
+	}
+	if parentRole.Delegations != nil && len(parentRole.Delegations.Roles) > 0 {
+		return tufdata.Signed{}, fmt.Errorf("rule %s already delegates other rules", parentName)
+	}
+	if bins, err := getSuccinctRoles(parentRole); err != nil {
+		return tufdata.Signed{}, err
+	} else if bins != nil {
+		return tufdata.Signed{}, fmt.Errorf("rule %s already delegates to hash bins %s", parentName, bins.NamePrefix)
+	}
+
+	keyIDs := []string{}
+	keys := map[string]*tufdata.PublicKey{}
+	for _, k := range allowedKeys {
+		for _, keyID := range k.IDs() {
+			keyIDs = append(keyIDs, keyID)
+			keys[keyID] = &tufdata.PublicKey{
+				Type:       k.Type,
+				Scheme:     k.Scheme,
+				Algorithms: k.Algorithms,
+				Value:      k.Value,
+			}
+		}
+	}
+
+	custom, err := json.Marshal(targetsCustom{
+		SuccinctRoles: &succinctRoles{
+			KeyIDs:     keyIDs,
+			Threshold:  threshold,
+			BitLength:  bitLength,
+			NamePrefix: namePrefix,
+		},
+	})
+	if err != nil {
+		return tufdata.Signed{}, err
+	}
+	rawCustom := json.RawMessage(custom)
+
+	parentRole.Delegations = &tufdata.Delegations{
+		Keys:  keys,
+		Roles: []tufdata.DelegatedRole{},
+	}
+	parentRole.Custom = &rawCustom
+	parentRole.Version++
+
+	return generateAndSignMbFromStruct(parentRole, roleSigners)
+}
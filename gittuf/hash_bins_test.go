@@ -0,0 +1,196 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func TestSuccinctRolesBinForPath(t *testing.T) {
+	for _, bitLength := range []int{1, 4, 6} {
+		t.Run(fmt.Sprintf("%d bits", bitLength), func(t *testing.T) {
+			bins := &succinctRoles{BitLength: bitLength, NamePrefix: "bin"}
+			delegations := []tufdata.DelegatedRole{}
+			for i := uint64(0); i < bins.numBins(); i++ {
+				bin, err := bins.delegatedRole(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				delegations = append(delegations, bin)
+			}
+
+			// Every path is assigned to exactly one bin, the one binForPath
+			// finds without checking the others
+			for i := 0; i < 64; i++ {
+				target := fmt.Sprintf("src/%d/a", i)
+				targetHash := tufdata.PathHexDigest(target)
+				index, err := bins.binForPath(target)
+				if err != nil {
+					t.Fatal(err)
+				}
+				matched := []string{}
+				for _, d := range delegations {
+					matches, err := matchesTarget(d, target, targetHash)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if matches {
+						matched = append(matched, d.Name)
+					}
+				}
+				if len(matched) != 1 || matched[0] != bins.binName(index) {
+					t.Errorf("expected %s to match only bin %s, got %v", target, bins.binName(index), matched)
+				}
+			}
+		})
+	}
+
+	bins := &succinctRoles{BitLength: 6, NamePrefix: "src-bin"}
+	if name := bins.binName(10); name != "src-bin-0a" {
+		t.Errorf("expected bin name src-bin-0a, got %s", name)
+	}
+}
+
+func TestNewHashBins(t *testing.T) {
+	alice, bob := newTestSigner(t), newTestSigner(t)
+	targetsSigner := newTestSigner(t)
+
+	tests := []struct {
+		name       string
+		parent     string
+		namePrefix string
+		count      int
+		threshold  int
+		err        string
+	}{
+		{name: "bins", parent: "protect-src", namePrefix: "src-bin", count: 4, threshold: 1},
+		{name: "delegated by targets", parent: "targets", namePrefix: "src-bin", count: 4, threshold: 1, err: "must be delegated by a rule"},
+		{name: "count not a power of two", parent: "protect-src", namePrefix: "src-bin", count: 3, threshold: 1, err: "must be a power of two"},
+		{name: "single bin", parent: "protect-src", namePrefix: "src-bin", count: 1, threshold: 1, err: "must be a power of two"},
+		{name: "missing prefix", parent: "protect-src", count: 4, threshold: 1, err: "name prefix for bins must be specified"},
+		{name: "reserved prefix", parent: "protect-src", namePrefix: "branch/src", count: 4, threshold: 1, err: "reserved for roles recording branches and tags"},
+		{name: "conflicting prefix", parent: "protect-src", namePrefix: "protect", count: 4, threshold: 1, err: "conflicts with bins named protect"},
+		{name: "invalid threshold", parent: "protect-src", namePrefix: "src-bin", count: 4, threshold: 2, err: "invalid threshold 2 for 1 keys"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, _ := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+			state := store.State()
+			addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-src", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+
+			signers := []tufkeys.Signer{alice}
+			if test.parent == "targets" {
+				signers = []tufkeys.Signer{targetsSigner}
+			}
+			parentMb, err := NewHashBins(state, signers, test.parent, test.namePrefix, test.count, test.threshold, publicKeysForSigners([]tufkeys.Signer{bob}))
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			contents, err := json.Marshal(parentMb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := state.StageMetadataAndCommit(test.parent, contents, testSnapshotter()); err != nil {
+				t.Fatal(err)
+			}
+
+			// Each path is protected by the bin it is assigned to, which
+			// replaces the rule delegating the bins
+			bins := &succinctRoles{BitLength: 2, NamePrefix: test.namePrefix}
+			for _, target := range []string{"src/a", "src/b", "src/c"} {
+				index, err := bins.binForPath(target)
+				if err != nil {
+					t.Fatal(err)
+				}
+				expected, err := ExpectedSignersForTarget(state, target)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(expected) != 1 || expected[0].Rule != bins.binName(index) {
+					t.Fatalf("expected %s to be protected by %s, got %v", target, bins.binName(index), expected)
+				}
+				if !isKeyAuthorized(expected[0].Keys, bob.PublicData().IDs()) {
+					t.Errorf("expected bin %s to be signed by bob", expected[0].Rule)
+				}
+			}
+
+			rules, err := getAllRules(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rules) != 2+test.count {
+				t.Errorf("expected protect-src, %d bins and the allow rule, got %d rules", test.count, len(rules))
+			}
+
+			// Bins are delegated from once, and rules are delegated by bins
+			if _, err := NewHashBins(state, []tufkeys.Signer{alice}, test.parent, "other-bin", 2, 1, publicKeysForSigners([]tufkeys.Signer{bob})); err == nil || !strings.Contains(err.Error(), "already delegates to hash bins") {
+				t.Errorf("expected bins to be rejected for a rule that already delegates to bins, got %v", err)
+			}
+			if _, err := NewRule(state, []tufkeys.Signer{alice}, test.parent, "protect-src-a", 1, false, []string{"src/a"}, nil, nil, publicKeysForSigners([]tufkeys.Signer{bob})); err == nil || !strings.Contains(err.Error(), "rules must be delegated by a bin") {
+				t.Errorf("expected rule delegated by a rule with bins to be rejected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewRulePathHashPrefixes(t *testing.T) {
+	alice, bob := newTestSigner(t), newTestSigner(t)
+	targetsSigner := newTestSigner(t)
+	store, _ := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+	state := store.State()
+
+	if _, err := NewRule(state, []tufkeys.Signer{targetsSigner}, "targets", "protect-hashed", 1, false, []string{"src/*"}, []string{"0"}, nil, publicKeysForSigners([]tufkeys.Signer{alice})); err == nil || !strings.Contains(err.Error(), "cannot protect both paths and path hash prefixes") {
+		t.Fatalf("expected rule with paths and path hash prefixes to be rejected, got %v", err)
+	}
+
+	prefix := tufdata.PathHexDigest("src/a")[:2]
+	parentMb, err := NewRule(state, []tufkeys.Signer{targetsSigner}, "targets", "protect-hashed", 1, false, nil, []string{prefix}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := json.Marshal(parentMb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.StageMetadataAndCommit("targets", contents, testSnapshotter()); err != nil {
+		t.Fatal(err)
+	}
+	addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-src", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{bob}))
+
+	for target, rules := range map[string][]string{
+		"src/a": {"protect-hashed", "protect-src"},
+		"src/b": {"protect-src"},
+	} {
+		if strings.HasPrefix(tufdata.PathHexDigest(target), prefix) != (len(rules) == 2) {
+			t.Fatalf("test assumes the hash of %s does not start with %s", target, prefix)
+		}
+		assertExpectedRules(t, state, target, rules)
+	}
+}
+
+// assertExpectedRules checks the names of the rules protecting the target.
+func assertExpectedRules(t *testing.T, state *gitstore.State, target string, rules []string) {
+	t.Helper()
+	expected, err := ExpectedSignersForTarget(state, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range expected {
+		names = append(names, e.Rule)
+	}
+	if strings.Join(names, ",") != strings.Join(rules, ",") {
+		t.Errorf("expected %s to be protected by %v, got %v", target, rules, names)
+	}
+}
@@ -0,0 +1,177 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// newTestSigner returns a signer for a new ed25519 key.
+func newTestSigner(t *testing.T) tufkeys.Signer {
+	t.Helper()
+	privKey, err := GenerateKey(KeyTypeNameEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := GetSigner(privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// testSnapshotSigner holds the snapshot key of every test store.
+var testSnapshotSigner = func() tufkeys.Signer {
+	privKey, err := GenerateKey(KeyTypeNameEd25519)
+	if err != nil {
+		panic(err)
+	}
+	signer, err := GetSigner(privKey)
+	if err != nil {
+		panic(err)
+	}
+	return signer
+}()
+
+// testSnapshotter returns the snapshotter for states of test stores.
+func testSnapshotter() gitstore.Snapshotter {
+	return NewSnapshotter([]tufkeys.Signer{testSnapshotSigner})
+}
+
+/*
+chdirTest changes to dir for the duration of the test, for code that runs git
+in the current directory. Git uses a fixed identity and ignores the user's
+configuration.
+*/
+func chdirTest(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "gittuf")
+	t.Setenv("GIT_AUTHOR_EMAIL", "gittuf@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "gittuf")
+	t.Setenv("GIT_COMMITTER_EMAIL", "gittuf@example.com")
+}
+
+// runGit runs git in dir, failing the test if it does not succeed.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(cmd.Environ(),
+		"GIT_AUTHOR_NAME=gittuf", "GIT_AUTHOR_EMAIL=gittuf@example.com",
+		"GIT_COMMITTER_NAME=gittuf", "GIT_COMMITTER_EMAIL=gittuf@example.com",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %s: %s", args, err, output)
+	}
+	return string(output)
+}
+
+/*
+newTestStore initializes a gittuf namespace in a new repository, with root
+signed by rootSigners and the top level targets role signed by
+targetsSigners. The snapshot role uses the key of testSnapshotSigner. All
+roles have a threshold of one.
+*/
+func newTestStore(t *testing.T, rootSigners []tufkeys.Signer, targetsSigners []tufkeys.Signer) (*gitstore.GitStore, string) {
+	t.Helper()
+	return newTestStoreWithTimestamp(t, rootSigners, targetsSigners, nil)
+}
+
+// newTestStoreWithTimestamp is like newTestStore, but root also defines a
+// timestamp role with the keys of timestampSigners if there are any.
+func newTestStoreWithTimestamp(t *testing.T, rootSigners []tufkeys.Signer, targetsSigners []tufkeys.Signer, timestampSigners []tufkeys.Signer) (*gitstore.GitStore, string) {
+	t.Helper()
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q", "-b", "main")
+
+	timestampThreshold := 0
+	if len(timestampSigners) > 0 {
+		timestampThreshold = 1
+	}
+	rootPubKeys := publicKeysForSigners(rootSigners)
+	rootMb, err := initRoot(rootSigners, time.Time{}, 1, rootPubKeys, publicKeysForSigners(targetsSigners), 1, publicKeysForSigners([]tufkeys.Signer{testSnapshotSigner}), 1, publicKeysForSigners(timestampSigners), timestampThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetsMb, err := initTargets(targetsSigners, time.Time{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := map[string][]byte{}
+	for roleName, mb := range map[string]tufdata.Signed{"root": rootMb, "targets": targetsMb} {
+		contents, err := json.Marshal(mb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata[roleName] = contents
+	}
+
+	store, err := gitstore.InitGitStore(dir, rootPubKeys, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.State().Commit(testSnapshotter()); err != nil {
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+func publicKeysForSigners(signers []tufkeys.Signer) []*tufdata.PublicKey {
+	keys := []*tufdata.PublicKey{}
+	for _, signer := range signers {
+		keys = append(keys, signer.PublicData())
+	}
+	return keys
+}
+
+// addTestRule delegates a new rule from parent, signed by parentSigners, and
+// commits it to the state.
+func addTestRule(t *testing.T, state *gitstore.State, parentSigners []tufkeys.Signer, parent string, name string, threshold int, terminating bool, paths []string, operations []string, keys []*tufdata.PublicKey) {
+	t.Helper()
+	parentMb, err := NewRule(state, parentSigners, parent, name, threshold, terminating, paths, nil, operations, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := json.Marshal(parentMb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.StageMetadataAndCommit(parent, contents, testSnapshotter()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stageTestRefRole commits the role recording the target to the state.
+func stageTestRefRole(t *testing.T, state *gitstore.State, target string, roleMb tufdata.Signed) {
+	t.Helper()
+	roleName, err := GetRoleNameForTarget(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := json.Marshal(roleMb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.StageMetadataAndCommit(roleName, contents, testSnapshotter()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,41 +1,49 @@
 package gittuf
 
 import (
-	"encoding/json"
+	"fmt"
 	"os/exec"
 	"time"
 
 	tufdata "github.com/theupdateframework/go-tuf/data"
 	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
-	tufsign "github.com/theupdateframework/go-tuf/sign"
 )
 
 func Init(
-	rootKeys []tufdata.PrivateKey,
+	rootSigners []tufkeys.Signer,
 	rootExpires time.Time,
 	rootThreshold int,
-	rootPubKeys []tufdata.PublicKey,
-	targetsPubKeys []tufdata.PublicKey,
-	targetsPrivKeys []tufdata.PrivateKey,
+	rootPubKeys []*tufdata.PublicKey,
+	targetsPubKeys []*tufdata.PublicKey,
+	targetsSigners []tufkeys.Signer,
 	targetsExpires time.Time,
 	targetsThreshold int,
+	snapshotPubKeys []*tufdata.PublicKey,
+	snapshotThreshold int,
+	timestampPubKeys []*tufdata.PublicKey,
+	timestampThreshold int,
 	initArgs ...string) (map[string]tufdata.Signed, error) {
 	roles := map[string]tufdata.Signed{}
 
+	if len(snapshotPubKeys) == 0 {
+		return roles, fmt.Errorf("snapshot keys must be specified, use --snapshot-key or --snapshot-public-key")
+	}
+
 	cmd := exec.Command("git", append([]string{"init"}, initArgs...)...)
 	err := cmd.Run()
 	if err != nil {
 		return roles, err
 	}
 
-	rootRole, err := initRoot(rootKeys, rootExpires, rootThreshold, rootPubKeys,
-		targetsPubKeys, targetsThreshold)
+	rootRole, err := initRoot(rootSigners, rootExpires, rootThreshold, rootPubKeys,
+		targetsPubKeys, targetsThreshold, snapshotPubKeys, snapshotThreshold,
+		timestampPubKeys, timestampThreshold)
 	if err != nil {
 		return roles, err
 	}
 	roles["root"] = rootRole
 
-	targetsRole, err := initTargets(targetsPrivKeys, targetsExpires,
+	targetsRole, err := initTargets(targetsSigners, targetsExpires,
 		targetsThreshold)
 	if err != nil {
 		return roles, err
@@ -46,12 +54,16 @@ func Init(
 }
 
 func initRoot(
-	keys []tufdata.PrivateKey,
+	signers []tufkeys.Signer,
 	expires time.Time,
 	rootThreshold int,
-	rootPubKeys []tufdata.PublicKey,
-	targetsPubKeys []tufdata.PublicKey,
-	targetsThreshold int) (tufdata.Signed, error) {
+	rootPubKeys []*tufdata.PublicKey,
+	targetsPubKeys []*tufdata.PublicKey,
+	targetsThreshold int,
+	snapshotPubKeys []*tufdata.PublicKey,
+	snapshotThreshold int,
+	timestampPubKeys []*tufdata.PublicKey,
+	timestampThreshold int) (tufdata.Signed, error) {
 	rootRole := tufdata.NewRoot()
 
 	if !expires.IsZero() {
@@ -60,22 +72,10 @@ func initRoot(
 
 	rootRole.Version = 1
 
-	pubKeys := append(rootPubKeys, targetsPubKeys...)
+	pubKeys := append(append(append(rootPubKeys, targetsPubKeys...), snapshotPubKeys...), timestampPubKeys...)
 
 	for _, k := range pubKeys {
-		/*
-			 FIXME:
-				tufdata.Root.Keys is of type map[string]*tufdata.PublicKey
-				and passing &k in directly will result in the last public key in
-				the slice being associated with each entry.
-		*/
-		tmpKey := tufdata.PublicKey{
-			Type:       k.Type,
-			Algorithms: k.Algorithms,
-			Value:      k.Value,
-			Scheme:     k.Scheme,
-		}
-		rootRole.AddKey(&tmpKey)
+		rootRole.AddKey(k)
 	}
 
 	var rootKeyIds []string
@@ -98,32 +98,32 @@ func initRoot(
 	}
 	rootRole.Roles["targets"] = &targetsRoleMeta
 
-	rootRoleJson, err := json.Marshal(rootRole)
-	if err != nil {
-		return tufdata.Signed{}, err
+	var snapshotKeyIds []string
+	for _, k := range snapshotPubKeys {
+		snapshotKeyIds = append(snapshotKeyIds, k.IDs()...)
 	}
-
-	rootRoleMb := tufdata.Signed{
-		Signed:     rootRoleJson,
-		Signatures: []tufdata.Signature{},
+	rootRole.Roles["snapshot"] = &tufdata.Role{
+		KeyIDs:    snapshotKeyIds,
+		Threshold: snapshotThreshold,
 	}
 
-	for _, key := range keys {
-		signer, err := tufkeys.GetSigner(&key)
-		if err != nil {
-			return tufdata.Signed{}, err
+	// The timestamp role is optional
+	if len(timestampPubKeys) > 0 {
+		var timestampKeyIds []string
+		for _, k := range timestampPubKeys {
+			timestampKeyIds = append(timestampKeyIds, k.IDs()...)
 		}
-		err = tufsign.Sign(&rootRoleMb, signer)
-		if err != nil {
-			return tufdata.Signed{}, err
+		rootRole.Roles["timestamp"] = &tufdata.Role{
+			KeyIDs:    timestampKeyIds,
+			Threshold: timestampThreshold,
 		}
 	}
 
-	return rootRoleMb, nil
+	return generateAndSignMbFromStruct(rootRole, signers)
 }
 
 func initTargets(
-	keys []tufdata.PrivateKey,
+	signers []tufkeys.Signer,
 	expires time.Time,
 	threshold int) (tufdata.Signed, error) {
 	targetsRole := tufdata.NewTargets()
@@ -139,26 +139,5 @@ func initTargets(
 		Roles: []tufdata.DelegatedRole{createAllowRule()},
 	}
 
-	targetsRoleJson, err := json.Marshal(targetsRole)
-	if err != nil {
-		return tufdata.Signed{}, err
-	}
-
-	targetsRoleMb := tufdata.Signed{
-		Signed:     targetsRoleJson,
-		Signatures: []tufdata.Signature{},
-	}
-
-	for _, key := range keys {
-		signer, err := tufkeys.GetSigner(&key)
-		if err != nil {
-			return tufdata.Signed{}, err
-		}
-		err = tufsign.Sign(&targetsRoleMb, signer)
-		if err != nil {
-			return tufdata.Signed{}, err
-		}
-	}
-
-	return targetsRoleMb, nil
+	return generateAndSignMbFromStruct(targetsRole, signers)
 }
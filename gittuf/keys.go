@@ -0,0 +1,409 @@
+package gittuf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/encrypted"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	KeyTypeNameEd25519 = "ed25519"
+	KeyTypeNameECDSA   = "ecdsa"
+	KeyTypeNameRSA     = "rsa"
+
+	// KeyTypeSslibECDSA is the key type securesystemslib uses for
+	// ecdsa-sha2-nistp256 keys. go-tuf only knows these keys by their scheme.
+	KeyTypeSslibECDSA tufdata.KeyType = "ecdsa"
+
+	pemPublicKey           = "PUBLIC KEY"
+	pemPrivateKey          = "PRIVATE KEY"
+	pemECPrivateKey        = "EC PRIVATE KEY"
+	pemRSAPrivateKey       = "RSA PRIVATE KEY"
+	pemEncryptedPrivateKey = "ENCRYPTED PRIVATE KEY"
+	sslibPublicField       = "public"
+	sslibPrivateField      = "private"
+)
+
+func init() {
+	// Register go-tuf's ECDSA signer and verifier for the securesystemslib key
+	// type so that keys generated by python-securesystemslib can be used
+	// without changing their key IDs.
+	if verifier, ok := tufkeys.VerifierMap.Load(tufdata.KeyTypeECDSA_SHA2_P256); ok {
+		tufkeys.VerifierMap.Store(KeyTypeSslibECDSA, verifier)
+	}
+	if signer, ok := tufkeys.SignerMap.Load(tufdata.KeyTypeECDSA_SHA2_P256); ok {
+		tufkeys.SignerMap.Store(KeyTypeSslibECDSA, signer)
+	}
+}
+
+/*
+LoadPublicKey reads a public key from the specified path. The key may be in
+the securesystemslib JSON format, a PEM encoded PKIX public key, an SSH public
+key in the authorized_keys format, or an armored or binary OpenPGP public key.
+ED25519, ECDSA P-256, and RSA keys are supported, as are any OpenPGP keys
+supported by go-crypto.
+*/
+func LoadPublicKey(path string) (*tufdata.PublicKey, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(contents)
+}
+
+// ParsePublicKey parses the contents of a public key file.
+func ParsePublicKey(contents []byte) (*tufdata.PublicKey, error) {
+	if bytes.Contains(contents, []byte(openpgpArmorHeader)) {
+		return parseOpenPGPPublicKey(contents)
+	}
+
+	if block, _ := pem.Decode(contents); block != nil {
+		if block.Type != pemPublicKey {
+			return nil, fmt.Errorf("unexpected PEM block type %s for public key", block.Type)
+		}
+		pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newPublicKeyFromCrypto(pubKey)
+	}
+
+	if sshKey, _, _, _, err := ssh.ParseAuthorizedKey(contents); err == nil {
+		return newPublicKeyFromSSH(sshKey)
+	}
+
+	var pubKey tufdata.PublicKey
+	if err := json.Unmarshal(contents, &pubKey); err != nil {
+		// Binary OpenPGP keys have no marker we can check for upfront
+		if pgpKey, pgpErr := parseOpenPGPPublicKey(contents); pgpErr == nil {
+			return pgpKey, nil
+		}
+		return nil, err
+	}
+	if _, err := tufkeys.GetVerifier(&pubKey); err != nil {
+		return nil, fmt.Errorf("unsupported public key of type %s: %w", pubKey.Type, err)
+	}
+	return &pubKey, nil
+}
+
+/*
+LoadPrivateKey reads a private key from the specified path. The key may be in
+the securesystemslib JSON format or a PEM encoded PKCS#8, SEC 1, or PKCS#1
+private key. Keys encrypted by gittuf keys generate are decrypted using the
+passphrase returned by GetPassphrase. The returned key is in the form go-tuf
+expects for its signers.
+*/
+func LoadPrivateKey(path string) (*tufdata.PrivateKey, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if isEncryptedPrivateKey(contents) {
+		passphrase, err := GetPassphrase(fmt.Sprintf("Enter passphrase for %s: ", path))
+		if err != nil {
+			return nil, err
+		}
+		contents, err = encrypted.Decrypt(contents, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt %s: %w", path, err)
+		}
+	}
+
+	return ParsePrivateKey(contents)
+}
+
+/*
+GenerateKey creates a new private key of the specified type, which must be one
+of ed25519, ecdsa, or rsa. ECDSA keys use the P-256 curve and RSA keys are 2048
+bits long.
+*/
+func GenerateKey(keyType string) (*tufdata.PrivateKey, error) {
+	switch keyType {
+	case KeyTypeNameEd25519:
+		signer, err := tufkeys.GenerateEd25519Key()
+		if err != nil {
+			return nil, err
+		}
+		return signer.MarshalPrivateKey()
+	case KeyTypeNameECDSA:
+		signer, err := tufkeys.GenerateEcdsaKey()
+		if err != nil {
+			return nil, err
+		}
+		return signer.MarshalPrivateKey()
+	case KeyTypeNameRSA:
+		signer, err := tufkeys.GenerateRsaKey()
+		if err != nil {
+			return nil, err
+		}
+		return signer.MarshalPrivateKey()
+	}
+	return nil, fmt.Errorf("unknown key type %s, must be one of %s, %s, or %s", keyType, KeyTypeNameEd25519, KeyTypeNameECDSA, KeyTypeNameRSA)
+}
+
+// EncryptPrivateKey returns the private key encrypted with the passphrase
+// using scrypt and NaCl secretbox.
+func EncryptPrivateKey(privKey *tufdata.PrivateKey, passphrase []byte) ([]byte, error) {
+	return encrypted.Marshal(privKey, passphrase)
+}
+
+func isEncryptedPrivateKey(contents []byte) bool {
+	var envelope struct {
+		KDF        *json.RawMessage `json:"kdf"`
+		Ciphertext []byte           `json:"ciphertext"`
+	}
+	if err := json.Unmarshal(contents, &envelope); err != nil {
+		return false
+	}
+	return envelope.KDF != nil && len(envelope.Ciphertext) > 0
+}
+
+// ParsePrivateKey parses the contents of a private key file.
+func ParsePrivateKey(contents []byte) (*tufdata.PrivateKey, error) {
+	if block, _ := pem.Decode(contents); block != nil {
+		privKey, err := parsePEMPrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		return newPrivateKeyFromCrypto(privKey)
+	}
+
+	var privKey tufdata.PrivateKey
+	if err := json.Unmarshal(contents, &privKey); err != nil {
+		return nil, err
+	}
+
+	var keyValue map[string]string
+	if err := json.Unmarshal(privKey.Value, &keyValue); err != nil {
+		return nil, err
+	}
+
+	switch privKey.Type {
+	case tufdata.KeyTypeEd25519:
+		/*
+			Here, the assumption is that the key pair is in the securesystemslib
+			format. However, the default python-sslib format does not contain
+			the private and the public halves of the key in the "private" field
+			as go-tuf expects. So, we append the public portion to the private
+			portion when we see just the seed.
+		*/
+		if len(keyValue[sslibPrivateField]) < 2*ed25519.PrivateKeySize {
+			keyValue[sslibPrivateField] += keyValue[sslibPublicField]
+		}
+	case tufdata.KeyTypeECDSA_SHA2_P256, KeyTypeSslibECDSA, tufdata.KeyTypeRSASSA_PSS_SHA256:
+		/*
+			go-tuf expects SEC 1 and PKCS#1 blocks for ECDSA and RSA keys
+			respectively, while securesystemslib may store PKCS#8 blocks. We
+			re-encode the private portion to the expected form.
+		*/
+		block, _ := pem.Decode([]byte(keyValue[sslibPrivateField]))
+		if block == nil {
+			return nil, fmt.Errorf("invalid PEM value for private key")
+		}
+		cryptoKey, err := parsePEMPrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		privateBlock, err := marshalPEMPrivateKey(cryptoKey)
+		if err != nil {
+			return nil, err
+		}
+		keyValue[sslibPrivateField] = string(privateBlock)
+	default:
+		return nil, fmt.Errorf("unsupported private key of type %s", privKey.Type)
+	}
+
+	value, err := json.Marshal(keyValue)
+	if err != nil {
+		return nil, err
+	}
+	privKey.Value = value
+
+	if _, err := tufkeys.GetSigner(&privKey); err != nil {
+		return nil, err
+	}
+	return &privKey, nil
+}
+
+/*
+GetPublicKeyFromPrivateKey returns the public portion of a private key. If the
+private key records its public half, as securesystemslib keys do, that value
+is used verbatim so that the key ID matches that of the corresponding public
+key file.
+*/
+func GetPublicKeyFromPrivateKey(privKey *tufdata.PrivateKey) (*tufdata.PublicKey, error) {
+	var keyValue map[string]string
+	if err := json.Unmarshal(privKey.Value, &keyValue); err != nil {
+		return nil, err
+	}
+
+	publicValue, hasPublic := keyValue[sslibPublicField]
+	if !hasPublic || len(publicValue) == 0 {
+		signer, err := tufkeys.GetSigner(privKey)
+		if err != nil {
+			return nil, err
+		}
+		return &tufdata.PublicKey{
+			Type:       privKey.Type,
+			Scheme:     privKey.Scheme,
+			Algorithms: privKey.Algorithms,
+			Value:      signer.PublicData().Value,
+		}, nil
+	}
+
+	newValue, err := json.Marshal(map[string]string{sslibPublicField: publicValue})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tufdata.PublicKey{
+		Type:       privKey.Type,
+		Scheme:     privKey.Scheme,
+		Algorithms: privKey.Algorithms,
+		Value:      newValue,
+	}, nil
+}
+
+func parsePEMPrivateKey(block *pem.Block) (crypto.PrivateKey, error) {
+	switch block.Type {
+	case pemPrivateKey:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case pemECPrivateKey:
+		return x509.ParseECPrivateKey(block.Bytes)
+	case pemRSAPrivateKey:
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case pemEncryptedPrivateKey:
+		return nil, fmt.Errorf("encrypted PKCS#8 keys are not supported, use gittuf keys generate to create a passphrase protected key")
+	}
+	return nil, fmt.Errorf("unexpected PEM block type %s for private key", block.Type)
+}
+
+func marshalPEMPrivateKey(privKey crypto.PrivateKey) ([]byte, error) {
+	switch k := privKey.(type) {
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: pemECPrivateKey, Bytes: der}), nil
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: pemRSAPrivateKey, Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", privKey)
+}
+
+func marshalPEMPublicKey(pubKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: pemPublicKey, Bytes: der})), nil
+}
+
+func newPublicKeyFromCrypto(pubKey crypto.PublicKey) (*tufdata.PublicKey, error) {
+	var (
+		keyType   tufdata.KeyType
+		keyScheme tufdata.KeyScheme
+		keyValue  map[string]string
+	)
+
+	switch k := pubKey.(type) {
+	case ed25519.PublicKey:
+		keyType, keyScheme = tufdata.KeyTypeEd25519, tufdata.KeySchemeEd25519
+		keyValue = map[string]string{sslibPublicField: tufdata.HexBytes(k).String()}
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+		public, err := marshalPEMPublicKey(k)
+		if err != nil {
+			return nil, err
+		}
+		keyType, keyScheme = tufdata.KeyTypeECDSA_SHA2_P256, tufdata.KeySchemeECDSA_SHA2_P256
+		keyValue = map[string]string{sslibPublicField: public}
+	case *rsa.PublicKey:
+		public, err := marshalPEMPublicKey(k)
+		if err != nil {
+			return nil, err
+		}
+		keyType, keyScheme = tufdata.KeyTypeRSASSA_PSS_SHA256, tufdata.KeySchemeRSASSA_PSS_SHA256
+		keyValue = map[string]string{sslibPublicField: public}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pubKey)
+	}
+
+	value, err := json.Marshal(keyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tufdata.PublicKey{
+		Type:       keyType,
+		Scheme:     keyScheme,
+		Algorithms: tufdata.HashAlgorithms,
+		Value:      value,
+	}, nil
+}
+
+func newPublicKeyFromSSH(sshKey ssh.PublicKey) (*tufdata.PublicKey, error) {
+	cryptoKey, ok := sshKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported SSH key type %s", sshKey.Type())
+	}
+	return newPublicKeyFromCrypto(cryptoKey.CryptoPublicKey())
+}
+
+func newPrivateKeyFromCrypto(privKey crypto.PrivateKey) (*tufdata.PrivateKey, error) {
+	signer, ok := privKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", privKey)
+	}
+	pubKey, err := newPublicKeyFromCrypto(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	var keyValue map[string]string
+	if err := json.Unmarshal(pubKey.Value, &keyValue); err != nil {
+		return nil, err
+	}
+
+	if k, isEd25519 := privKey.(ed25519.PrivateKey); isEd25519 {
+		keyValue[sslibPrivateField] = tufdata.HexBytes(k).String()
+	} else {
+		private, err := marshalPEMPrivateKey(privKey)
+		if err != nil {
+			return nil, err
+		}
+		keyValue[sslibPrivateField] = string(private)
+	}
+
+	value, err := json.Marshal(keyValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tufdata.PrivateKey{
+		Type:       pubKey.Type,
+		Scheme:     pubKey.Scheme,
+		Algorithms: pubKey.Algorithms,
+		Value:      value,
+	}, nil
+}
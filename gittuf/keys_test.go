@@ -0,0 +1,218 @@
+package gittuf
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufsign "github.com/theupdateframework/go-tuf/sign"
+	"golang.org/x/crypto/ssh"
+)
+
+// verifyTestSigner signs with the private key and checks that the signature
+// verifies with the public key under the same key ID.
+func verifyTestSigner(t *testing.T, privKey *tufdata.PrivateKey, pubKey *tufdata.PublicKey) {
+	t.Helper()
+	signer, err := GetSigner(privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.PublicData().IDs()[0] != pubKey.IDs()[0] {
+		t.Fatalf("expected signer key ID %s, got %s", pubKey.IDs()[0], signer.PublicData().IDs()[0])
+	}
+
+	mb := tufdata.Signed{Signed: []byte(`{"_type":"targets"}`)}
+	if err := tufsign.Sign(&mb, signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySignatures(&mb, map[string]*tufdata.PublicKey{pubKey.IDs()[0]: pubKey}, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func marshalTestPEM(t *testing.T, blockType string, der []byte, err error) []byte {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestParseKeys(t *testing.T) {
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8 := func(key crypto.PrivateKey) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		return marshalTestPEM(t, pemPrivateKey, der, err)
+	}
+	pkix := func(key crypto.PublicKey) []byte {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		return marshalTestPEM(t, pemPublicKey, der, err)
+	}
+	authorizedKey := func(key crypto.PublicKey) []byte {
+		sshKey, err := ssh.NewPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ssh.MarshalAuthorizedKey(sshKey)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecdsaKey)
+	sec1 := marshalTestPEM(t, pemECPrivateKey, ecDER, err)
+	pkcs1 := marshalTestPEM(t, pemRSAPrivateKey, x509.MarshalPKCS1PrivateKey(rsaKey), nil)
+
+	// python-securesystemslib stores just the seed of ed25519 keys
+	sslibPublic := tufdata.HexBytes(ed25519Key.Public().(ed25519.PublicKey)).String()
+	sslibKey := func(value map[string]string) []byte {
+		contents, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err = json.Marshal(tufdata.PrivateKey{Type: tufdata.KeyTypeEd25519, Scheme: tufdata.KeySchemeEd25519, Algorithms: tufdata.HashAlgorithms, Value: contents})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return contents
+	}
+	sslibPriv := sslibKey(map[string]string{sslibPublicField: sslibPublic, sslibPrivateField: tufdata.HexBytes(ed25519Key.Seed()).String()})
+	sslibPub := sslibKey(map[string]string{sslibPublicField: sslibPublic})
+
+	tests := []struct {
+		name    string
+		private []byte
+		public  [][]byte
+		keyType tufdata.KeyType
+	}{
+		{name: "ed25519 pkcs8", private: pkcs8(ed25519Key), public: [][]byte{pkix(ed25519Key.Public()), authorizedKey(ed25519Key.Public())}, keyType: tufdata.KeyTypeEd25519},
+		{name: "ed25519 securesystemslib", private: sslibPriv, public: [][]byte{sslibPub}, keyType: tufdata.KeyTypeEd25519},
+		{name: "ecdsa pkcs8", private: pkcs8(ecdsaKey), public: [][]byte{pkix(&ecdsaKey.PublicKey), authorizedKey(&ecdsaKey.PublicKey)}, keyType: tufdata.KeyTypeECDSA_SHA2_P256},
+		{name: "ecdsa sec1", private: sec1, public: [][]byte{pkix(&ecdsaKey.PublicKey)}, keyType: tufdata.KeyTypeECDSA_SHA2_P256},
+		{name: "rsa pkcs8", private: pkcs8(rsaKey), public: [][]byte{pkix(&rsaKey.PublicKey), authorizedKey(&rsaKey.PublicKey)}, keyType: tufdata.KeyTypeRSASSA_PSS_SHA256},
+		{name: "rsa pkcs1", private: pkcs1, public: [][]byte{pkix(&rsaKey.PublicKey)}, keyType: tufdata.KeyTypeRSASSA_PSS_SHA256},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			privKey, err := ParsePrivateKey(test.private)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if privKey.Type != test.keyType {
+				t.Fatalf("expected key type %s, got %s", test.keyType, privKey.Type)
+			}
+			for _, public := range test.public {
+				pubKey, err := ParsePublicKey(public)
+				if err != nil {
+					t.Fatal(err)
+				}
+				verifyTestSigner(t, privKey, pubKey)
+			}
+		})
+	}
+}
+
+func TestParseKeysRejected(t *testing.T) {
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384DER, err := x509.MarshalPKCS8PrivateKey(p384Key)
+	p384Private := marshalTestPEM(t, pemPrivateKey, p384DER, err)
+	p384PubDER, err := x509.MarshalPKIXPublicKey(&p384Key.PublicKey)
+	p384Public := marshalTestPEM(t, pemPublicKey, p384PubDER, err)
+
+	tests := []struct {
+		name    string
+		private bool
+		key     []byte
+		err     string
+	}{
+		{name: "ecdsa p384 private", private: true, key: p384Private, err: "unsupported ECDSA curve"},
+		{name: "ecdsa p384 public", key: p384Public, err: "unsupported ECDSA curve"},
+		{name: "encrypted pkcs8", private: true, key: marshalTestPEM(t, pemEncryptedPrivateKey, []byte{0}, nil), err: "encrypted PKCS#8 keys are not supported"},
+		{name: "private key as public key", key: marshalTestPEM(t, pemRSAPrivateKey, []byte{0}, nil), err: "unexpected PEM block type"},
+		{name: "unknown json key type", key: []byte(`{"keytype":"unknown","scheme":"unknown","keyval":{"public":"00"}}`), err: "unsupported public key of type unknown"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var err error
+			if test.private {
+				_, err = ParsePrivateKey(test.key)
+			} else {
+				_, err = ParsePublicKey(test.key)
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing '%s', got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	tests := map[string]tufdata.KeyType{
+		KeyTypeNameEd25519: tufdata.KeyTypeEd25519,
+		KeyTypeNameECDSA:   tufdata.KeyTypeECDSA_SHA2_P256,
+		KeyTypeNameRSA:     tufdata.KeyTypeRSASSA_PSS_SHA256,
+	}
+	for keyTypeName, keyType := range tests {
+		t.Run(keyTypeName, func(t *testing.T) {
+			privKey, err := GenerateKey(keyTypeName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if privKey.Type != keyType {
+				t.Fatalf("expected key type %s, got %s", keyType, privKey.Type)
+			}
+
+			// Keys are stored encrypted and read back with the passphrase
+			encrypted, err := EncryptPrivateKey(privKey, []byte("passphrase"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "key")
+			if err := os.WriteFile(path, encrypted, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			t.Setenv(PassphraseEnvVar, "wrong")
+			if _, err := LoadPrivateKey(path); err == nil || !strings.Contains(err.Error(), "unable to decrypt") {
+				t.Fatalf("expected wrong passphrase to be rejected, got %v", err)
+			}
+
+			t.Setenv(PassphraseEnvVar, "passphrase")
+			loaded, err := LoadPrivateKey(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pubKey, err := GetPublicKeyFromPrivateKey(privKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifyTestSigner(t, loaded, pubKey)
+		})
+	}
+
+	if _, err := GenerateKey("dsa"); err == nil {
+		t.Error("expected unknown key type to be rejected")
+	}
+}
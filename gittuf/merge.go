@@ -0,0 +1,102 @@
+package gittuf
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/sirupsen/logrus"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+/*
+Merge merges the specified branch into the current branch and records the
+merge commit in the current branch's role. The commits being merged may have
+been made by anyone. Instead, every change the merge makes to the current
+branch must be authorized by the rules using the keys of the signers, which
+is also how the change is verified when the state is pulled. A merge commit
+is always created, as a fast forward could not be checked before the branch
+is updated. The git arguments are passed to git commit, and default to using
+the merge message.
+*/
+func Merge(state *gitstore.State, branchName string, mergeBranch string, signers []tufkeys.Signer, expires time.Time, gitArgs ...string) (tufdata.Signed, string, error) {
+	targetName, _ := CreateGitTarget(branchName, GitBranchRef)
+	roleName, _ := GetRoleNameForTarget(targetName)
+
+	if err := startMerge(mergeBranch); err != nil {
+		return tufdata.Signed{}, "", err
+	}
+
+	// The staged changes are those the merge makes to the current branch
+	validations, err := verifyStagedChanges(state, getKeyIDsForSigners(signers))
+	if err != nil {
+		return tufdata.Signed{}, "", AbortMerge(err)
+	}
+
+	roleSigners, err := getBranchSigners(state, roleName, targetName, signers, validations)
+	if err != nil {
+		return tufdata.Signed{}, "", AbortMerge(err)
+	}
+
+	if len(gitArgs) == 0 {
+		gitArgs = []string{"--no-edit"}
+	}
+	commitID, err := createCommit(gitArgs)
+	if err != nil {
+		return tufdata.Signed{}, "", AbortMerge(err)
+	}
+
+	signedRoleMb, err := recordBranchCommit(state, roleName, targetName, commitID, roleSigners, expires)
+	if err != nil {
+		return tufdata.Signed{}, "", AbortMerge(UndoLastCommit(err))
+	}
+
+	return signedRoleMb, targetName, nil
+}
+
+/*
+startMerge merges the branch without committing the result. If the merge has
+conflicts, it is left in progress so they can be resolved, after which the
+merge can be recorded using gittuf commit.
+*/
+func startMerge(mergeBranch string) error {
+	logrus.Debugf("Merging %s", mergeBranch)
+
+	cmd := exec.Command("git", "merge", "--no-commit", "--no-ff", mergeBranch)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	if !isMergeInProgress() {
+		if runErr != nil {
+			return fmt.Errorf("unable to merge %s: %w: %s", mergeBranch, runErr, strings.TrimSpace(stderr.String()))
+		}
+		return fmt.Errorf("%s is already merged", mergeBranch)
+	}
+	if runErr != nil {
+		return fmt.Errorf("merge of %s has conflicts, resolve them and record the merge using gittuf commit", mergeBranch)
+	}
+	return nil
+}
+
+// isMergeInProgress reports whether a merge is waiting to be committed.
+func isMergeInProgress() bool {
+	cmd := exec.Command("git", "rev-parse", "-q", "--verify", "MERGE_HEAD")
+	return cmd.Run() == nil
+}
+
+// AbortMerge abandons the merge in progress, if any, and returns the error
+// that caused it.
+func AbortMerge(cause error) error {
+	if !isMergeInProgress() {
+		return cause
+	}
+	if err := exec.Command("git", "merge", "--abort").Run(); err != nil {
+		return fmt.Errorf("could not abort merge triggered due to error %w", cause)
+	}
+	return cause
+}
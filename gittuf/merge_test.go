@@ -0,0 +1,119 @@
+package gittuf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+/*
+newTestMergeRepository returns a store whose repository is the current
+directory, with src/* protected by a rule for alice's key. The main branch is
+recorded with one commit by alice, and the feature branch changes src/a on
+top of it.
+*/
+func newTestMergeRepository(t *testing.T, alice tufkeys.Signer) (*gitstore.GitStore, string) {
+	t.Helper()
+	targetsSigner := newTestSigner(t)
+	store, dir := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+	chdirTest(t, dir)
+	state := store.State()
+	addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-src", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+
+	writeTestFile(t, dir, "src/a", "a\n")
+	writeTestFile(t, dir, "other", "other\n")
+	runGit(t, dir, "add", "-A")
+	roleMb, target, err := Commit(state, "main", []tufkeys.Signer{alice}, time.Now().AddDate(0, 0, 1), "-q", "-m", "initial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageTestRefRole(t, state, target, roleMb)
+
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeTestFile(t, dir, "src/a", "a\nfeature\n")
+	runGit(t, dir, "commit", "-q", "-am", "feature change")
+	runGit(t, dir, "checkout", "-q", "main")
+	return store, dir
+}
+
+func TestMerge(t *testing.T) {
+	alice, bob := newTestSigner(t), newTestSigner(t)
+
+	tests := []struct {
+		name    string
+		signers []tufkeys.Signer
+		err     string
+	}{
+		{name: "authorized", signers: []tufkeys.Signer{alice}},
+		{name: "authorized with other keys", signers: []tufkeys.Signer{bob, alice}},
+		{name: "unauthorized", signers: []tufkeys.Signer{bob}, err: "unauthorized modify of file src/a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, dir := newTestMergeRepository(t, alice)
+			state := store.State()
+			stateA := state.Tip()
+			head := runGit(t, dir, "rev-parse", "HEAD")
+
+			roleMb, target, err := Merge(state, "main", "feature", test.signers, time.Now().AddDate(0, 0, 1))
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				if isMergeInProgress() {
+					t.Error("expected merge to be aborted")
+				}
+				if newHead := runGit(t, dir, "rev-parse", "HEAD"); newHead != head {
+					t.Errorf("expected HEAD to remain %s, got %s", head, newHead)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target != "git:branch=main" {
+				t.Errorf("expected target git:branch=main, got %s", target)
+			}
+			if parents := strings.Fields(runGit(t, dir, "log", "-1", "--format=%P")); len(parents) != 2 {
+				t.Errorf("expected a merge commit, got parents %v", parents)
+			}
+			stageTestRefRole(t, state, target, roleMb)
+
+			if err := VerifyTrustedStates(store, target, stateA, state.Tip()); err != nil {
+				t.Errorf("expected merge to be verified, got %v", err)
+			}
+		})
+	}
+
+	t.Run("already merged", func(t *testing.T) {
+		store, dir := newTestMergeRepository(t, alice)
+		runGit(t, dir, "merge", "-q", "--no-edit", "feature")
+		if _, _, err := Merge(store.State(), "main", "feature", []tufkeys.Signer{alice}, time.Now().AddDate(0, 0, 1)); err == nil || !strings.Contains(err.Error(), "feature is already merged") {
+			t.Errorf("expected merged branch to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("fast forward by unauthorized key", func(t *testing.T) {
+		store, dir := newTestMergeRepository(t, alice)
+		state := store.State()
+		stateA := state.Tip()
+
+		// Bob fast forwards main to the feature branch and records a trivial
+		// commit on top of it
+		runGit(t, dir, "merge", "-q", "--ff-only", "feature")
+		writeTestFile(t, dir, "other", "other\ntrivial\n")
+		runGit(t, dir, "add", "other")
+		roleMb, target, err := Commit(state, "main", []tufkeys.Signer{bob}, time.Now().AddDate(0, 0, 1), "-q", "-m", "trivial")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stageTestRefRole(t, state, target, roleMb)
+
+		if err := VerifyTrustedStates(store, target, stateA, state.Tip()); err == nil || !strings.Contains(err.Error(), "unauthorized modify of file src/a") {
+			t.Errorf("expected change to src/a to be rejected, got %v", err)
+		}
+	})
+}
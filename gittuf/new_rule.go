@@ -1,33 +1,65 @@
 package gittuf
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"github.com/adityasaky/gittuf/internal/gitstore"
 
 	tufdata "github.com/theupdateframework/go-tuf/data"
 	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
-	tufsign "github.com/theupdateframework/go-tuf/sign"
 )
 
+/*
+NewRule returns a new version of the parent role that delegates the protected
+paths to a new rule. The parent is either the top level targets role or an
+existing rule, which lets a rule delegate some of its paths to another set of
+keys. A rule's metadata is created the first time it delegates a rule. A rule
+protects either paths or path hash prefixes, but not both. If operations are
+specified, the rule only authorizes those operations on its paths.
+*/
 func NewRule(
 	state *gitstore.State,
-	roleKeys []tufdata.PrivateKey,
+	roleSigners []tufkeys.Signer,
+	parentName string,
 	ruleName string,
 	ruleThreshold int,
 	ruleTerminating bool,
 	protectPaths []string,
-	allowedKeys []tufdata.PublicKey) (tufdata.Signed, error) {
+	pathHashPrefixes []string,
+	operations []string,
+	allowedKeys []*tufdata.PublicKey) (tufdata.Signed, error) {
 
+	if len(protectPaths) > 0 && len(pathHashPrefixes) > 0 {
+		return tufdata.Signed{}, fmt.Errorf("rule %s cannot protect both paths and path hash prefixes", ruleName)
+	}
+	if err := validateOperations(operations); err != nil {
+		return tufdata.Signed{}, err
+	}
+
+	if err := validateRuleName(ruleName); err != nil {
+		return tufdata.Signed{}, err
+	}
 	if state.HasFile(ruleName) {
 		return tufdata.Signed{}, fmt.Errorf("metadata for rule %s already exists", ruleName)
 	}
+	if _, err := findRule(state, ruleName); err == nil {
+		return tufdata.Signed{}, fmt.Errorf("rule with name %s already exists", ruleName)
+	}
 
-	roleTargets, err := loadTopLevelTargets(state)
+	roleTargets, parentKeys, err := loadParentRole(state, parentName)
 	if err != nil {
 		return tufdata.Signed{}, err
 	}
+	if bins, err := getSuccinctRoles(roleTargets); err != nil {
+		return tufdata.Signed{}, err
+	} else if bins != nil {
+		return tufdata.Signed{}, fmt.Errorf("rule %s delegates to hash bins %s, rules must be delegated by a bin", parentName, bins.NamePrefix)
+	}
+	for _, signer := range roleSigners {
+		if !isKeyAuthorized(parentKeys, signer.PublicData().IDs()) {
+			return tufdata.Signed{}, fmt.Errorf("key %s is not authorized to sign for %s", signer.PublicData().IDs()[0], parentName)
+		}
+	}
 
 	allowedKeyIds := []string{}
 	allowedKeysMap := map[string]*tufdata.PublicKey{}
@@ -35,19 +67,24 @@ func NewRule(
 		keyIds := k.IDs()
 		allowedKeyIds = append(allowedKeyIds, keyIds...)
 		for _, keyId := range keyIds {
-			allowedKeysMap[keyId] = &tufdata.PublicKey{
-				Type:       k.Type,
-				Scheme:     k.Scheme,
-				Algorithms: k.Algorithms,
-				Value:      k.Value,
-			}
+			allowedKeysMap[keyId] = k
 		}
 	}
 
+	if ruleThreshold < 1 {
+		return tufdata.Signed{}, fmt.Errorf("invalid threshold %d for rule %s", ruleThreshold, ruleName)
+	}
+	if numKeys := countAuthorizedKeys(allowedKeysMap, allowedKeyIds); numKeys < ruleThreshold {
+		return tufdata.Signed{}, fmt.Errorf("threshold %d for rule %s cannot be met by %d keys", ruleThreshold, ruleName, numKeys)
+	}
+
 	if roleTargets.Delegations == nil {
 		roleTargets.Delegations = &tufdata.Delegations{
 			Keys:  map[string]*tufdata.PublicKey{},
-			Roles: []tufdata.DelegatedRole{createAllowRule()}, // TODO: Is this okay?
+			Roles: []tufdata.DelegatedRole{},
+		}
+		if parentName == "targets" {
+			roleTargets.Delegations.Roles = append(roleTargets.Delegations.Roles, createAllowRule()) // TODO: Is this okay?
 		}
 	}
 	roleDelegations := *roleTargets.Delegations
@@ -77,37 +114,54 @@ func NewRule(
 		KeyIDs:           allowedKeyIds,
 		Threshold:        ruleThreshold,
 		Terminating:      ruleTerminating,
-		PathHashPrefixes: []string{},
+		PathHashPrefixes: pathHashPrefixes,
 		Paths:            protectPaths,
 	}
 
-	roleDelegations.Roles = append(roleDelegations.Roles[:len(roleDelegations.Roles)-1], newRuleDelegation, createAllowRule())
+	// The allow rule, if present, must remain the last rule
+	if n := len(roleDelegations.Roles); n > 0 && roleDelegations.Roles[n-1].Name == AllowRule {
+		roleDelegations.Roles = append(roleDelegations.Roles[:n-1], newRuleDelegation, createAllowRule())
+	} else {
+		roleDelegations.Roles = append(roleDelegations.Roles, newRuleDelegation)
+	}
 	roleTargets.Delegations = &roleDelegations
-
-	roleTargets.Version += 1
-
-	newRoleJson, err := json.Marshal(roleTargets)
-	if err != nil {
+	if err := setRuleOperations(roleTargets, ruleName, operations); err != nil {
 		return tufdata.Signed{}, err
 	}
 
-	newRoleMb := tufdata.Signed{
-		Signed:     newRoleJson,
-		Signatures: []tufdata.Signature{},
-	}
+	roleTargets.Version += 1
 
-	for _, key := range roleKeys {
-		signer, err := tufkeys.GetSigner(&key)
-		if err != nil {
-			return tufdata.Signed{}, err
-		}
-		err = tufsign.Sign(&newRoleMb, signer)
+	return generateAndSignMbFromStruct(roleTargets, roleSigners)
+}
+
+/*
+loadParentRole returns the verified metadata of the role that delegates a new
+rule, along with the keys authorized to sign it. If the parent is a rule
+without metadata, new metadata is returned.
+*/
+func loadParentRole(state *gitstore.State, parentName string) (*tufdata.Targets, map[string]*tufdata.PublicKey, error) {
+	if parentName == "targets" {
+		rootRole, err := loadRoot(state)
 		if err != nil {
-			return tufdata.Signed{}, err
+			return &tufdata.Targets{}, map[string]*tufdata.PublicKey{}, err
 		}
+		keys, _ := getRoleKeysFromRoot(rootRole, "targets")
+		role, err := loadTopLevelTargets(state)
+		return role, keys, err
 	}
 
-	return newRoleMb, nil
+	parent, err := findRule(state, parentName)
+	if err != nil {
+		return &tufdata.Targets{}, map[string]*tufdata.PublicKey{}, err
+	}
+	if parent.isAllowRule() {
+		return &tufdata.Targets{}, map[string]*tufdata.PublicKey{}, fmt.Errorf("rules cannot be delegated by %s", AllowRule)
+	}
+	if !state.HasFile(parentName) {
+		return tufdata.NewTargets(), parent.Keys, nil
+	}
+	role, err := loadSpecificTargets(state, parentName, parent.Keys, parent.Delegation.Threshold)
+	return role, parent.Keys, err
 }
 
 func createAllowRule() tufdata.DelegatedRole {
@@ -119,3 +173,21 @@ func createAllowRule() tufdata.DelegatedRole {
 		Paths:       []string{"*"},
 	}
 }
+
+/*
+validateRuleName checks that a rule does not take the name of another role.
+The metadata of rules is stored alongside that of the top level roles and the
+roles recording branches and tags, so rules cannot use their names.
+*/
+func validateRuleName(ruleName string) error {
+	switch ruleName {
+	case "":
+		return fmt.Errorf("rule name must be specified")
+	case "root", "targets", gitstore.SnapshotRole, TimestampRole, AllowRule:
+		return fmt.Errorf("rule name %s is reserved", ruleName)
+	}
+	if _, ok := getTargetForRoleName(ruleName); ok {
+		return fmt.Errorf("rule name %s is reserved for roles recording branches and tags", ruleName)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package gittuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+const (
+	KeyTypeOpenPGP   tufdata.KeyType   = "openpgp"
+	KeySchemeOpenPGP tufdata.KeyScheme = "openpgp"
+
+	OpenPGPKeyringSignerPrefix = "openpgp:"
+	GPGSignerPrefix            = "gpg:"
+
+	openpgpArmorHeader = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+)
+
+func init() {
+	tufkeys.VerifierMap.Store(KeyTypeOpenPGP, newOpenPGPVerifier)
+}
+
+/*
+openpgpVerifier verifies detached binary OpenPGP signatures. The key value
+holds the armored public key, normalized by newPublicKeyFromOpenPGP so that
+the same OpenPGP key always has the same TUF key ID.
+*/
+type openpgpVerifier struct {
+	PublicKey string `json:"public"`
+	keyring   openpgp.EntityList
+	key       *tufdata.PublicKey
+}
+
+func newOpenPGPVerifier() tufkeys.Verifier {
+	return &openpgpVerifier{}
+}
+
+func (v *openpgpVerifier) Public() string {
+	return v.PublicKey
+}
+
+func (v *openpgpVerifier) Verify(msg, sig []byte) error {
+	_, err := openpgp.CheckDetachedSignature(v.keyring, bytes.NewReader(msg), bytes.NewReader(sig), nil)
+	return err
+}
+
+func (v *openpgpVerifier) MarshalPublicKey() *tufdata.PublicKey {
+	return v.key
+}
+
+func (v *openpgpVerifier) UnmarshalPublicKey(key *tufdata.PublicKey) error {
+	if err := json.Unmarshal(key.Value, v); err != nil {
+		return err
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader([]byte(v.PublicKey)))
+	if err != nil {
+		return err
+	}
+	if len(keyring) != 1 {
+		return fmt.Errorf("expected one OpenPGP key, found %d", len(keyring))
+	}
+	v.keyring = keyring
+	v.key = key
+	return nil
+}
+
+// parseOpenPGPPublicKey reads an armored or binary OpenPGP public key.
+func parseOpenPGPPublicKey(contents []byte) (*tufdata.PublicKey, error) {
+	var (
+		keyring openpgp.EntityList
+		err     error
+	)
+	if bytes.Contains(contents, []byte(openpgpArmorHeader)) {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(contents))
+	} else {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(contents))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(keyring) != 1 {
+		return nil, fmt.Errorf("expected one OpenPGP key, found %d", len(keyring))
+	}
+	return newPublicKeyFromOpenPGP(keyring[0])
+}
+
+/*
+checkOpenPGPEntity checks that the OpenPGP key is usable: it must not be
+revoked, must have at least one self-signed identity, and must not have
+expired according to the self-signature of its primary identity.
+*/
+func checkOpenPGPEntity(entity *openpgp.Entity) error {
+	keyID := entity.PrimaryKey.KeyIdString()
+	if len(entity.Revocations) > 0 {
+		return fmt.Errorf("OpenPGP key %s is revoked", keyID)
+	}
+
+	var primary *openpgp.Identity
+	for _, name := range getSelfSignedIdentities(entity) {
+		identity := entity.Identities[name]
+		if primary == nil || (identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId) {
+			primary = identity
+		}
+	}
+	if primary == nil {
+		return fmt.Errorf("OpenPGP key %s has no self-signed identity", keyID)
+	}
+	if entity.PrimaryKey.KeyExpired(primary.SelfSignature, time.Now()) {
+		return fmt.Errorf("OpenPGP key %s has expired", keyID)
+	}
+	return nil
+}
+
+// getSelfSignedIdentities returns the names of the identities of the OpenPGP
+// key that have a self-signature, sorted.
+func getSelfSignedIdentities(entity *openpgp.Entity) []string {
+	identities := []string{}
+	for name, identity := range entity.Identities {
+		if identity.UserId != nil && identity.SelfSignature != nil {
+			identities = append(identities, name)
+		}
+	}
+	sort.Strings(identities)
+	return identities
+}
+
+/*
+newPublicKeyFromOpenPGP returns the TUF representation of an OpenPGP key. The
+key is re-serialized with just its self-signed identities and subkeys so that
+third party certifications or the tool used to export the key do not change
+its key ID. Revoked and expired keys are rejected, as their revocation or
+expiry would be lost.
+*/
+func newPublicKeyFromOpenPGP(entity *openpgp.Entity) (*tufdata.PublicKey, error) {
+	if err := checkOpenPGPEntity(entity); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := entity.PrimaryKey.Serialize(w); err != nil {
+		return nil, err
+	}
+
+	for _, name := range getSelfSignedIdentities(entity) {
+		identity := entity.Identities[name]
+		if err := identity.UserId.Serialize(w); err != nil {
+			return nil, err
+		}
+		if err := identity.SelfSignature.Serialize(w); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, subkey := range entity.Subkeys {
+		if subkey.PublicKey == nil || subkey.Sig == nil {
+			continue
+		}
+		if err := subkey.PublicKey.Serialize(w); err != nil {
+			return nil, err
+		}
+		if err := subkey.Sig.Serialize(w); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	value, err := json.Marshal(map[string]string{sslibPublicField: buf.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tufdata.PublicKey{
+		Type:   KeyTypeOpenPGP,
+		Scheme: KeySchemeOpenPGP,
+		Value:  value,
+	}, nil
+}
+
+/*
+openpgpKeyringSigner signs with a secret key read from an OpenPGP keyring
+file, such as one exported with gpg --export-secret-keys.
+*/
+type openpgpKeyringSigner struct {
+	entity    *openpgp.Entity
+	publicKey *tufdata.PublicKey
+}
+
+// NewOpenPGPKeyringSigner returns a signer for the first secret key in the
+// armored or binary keyring at the specified path.
+func NewOpenPGPKeyringSigner(path string) (tufkeys.Signer, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyring openpgp.EntityList
+	if bytes.Contains(contents, []byte("-----BEGIN PGP")) {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(contents))
+	} else {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(contents))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if err := checkOpenPGPEntity(entity); err != nil {
+			return nil, err
+		}
+		signingKey, ok := entity.SigningKey(time.Now())
+		if !ok || signingKey.PrivateKey == nil {
+			continue
+		}
+		if signingKey.PrivateKey.Encrypted {
+			passphrase, err := GetPassphrase(fmt.Sprintf("Enter passphrase for OpenPGP key in %s: ", path))
+			if err != nil {
+				return nil, err
+			}
+			if err := signingKey.PrivateKey.Decrypt(passphrase); err != nil {
+				return nil, fmt.Errorf("unable to decrypt OpenPGP key in %s: %w", path, err)
+			}
+		}
+
+		pubKey, err := newPublicKeyFromOpenPGP(entity)
+		if err != nil {
+			return nil, err
+		}
+		return &openpgpKeyringSigner{entity: entity, publicKey: pubKey}, nil
+	}
+
+	return nil, fmt.Errorf("no OpenPGP signing key found in %s", path)
+}
+
+func (s *openpgpKeyringSigner) PublicData() *tufdata.PublicKey {
+	return s.publicKey
+}
+
+func (s *openpgpKeyringSigner) SignMessage(message []byte) ([]byte, error) {
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, s.entity, bytes.NewReader(message), nil); err != nil {
+		return nil, err
+	}
+	return sig.Bytes(), nil
+}
+
+func (s *openpgpKeyringSigner) MarshalPrivateKey() (*tufdata.PrivateKey, error) {
+	return nil, fmt.Errorf("OpenPGP private keys cannot be exported")
+}
+
+func (s *openpgpKeyringSigner) UnmarshalPrivateKey(key *tufdata.PrivateKey) error {
+	return fmt.Errorf("private keys cannot be loaded into OpenPGP signers")
+}
+
+/*
+gpgSigner signs using the gpg binary, so secret keys may stay in gpg-agent or
+on a smartcard. This mirrors how Git itself creates OpenPGP signatures.
+*/
+type gpgSigner struct {
+	keyID     string
+	publicKey *tufdata.PublicKey
+}
+
+// NewGPGSigner returns a signer for the key with the specified ID or
+// fingerprint in the user's gpg keyring.
+func NewGPGSigner(keyID string) (tufkeys.Signer, error) {
+	exported, err := runGPG(nil, "--export", keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(exported) == 0 {
+		return nil, fmt.Errorf("key %s not found in gpg keyring", keyID)
+	}
+
+	pubKey, err := parseOpenPGPPublicKey(exported)
+	if err != nil {
+		return nil, err
+	}
+	return &gpgSigner{keyID: keyID, publicKey: pubKey}, nil
+}
+
+func (s *gpgSigner) PublicData() *tufdata.PublicKey {
+	return s.publicKey
+}
+
+func (s *gpgSigner) SignMessage(message []byte) ([]byte, error) {
+	return runGPG(bytes.NewReader(message), "--detach-sign", "--local-user", s.keyID, "--output", "-")
+}
+
+func (s *gpgSigner) MarshalPrivateKey() (*tufdata.PrivateKey, error) {
+	return nil, fmt.Errorf("private keys held by gpg cannot be exported")
+}
+
+func (s *gpgSigner) UnmarshalPrivateKey(key *tufdata.PrivateKey) error {
+	return fmt.Errorf("private keys cannot be loaded into gpg signers")
+}
+
+func runGPG(stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("gpg", append([]string{"--batch", "--no-tty"}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("gpg failed: %s", bytes.TrimSpace(stderr.Bytes()))
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
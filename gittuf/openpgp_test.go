@@ -0,0 +1,198 @@
+package gittuf
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufsign "github.com/theupdateframework/go-tuf/sign"
+)
+
+// newTestOpenPGPEntity generates an OpenPGP key created at the specified
+// time. A lifetime of zero means the key does not expire.
+func newTestOpenPGPEntity(t *testing.T, algorithm packet.PublicKeyAlgorithm, created time.Time, lifetimeSecs uint32) *openpgp.Entity {
+	t.Helper()
+	config := &packet.Config{
+		Algorithm:       algorithm,
+		KeyLifetimeSecs: lifetimeSecs,
+		Time:            func() time.Time { return created },
+	}
+	entity, err := openpgp.NewEntity("Alice", "", "alice@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entity
+}
+
+/*
+serializeTestOpenPGPEntity returns the armored key of the entity, including
+its revocations. The secret key is included if private is set. Each subkey is
+followed by its signature.
+*/
+func serializeTestOpenPGPEntity(t *testing.T, entity *openpgp.Entity, private bool) []byte {
+	t.Helper()
+	blockType := openpgp.PublicKeyType
+	if private {
+		blockType = openpgp.PrivateKeyType
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if private {
+		err = entity.PrivateKey.Serialize(w)
+	} else {
+		err = entity.PrimaryKey.Serialize(w)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, revocation := range entity.Revocations {
+		if err := revocation.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, identity := range entity.Identities {
+		if err := identity.UserId.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		if err := identity.SelfSignature.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, subkey := range entity.Subkeys {
+		if private {
+			err = subkey.PrivateKey.Serialize(w)
+		} else {
+			err = subkey.PublicKey.Serialize(w)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := subkey.Sig.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestOpenPGPEntities(t *testing.T) map[string]*openpgp.Entity {
+	t.Helper()
+	// go-crypto only creates key revocation signatures with RSA keys
+	revoked := newTestOpenPGPEntity(t, packet.PubKeyAlgoRSA, time.Now(), 0)
+	if err := revoked.RevokeKey(packet.KeyCompromised, "compromised", nil); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*openpgp.Entity{
+		"valid":   newTestOpenPGPEntity(t, packet.PubKeyAlgoEdDSA, time.Now(), 0),
+		"revoked": revoked,
+		"expired": newTestOpenPGPEntity(t, packet.PubKeyAlgoEdDSA, time.Now().Add(-2*time.Hour), 3600),
+	}
+}
+
+func TestParseOpenPGPPublicKey(t *testing.T) {
+	entities := newTestOpenPGPEntities(t)
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{name: "valid"},
+		{name: "revoked", err: "is revoked"},
+		{name: "expired", err: "has expired"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			armored := serializeTestOpenPGPEntity(t, entities[test.name], false)
+			pubKey, err := parseOpenPGPPublicKey(armored)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pubKey.Type != KeyTypeOpenPGP {
+				t.Fatalf("expected key type %s, got %s", KeyTypeOpenPGP, pubKey.Type)
+			}
+
+			// Third party certifications do not change the key ID
+			certifier := newTestOpenPGPEntity(t, packet.PubKeyAlgoEdDSA, time.Now(), 0)
+			entity := entities[test.name]
+			for name := range entity.Identities {
+				if err := entity.SignIdentity(name, certifier, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var certified bytes.Buffer
+			if err := entity.Serialize(&certified); err != nil {
+				t.Fatal(err)
+			}
+			certifiedKey, err := parseOpenPGPPublicKey(certified.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if certifiedKey.IDs()[0] != pubKey.IDs()[0] {
+				t.Fatalf("expected key ID %s, got %s", pubKey.IDs()[0], certifiedKey.IDs()[0])
+			}
+		})
+	}
+}
+
+func TestOpenPGPKeyringSigner(t *testing.T) {
+	entities := newTestOpenPGPEntities(t)
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{name: "valid"},
+		{name: "revoked", err: "is revoked"},
+		{name: "expired", err: "has expired"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "key.asc")
+			if err := os.WriteFile(path, serializeTestOpenPGPEntity(t, entities[test.name], true), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			signer, err := LoadSigner(OpenPGPKeyringSignerPrefix + path)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mb := tufdata.Signed{Signed: []byte(`{"_type":"targets"}`)}
+			if err := tufsign.Sign(&mb, signer); err != nil {
+				t.Fatal(err)
+			}
+			pubKey := signer.PublicData()
+			keys := map[string]*tufdata.PublicKey{}
+			for _, keyID := range pubKey.IDs() {
+				keys[keyID] = pubKey
+			}
+			if err := verifySignatures(&mb, keys, 1); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
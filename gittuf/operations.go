@@ -0,0 +1,344 @@
+package gittuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+)
+
+/*
+Operations on files and refs that rules can authorize. Every change is a
+create, modify, delete, rename, or copy. A change may also be a mode change,
+which changes the mode of an existing file such as its executable bit, a
+symlink change, which writes a symlink, or a submodule change, which adds,
+updates, or removes a submodule. A rule must authorize all of a change's
+operations.
+*/
+const (
+	OperationCreate    = "create"
+	OperationModify    = "modify"
+	OperationDelete    = "delete"
+	OperationRename    = "rename"
+	OperationCopy      = "copy"
+	OperationMode      = "mode"
+	OperationSymlink   = "symlink"
+	OperationSubmodule = "submodule"
+)
+
+// AllOperations lists every operation, in the order they are displayed.
+var AllOperations = []string{OperationCreate, OperationModify, OperationDelete, OperationRename, OperationCopy, OperationMode, OperationSymlink, OperationSubmodule}
+
+/*
+ExternalSymlinkTarget is the path checked for symlinks that point outside the
+repository, including absolute symlinks. Rules cannot protect the paths such
+symlinks point to, so writing them is authorized by the rules protecting this
+path instead, which by default is only the allow rule.
+*/
+const ExternalSymlinkTarget = "symlink:external"
+
+// renameScore is the similarity, as a percentage, above which a deleted and
+// an added file are treated as a rename. It is the same for staged changes
+// and for changes between states.
+const renameScore = 60
+
+/*
+fileChange is a change to a file, classified by operation. From is empty for
+created files and To is empty for deleted files. A renamed file is removed
+from From, while a copied file leaves From unchanged. The modes are those of
+the tree entries, and are empty for the missing side of the change and for
+the source of a copy. LinkTarget is the path a symlink written by the change
+points to, relative to the root of the repository, or ExternalSymlinkTarget.
+*/
+type fileChange struct {
+	Operation  string
+	From       string
+	To         string
+	FromMode   filemode.FileMode
+	ToMode     filemode.FileMode
+	LinkTarget string
+}
+
+/*
+paths returns the paths a rule must authorize the change's operations for.
+Both sides of a rename are checked, so that a rename can neither remove a
+file from nor write a file into a protected namespace. The target of a
+symlink is checked too, so that a symlink cannot expose a protected path
+under an unprotected name.
+*/
+func (c *fileChange) paths() []string {
+	var paths []string
+	switch c.Operation {
+	case OperationCreate, OperationCopy:
+		paths = []string{c.To}
+	case OperationDelete:
+		paths = []string{c.From}
+	case OperationRename:
+		paths = []string{c.From, c.To}
+	default:
+		paths = []string{c.To}
+	}
+	if len(c.LinkTarget) > 0 && c.LinkTarget != c.To {
+		paths = append(paths, c.LinkTarget)
+	}
+	return paths
+}
+
+// operations returns every operation a rule must authorize for the change.
+func (c *fileChange) operations() []string {
+	operations := []string{c.Operation}
+	if c.FromMode != filemode.Empty && c.ToMode != filemode.Empty && normalizeMode(c.FromMode) != normalizeMode(c.ToMode) {
+		operations = append(operations, OperationMode)
+	}
+	if c.ToMode == filemode.Symlink {
+		operations = append(operations, OperationSymlink)
+	}
+	if c.FromMode == filemode.Submodule || c.ToMode == filemode.Submodule {
+		operations = append(operations, OperationSubmodule)
+	}
+	return operations
+}
+
+// normalizeMode treats the deprecated group writeable mode as a regular file,
+// the way git does.
+func normalizeMode(mode filemode.FileMode) filemode.FileMode {
+	if mode == filemode.Deprecated {
+		return filemode.Regular
+	}
+	return mode
+}
+
+// validateOperations checks that every operation is known and listed once.
+func validateOperations(operations []string) error {
+	seen := map[string]bool{}
+	for _, operation := range operations {
+		if !containsString(AllOperations, operation) {
+			return fmt.Errorf("unknown operation %s, must be one of %s", operation, strings.Join(AllOperations, ", "))
+		}
+		if seen[operation] {
+			return fmt.Errorf("operation %s is listed more than once", operation)
+		}
+		seen[operation] = true
+	}
+	return nil
+}
+
+/*
+disallowedOperations returns the operations that a rule with the rule
+operations does not authorize. A rule that lists no operations authorizes all
+of them.
+*/
+func disallowedOperations(ruleOperations []string, operations []string) []string {
+	disallowed := []string{}
+	if len(ruleOperations) == 0 {
+		return disallowed
+	}
+	for _, operation := range operations {
+		if !containsString(ruleOperations, operation) {
+			disallowed = append(disallowed, operation)
+		}
+	}
+	return disallowed
+}
+
+// getRuleOperations returns the operations of each rule the role delegates
+// that is limited to some operations.
+func getRuleOperations(role *tufdata.Targets) (map[string][]string, error) {
+	if role.Custom == nil {
+		return map[string][]string{}, nil
+	}
+	var custom targetsCustom
+	if err := json.Unmarshal(*role.Custom, &custom); err != nil {
+		return map[string][]string{}, err
+	}
+	if custom.RuleOperations == nil {
+		return map[string][]string{}, nil
+	}
+	return custom.RuleOperations, nil
+}
+
+// setRuleOperations records the operations of a rule the role delegates. No
+// operations means the rule authorizes all of them.
+func setRuleOperations(role *tufdata.Targets, ruleName string, operations []string) error {
+	ruleOperations, err := getRuleOperations(role)
+	if err != nil {
+		return err
+	}
+	if len(operations) == 0 {
+		delete(ruleOperations, ruleName)
+	} else {
+		ruleOperations[ruleName] = operations
+	}
+	return replaceRuleOperations(role, ruleOperations)
+}
+
+// replaceRuleOperations records the operations of every rule the role
+// delegates that is limited to some operations.
+func replaceRuleOperations(role *tufdata.Targets, ruleOperations map[string][]string) error {
+	var custom targetsCustom
+	if role.Custom != nil {
+		if err := json.Unmarshal(*role.Custom, &custom); err != nil {
+			return err
+		}
+	}
+	custom.RuleOperations = nil
+	if len(ruleOperations) > 0 {
+		custom.RuleOperations = ruleOperations
+	}
+
+	if custom.SuccinctRoles == nil && custom.RuleOperations == nil {
+		role.Custom = nil
+		return nil
+	}
+	contents, err := json.Marshal(custom)
+	if err != nil {
+		return err
+	}
+	raw := json.RawMessage(contents)
+	role.Custom = &raw
+	return nil
+}
+
+// emptyTreeID and emptyBlobID are the IDs of the empty tree and the empty
+// file, which git recognizes even if the repository does not contain them.
+const (
+	emptyTreeID = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	emptyBlobID = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+)
+
+/*
+diffTrees returns the changes between two trees of the repository. Changes
+are detected by git using the same options as getStagedChanges, so a change
+is classified the same way when it is committed and when it is verified.
+*/
+func diffTrees(from *object.Tree, to *object.Tree) ([]*fileChange, error) {
+	return getRawDiff("diff-tree", "-r", getTreeID(from), getTreeID(to))
+}
+
+/*
+getStagedChanges returns the changes staged for the next commit. Renames are
+files at least renameScore percent similar to a deleted file. Only identical
+files are reported as copies, and any file in the last commit may be the
+source of a copy. New empty files are created rather than copied, as any
+empty file would be their source. Git does not pair symlinks or submodules
+with regular files.
+*/
+func getStagedChanges() ([]*fileChange, error) {
+	return getRawDiff("diff", "--cached")
+}
+
+func getTreeID(tree *object.Tree) string {
+	if tree == nil || tree.Hash.IsZero() {
+		return emptyTreeID
+	}
+	return tree.Hash.String()
+}
+
+// getRawDiff runs the git diff command with the options used to classify
+// changes and parses its output.
+func getRawDiff(command string, args ...string) ([]*fileChange, error) {
+	cmd := exec.Command("git", append([]string{command, "--raw", "-z", "--no-abbrev", "--ignore-submodules=none",
+		fmt.Sprintf("--find-renames=%d%%", renameScore), "--find-copies=100%", "--find-copies-harder"}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return []*fileChange{}, fmt.Errorf("unable to list changes: %w: %s", err, stderr.String())
+	}
+	return parseRawDiff(stdout.String())
+}
+
+/*
+parseRawDiff parses the changes listed by git diff --raw -z. Each change is
+of the form ":<old mode> <new mode> <old ID> <new ID> <status>" followed by
+its path, or by both paths for renames and copies.
+*/
+func parseRawDiff(output string) ([]*fileChange, error) {
+	fields := strings.Split(strings.TrimSuffix(output, "\x00"), "\x00")
+	changes := []*fileChange{}
+	for i := 0; i < len(fields) && len(fields[i]) > 0; {
+		info := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(info) != 5 || i+1 >= len(fields) {
+			return []*fileChange{}, fmt.Errorf("unexpected output listing changes")
+		}
+		fromMode, err := filemode.New(info[0])
+		if err != nil {
+			return []*fileChange{}, err
+		}
+		toMode, err := filemode.New(info[1])
+		if err != nil {
+			return []*fileChange{}, err
+		}
+
+		var change *fileChange
+		status := info[4][0]
+		switch status {
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return []*fileChange{}, fmt.Errorf("unexpected output listing changes")
+			}
+			change = &fileChange{Operation: OperationRename, From: fields[i+1], To: fields[i+2], FromMode: fromMode, ToMode: toMode}
+			if status == 'C' {
+				change.Operation = OperationCopy
+				change.FromMode = filemode.Empty
+				if info[3] == emptyBlobID {
+					change.Operation = OperationCreate
+					change.From = ""
+				}
+			}
+			i++
+		case 'A':
+			change = &fileChange{Operation: OperationCreate, To: fields[i+1], ToMode: toMode}
+		case 'D':
+			change = &fileChange{Operation: OperationDelete, From: fields[i+1], FromMode: fromMode}
+		default:
+			change = &fileChange{Operation: OperationModify, From: fields[i+1], To: fields[i+1], FromMode: fromMode, ToMode: toMode}
+		}
+		i += 2
+
+		if change.ToMode == filemode.Symlink {
+			target, err := readSymlinkTarget(info[3])
+			if err != nil {
+				return []*fileChange{}, err
+			}
+			change.LinkTarget = resolveSymlinkTarget(change.To, target)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// readSymlinkTarget returns the target stored in the blob of a symlink.
+func readSymlinkTarget(blobID string) (string, error) {
+	cmd := exec.Command("git", "cat-file", "blob", blobID)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("unable to read symlink %s: %w: %s", blobID, err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+/*
+resolveSymlinkTarget returns the path, relative to the root of the
+repository, of the target of the symlink at linkPath. Targets are relative to
+the directory of the symlink. Absolute targets and targets outside the
+repository resolve to ExternalSymlinkTarget.
+*/
+func resolveSymlinkTarget(linkPath string, target string) string {
+	if path.IsAbs(target) {
+		return ExternalSymlinkTarget
+	}
+	resolved := path.Clean(path.Join(path.Dir(linkPath), target))
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return ExternalSymlinkTarget
+	}
+	return resolved
+}
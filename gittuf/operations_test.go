@@ -0,0 +1,224 @@
+package gittuf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+func TestFileChangeOperations(t *testing.T) {
+	tests := []struct {
+		name       string
+		change     fileChange
+		operations []string
+		paths      []string
+	}{
+		{name: "create", change: fileChange{Operation: OperationCreate, To: "a", ToMode: filemode.Regular}, operations: []string{OperationCreate}, paths: []string{"a"}},
+		{name: "modify", change: fileChange{Operation: OperationModify, From: "a", To: "a", FromMode: filemode.Regular, ToMode: filemode.Regular}, operations: []string{OperationModify}, paths: []string{"a"}},
+		{name: "delete", change: fileChange{Operation: OperationDelete, From: "a", FromMode: filemode.Regular}, operations: []string{OperationDelete}, paths: []string{"a"}},
+		{name: "rename", change: fileChange{Operation: OperationRename, From: "a", To: "b", FromMode: filemode.Regular, ToMode: filemode.Regular}, operations: []string{OperationRename}, paths: []string{"a", "b"}},
+		{name: "copy", change: fileChange{Operation: OperationCopy, From: "a", To: "b", ToMode: filemode.Regular}, operations: []string{OperationCopy}, paths: []string{"b"}},
+		{name: "executable", change: fileChange{Operation: OperationModify, From: "a", To: "a", FromMode: filemode.Regular, ToMode: filemode.Executable}, operations: []string{OperationModify, OperationMode}, paths: []string{"a"}},
+		{name: "deprecated mode", change: fileChange{Operation: OperationModify, From: "a", To: "a", FromMode: filemode.Deprecated, ToMode: filemode.Regular}, operations: []string{OperationModify}, paths: []string{"a"}},
+		{name: "rename and mode", change: fileChange{Operation: OperationRename, From: "a", To: "b", FromMode: filemode.Regular, ToMode: filemode.Executable}, operations: []string{OperationRename, OperationMode}, paths: []string{"a", "b"}},
+		{name: "symlink", change: fileChange{Operation: OperationCreate, To: "l", ToMode: filemode.Symlink, LinkTarget: "src/a"}, operations: []string{OperationCreate, OperationSymlink}, paths: []string{"l", "src/a"}},
+		{name: "symlink outside repository", change: fileChange{Operation: OperationCreate, To: "l", ToMode: filemode.Symlink, LinkTarget: ExternalSymlinkTarget}, operations: []string{OperationCreate, OperationSymlink}, paths: []string{"l", ExternalSymlinkTarget}},
+		{name: "file to symlink", change: fileChange{Operation: OperationModify, From: "l", To: "l", FromMode: filemode.Regular, ToMode: filemode.Symlink, LinkTarget: "a"}, operations: []string{OperationModify, OperationMode, OperationSymlink}, paths: []string{"l", "a"}},
+		{name: "symlink to itself", change: fileChange{Operation: OperationCreate, To: "l", ToMode: filemode.Symlink, LinkTarget: "l"}, operations: []string{OperationCreate, OperationSymlink}, paths: []string{"l"}},
+		{name: "submodule", change: fileChange{Operation: OperationModify, From: "m", To: "m", FromMode: filemode.Submodule, ToMode: filemode.Submodule}, operations: []string{OperationModify, OperationSubmodule}, paths: []string{"m"}},
+		{name: "submodule removed", change: fileChange{Operation: OperationDelete, From: "m", FromMode: filemode.Submodule}, operations: []string{OperationDelete, OperationSubmodule}, paths: []string{"m"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if operations := test.change.operations(); !reflect.DeepEqual(operations, test.operations) {
+				t.Errorf("expected operations %v, got %v", test.operations, operations)
+			}
+			if paths := test.change.paths(); !reflect.DeepEqual(paths, test.paths) {
+				t.Errorf("expected paths %v, got %v", test.paths, paths)
+			}
+		})
+	}
+}
+
+func TestResolveSymlinkTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		linkPath string
+		target   string
+		expected string
+	}{
+		{name: "sibling", linkPath: "src/l", target: "a", expected: "src/a"},
+		{name: "parent directory", linkPath: "src/l", target: "../docs/a", expected: "docs/a"},
+		{name: "redundant elements", linkPath: "src/l", target: "./x/../a", expected: "src/a"},
+		{name: "root of repository", linkPath: "src/l", target: "..", expected: "."},
+		{name: "outside repository", linkPath: "src/l", target: "../../a", expected: ExternalSymlinkTarget},
+		{name: "outside repository from root", linkPath: "l", target: "..", expected: ExternalSymlinkTarget},
+		{name: "absolute", linkPath: "l", target: "/etc/passwd", expected: ExternalSymlinkTarget},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if resolved := resolveSymlinkTarget(test.linkPath, test.target); resolved != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, resolved)
+			}
+		})
+	}
+}
+
+func TestParseRawDiff(t *testing.T) {
+	const (
+		blobA = "1111111111111111111111111111111111111111"
+		blobB = "2222222222222222222222222222222222222222"
+		zero  = "0000000000000000000000000000000000000000"
+	)
+	tests := []struct {
+		name     string
+		output   string
+		expected []*fileChange
+		err      bool
+	}{
+		{name: "no changes", output: "", expected: []*fileChange{}},
+		{
+			name:     "create",
+			output:   ":000000 100644 " + zero + " " + blobA + " A\x00a\x00",
+			expected: []*fileChange{{Operation: OperationCreate, To: "a", ToMode: filemode.Regular}},
+		},
+		{
+			name:     "modify and delete",
+			output:   ":100644 100755 " + blobA + " " + blobB + " M\x00a\x00:100644 000000 " + blobB + " " + zero + " D\x00b\x00",
+			expected: []*fileChange{{Operation: OperationModify, From: "a", To: "a", FromMode: filemode.Regular, ToMode: filemode.Executable}, {Operation: OperationDelete, From: "b", FromMode: filemode.Regular}},
+		},
+		{
+			name:     "rename",
+			output:   ":100644 100644 " + blobA + " " + blobB + " R075\x00a\x00b\x00",
+			expected: []*fileChange{{Operation: OperationRename, From: "a", To: "b", FromMode: filemode.Regular, ToMode: filemode.Regular}},
+		},
+		{
+			name:     "copy",
+			output:   ":100644 100644 " + blobA + " " + blobA + " C100\x00a\x00b\x00",
+			expected: []*fileChange{{Operation: OperationCopy, From: "a", To: "b", ToMode: filemode.Regular}},
+		},
+		{
+			name:     "copy of empty file",
+			output:   ":100644 100644 " + emptyBlobID + " " + emptyBlobID + " C100\x00a\x00b\x00",
+			expected: []*fileChange{{Operation: OperationCreate, To: "b", ToMode: filemode.Regular}},
+		},
+		{name: "truncated rename", output: ":100644 100644 " + blobA + " " + blobB + " R075\x00a\x00", err: true},
+		{name: "malformed", output: ":100644 " + blobA + " M\x00a\x00", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := parseRawDiff(test.output)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected output to be rejected, got %v", changes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(changes, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, changes)
+			}
+		})
+	}
+}
+
+func TestGetStagedChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		stage    func(t *testing.T, dir string)
+		expected []fileChange
+	}{
+		{
+			name: "rename",
+			stage: func(t *testing.T, dir string) {
+				runGit(t, dir, "mv", "src/a", "src/moved")
+			},
+			expected: []fileChange{{Operation: OperationRename, From: "src/a", To: "src/moved", FromMode: filemode.Regular, ToMode: filemode.Regular}},
+		},
+		{
+			name: "copy of unchanged file",
+			stage: func(t *testing.T, dir string) {
+				writeTestFile(t, dir, "docs/a", "contents of a\n")
+			},
+			expected: []fileChange{{Operation: OperationCopy, From: "src/a", To: "docs/a", ToMode: filemode.Regular}},
+		},
+		{
+			name: "new empty file",
+			stage: func(t *testing.T, dir string) {
+				writeTestFile(t, dir, "docs/empty", "")
+			},
+			expected: []fileChange{{Operation: OperationCreate, To: "docs/empty", ToMode: filemode.Regular}},
+		},
+		{
+			name: "symlink",
+			stage: func(t *testing.T, dir string) {
+				if err := os.Symlink("../src/a", filepath.Join(dir, "docs", "link")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expected: []fileChange{{Operation: OperationCreate, To: "docs/link", ToMode: filemode.Symlink, LinkTarget: "src/a"}},
+		},
+		{
+			name: "symlink outside repository",
+			stage: func(t *testing.T, dir string) {
+				if err := os.Symlink("/etc/passwd", filepath.Join(dir, "docs", "link")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expected: []fileChange{{Operation: OperationCreate, To: "docs/link", ToMode: filemode.Symlink, LinkTarget: ExternalSymlinkTarget}},
+		},
+		{
+			name: "executable",
+			stage: func(t *testing.T, dir string) {
+				if err := os.Chmod(filepath.Join(dir, "src", "a"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expected: []fileChange{{Operation: OperationModify, From: "src/a", To: "src/a", FromMode: filemode.Regular, ToMode: filemode.Executable}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			chdirTest(t, dir)
+			runGit(t, dir, "init", "-q", "-b", "main")
+			writeTestFile(t, dir, "src/a", "contents of a\n")
+			writeTestFile(t, dir, "docs/readme", "readme\n")
+			runGit(t, dir, "add", "-A")
+			runGit(t, dir, "commit", "-q", "-m", "initial")
+
+			test.stage(t, dir)
+			runGit(t, dir, "add", "-A")
+			changes, err := getStagedChanges()
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := []fileChange{}
+			for _, c := range changes {
+				actual = append(actual, *c)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+
+}
+
+// writeTestFile writes the file at the slash separated path in dir, creating
+// its parent directories.
+func writeTestFile(t *testing.T, dir string, path string, contents string) {
+	t.Helper()
+	fullPath := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fullPath, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,92 @@
+package gittuf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/term"
+)
+
+const (
+	PassphraseEnvVar   = "GITTUF_PASSPHRASE"
+	PassphraseFDEnvVar = "GITTUF_PASSPHRASE_FD"
+)
+
+// passphraseFromFD caches the passphrase read from GITTUF_PASSPHRASE_FD as the
+// descriptor can only be read once.
+var passphraseFromFD []byte
+
+/*
+GetPassphrase returns the passphrase used to decrypt a private key. It is read
+from the GITTUF_PASSPHRASE environment variable if set, or from the first line
+of the file descriptor specified in GITTUF_PASSPHRASE_FD. Otherwise, the user
+is prompted for it on the terminal.
+*/
+func GetPassphrase(prompt string) ([]byte, error) {
+	if passphrase, set := os.LookupEnv(PassphraseEnvVar); set {
+		return []byte(passphrase), nil
+	}
+
+	if fdString, set := os.LookupEnv(PassphraseFDEnvVar); set {
+		if passphraseFromFD != nil {
+			return passphraseFromFD, nil
+		}
+
+		fd, err := strconv.Atoi(fdString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file descriptor %s in %s", fdString, PassphraseFDEnvVar)
+		}
+		line, err := bufio.NewReader(os.NewFile(uintptr(fd), PassphraseFDEnvVar)).ReadBytes('\n')
+		if err != nil && len(line) == 0 {
+			return nil, fmt.Errorf("unable to read passphrase from file descriptor %d: %w", fd, err)
+		}
+		passphraseFromFD = bytes.TrimRight(line, "\r\n")
+		return passphraseFromFD, nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("passphrase required but no terminal available, set %s or %s", PassphraseEnvVar, PassphraseFDEnvVar)
+	}
+	return readFromTerminal(prompt)
+}
+
+/*
+GetNewPassphrase returns the passphrase used to encrypt a new private key. It
+is read from the same sources as GetPassphrase, but the user must enter it
+twice when prompted on the terminal.
+*/
+func GetNewPassphrase() ([]byte, error) {
+	passphrase, err := GetPassphrase("Enter passphrase for new key: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+
+	_, fromEnv := os.LookupEnv(PassphraseEnvVar)
+	_, fromFD := os.LookupEnv(PassphraseFDEnvVar)
+	if fromEnv || fromFD {
+		return passphrase, nil
+	}
+
+	confirmation, err := GetPassphrase("Confirm passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, confirmation) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// readFromTerminal prompts for a secret on the terminal without echoing it.
+func readFromTerminal(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return secret, err
+}
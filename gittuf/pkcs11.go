@@ -0,0 +1,123 @@
+package gittuf
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	PKCS11SignerPrefix = "pkcs11:"
+	PKCS11PINEnvVar    = "GITTUF_PKCS11_PIN"
+)
+
+/*
+pkcs11URI holds the attributes of an RFC 7512 PKCS#11 URI that gittuf uses to
+find a signing key, for example:
+
+	pkcs11:token=gittuf;object=root?module-path=/usr/lib/softhsm/libsofthsm2.so
+
+The token may be selected using its label, its slot-id, or both. The key is
+selected using the object label, the id, or both.
+*/
+type pkcs11URI struct {
+	modulePath string
+	slotID     *uint
+	token      string
+	object     string
+	id         []byte
+	pin        string
+}
+
+func parsePKCS11URI(uri string) (*pkcs11URI, error) {
+	if !strings.HasPrefix(uri, PKCS11SignerPrefix) {
+		return nil, fmt.Errorf("%s is not a PKCS#11 URI", uri)
+	}
+	uri = strings.TrimPrefix(uri, PKCS11SignerPrefix)
+
+	path, query := uri, ""
+	if i := strings.Index(uri, "?"); i >= 0 {
+		path, query = uri[:i], uri[i+1:]
+	}
+
+	parsed := &pkcs11URI{}
+	for _, attr := range strings.Split(path, ";") {
+		if len(attr) == 0 {
+			continue
+		}
+		name, value, err := splitPKCS11Attribute(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "token":
+			parsed.token = value
+		case "object":
+			parsed.object = value
+		case "id":
+			parsed.id = []byte(value)
+		case "slot-id":
+			slotID, err := strconv.ParseUint(value, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("invalid slot-id %s in PKCS#11 URI", value)
+			}
+			s := uint(slotID)
+			parsed.slotID = &s
+		}
+	}
+
+	for _, attr := range strings.Split(query, "&") {
+		if len(attr) == 0 {
+			continue
+		}
+		name, value, err := splitPKCS11Attribute(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "module-path":
+			parsed.modulePath = value
+		case "pin-value":
+			parsed.pin = value
+		}
+	}
+
+	if len(parsed.modulePath) == 0 {
+		return nil, fmt.Errorf("PKCS#11 URI must specify module-path")
+	}
+	if len(parsed.object) == 0 && len(parsed.id) == 0 {
+		return nil, fmt.Errorf("PKCS#11 URI must specify the key's object or id")
+	}
+
+	return parsed, nil
+}
+
+func splitPKCS11Attribute(attr string) (string, string, error) {
+	parts := strings.SplitN(attr, "=", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid attribute %s in PKCS#11 URI", attr)
+	}
+	value, err := url.PathUnescape(parts[1])
+	if err != nil {
+		return "", "", err
+	}
+	return parts[0], value, nil
+}
+
+func getPKCS11PIN(uri *pkcs11URI) (string, error) {
+	if len(uri.pin) > 0 {
+		return uri.pin, nil
+	}
+	if pin, set := os.LookupEnv(PKCS11PINEnvVar); set {
+		return pin, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("PKCS#11 PIN required but no terminal available, set %s or pin-value in the URI", PKCS11PINEnvVar)
+	}
+	pin, err := readFromTerminal("Enter PIN for PKCS#11 token: ")
+	return string(pin), err
+}
@@ -0,0 +1,344 @@
+//go:build cgo
+
+package gittuf
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unsafe"
+
+	"github.com/miekg/pkcs11"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// These are defined in PKCS#11 v3.0 but not by github.com/miekg/pkcs11.
+const (
+	ckkECEdwards = 0x00000040
+	ckmEdDSA     = 0x00001057
+)
+
+var oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+
+/*
+pkcs11Signer signs TUF metadata using a key stored on a PKCS#11 token, such as
+a hardware security module. The private key never leaves the token. ED25519,
+ECDSA P-256, and RSA keys are supported. The signer holds a session on the
+token until it is closed.
+*/
+type pkcs11Signer struct {
+	ctx         *pkcs11.Ctx
+	initialized bool
+	session     pkcs11.SessionHandle
+	hasSession  bool
+	key         pkcs11.ObjectHandle
+	keyType     uint
+	publicKey   *tufdata.PublicKey
+}
+
+/*
+NewPKCS11Signer returns a signer for the key identified by the PKCS#11 URI. The
+token's user PIN is read from the pin-value attribute of the URI, the
+GITTUF_PKCS11_PIN environment variable, or is prompted for on the terminal.
+The signer must be closed once it is no longer needed.
+*/
+func NewPKCS11Signer(uri string) (tufkeys.Signer, error) {
+	parsed, err := parsePKCS11URI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := pkcs11.New(parsed.modulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("unable to load PKCS#11 module %s", parsed.modulePath)
+	}
+	signer := &pkcs11Signer{ctx: ctx}
+
+	// The module may already have been initialized for another signer, in
+	// which case it is left for that signer to finalize
+	err = ctx.Initialize()
+	if err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		signer.Close()
+		return nil, err
+	}
+	signer.initialized = err == nil
+
+	if err := signer.open(parsed); err != nil {
+		signer.Close()
+		return nil, err
+	}
+	return signer, nil
+}
+
+// open logs in to the token and finds the key identified by the URI.
+func (s *pkcs11Signer) open(parsed *pkcs11URI) error {
+	slotID, err := findPKCS11Slot(s.ctx, parsed)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.ctx.OpenSession(slotID, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return err
+	}
+	s.session = session
+	s.hasSession = true
+
+	pin, err := getPKCS11PIN(parsed)
+	if err != nil {
+		return err
+	}
+	if err := s.ctx.Login(session, pkcs11.CKU_USER, pin); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		return err
+	}
+
+	key, err := findPKCS11Object(s.ctx, session, pkcs11.CKO_PRIVATE_KEY, parsed)
+	if err != nil {
+		return err
+	}
+	attrs, err := s.ctx.GetAttributeValue(session, key, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return err
+	}
+	keyType, err := bytesToUint(attrs[0].Value)
+	if err != nil {
+		return err
+	}
+
+	pubKeyObject, err := findPKCS11Object(s.ctx, session, pkcs11.CKO_PUBLIC_KEY, parsed)
+	if err != nil {
+		return err
+	}
+	cryptoPubKey, err := getPKCS11PublicKey(s.ctx, session, pubKeyObject, uint(keyType))
+	if err != nil {
+		return err
+	}
+	pubKey, err := newPublicKeyFromCrypto(cryptoPubKey)
+	if err != nil {
+		return err
+	}
+
+	s.key = key
+	s.keyType = uint(keyType)
+	s.publicKey = pubKey
+	return nil
+}
+
+// Close closes the signer's session on the token and unloads the module.
+func (s *pkcs11Signer) Close() error {
+	if s.ctx == nil {
+		return nil
+	}
+
+	var err error
+	if s.hasSession {
+		err = s.ctx.CloseSession(s.session)
+		s.hasSession = false
+	}
+	if s.initialized {
+		if finalizeErr := s.ctx.Finalize(); err == nil {
+			err = finalizeErr
+		}
+		s.initialized = false
+	}
+	s.ctx.Destroy()
+	s.ctx = nil
+	return err
+}
+
+func (s *pkcs11Signer) PublicData() *tufdata.PublicKey {
+	return s.publicKey
+}
+
+func (s *pkcs11Signer) SignMessage(message []byte) ([]byte, error) {
+	switch s.keyType {
+	case ckkECEdwards:
+		return s.sign(ckmEdDSA, nil, message)
+	case pkcs11.CKK_EC:
+		hash := sha256.Sum256(message)
+		sig, err := s.sign(pkcs11.CKM_ECDSA, nil, hash[:])
+		if err != nil {
+			return nil, err
+		}
+		// PKCS#11 returns r || s while go-tuf expects the ASN.1 encoding.
+		var ecSig struct {
+			R *big.Int
+			S *big.Int
+		}
+		ecSig.R = new(big.Int).SetBytes(sig[:len(sig)/2])
+		ecSig.S = new(big.Int).SetBytes(sig[len(sig)/2:])
+		return asn1.Marshal(ecSig)
+	case pkcs11.CKK_RSA:
+		hash := sha256.Sum256(message)
+		params := pkcs11.NewPSSParams(pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256, sha256.Size)
+		return s.sign(pkcs11.CKM_RSA_PKCS_PSS, params, hash[:])
+	}
+	return nil, fmt.Errorf("unsupported PKCS#11 key type %d", s.keyType)
+}
+
+func (s *pkcs11Signer) sign(mechanism uint, params []byte, data []byte) ([]byte, error) {
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, params)}, s.key); err != nil {
+		return nil, err
+	}
+	return s.ctx.Sign(s.session, data)
+}
+
+func (s *pkcs11Signer) MarshalPrivateKey() (*tufdata.PrivateKey, error) {
+	return nil, fmt.Errorf("private keys held by PKCS#11 tokens cannot be exported")
+}
+
+func (s *pkcs11Signer) UnmarshalPrivateKey(key *tufdata.PrivateKey) error {
+	return fmt.Errorf("private keys cannot be loaded into PKCS#11 signers")
+}
+
+func findPKCS11Slot(ctx *pkcs11.Ctx, uri *pkcs11URI) (uint, error) {
+	if uri.slotID != nil && len(uri.token) == 0 {
+		return *uri.slotID, nil
+	}
+
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+
+	matches := []uint{}
+	for _, slot := range slots {
+		if uri.slotID != nil && *uri.slotID != slot {
+			continue
+		}
+		if len(uri.token) > 0 {
+			info, err := ctx.GetTokenInfo(slot)
+			if err != nil {
+				return 0, err
+			}
+			if strings.TrimSpace(info.Label) != uri.token {
+				continue
+			}
+		}
+		matches = append(matches, slot)
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("no PKCS#11 token found matching %s", uri.token)
+	case 1:
+		return matches[0], nil
+	}
+	return 0, fmt.Errorf("multiple PKCS#11 tokens found, specify token or slot-id")
+}
+
+func findPKCS11Object(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, class uint, uri *pkcs11URI) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if len(uri.object) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, uri.object))
+	}
+	if len(uri.id) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, uri.id))
+	}
+
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, err
+	}
+	objects, _, err := ctx.FindObjects(session, 2)
+	if finalErr := ctx.FindObjectsFinal(session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	kind := "private"
+	if class == pkcs11.CKO_PUBLIC_KEY {
+		kind = "public"
+	}
+	switch len(objects) {
+	case 0:
+		return 0, fmt.Errorf("no PKCS#11 %s key found matching object %s", kind, uri.object)
+	case 1:
+		return objects[0], nil
+	}
+	return 0, fmt.Errorf("multiple PKCS#11 %s keys found matching object %s, specify id", kind, uri.object)
+}
+
+func getPKCS11PublicKey(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, object pkcs11.ObjectHandle, keyType uint) (interface{}, error) {
+	switch keyType {
+	case pkcs11.CKK_RSA:
+		attrs, err := ctx.GetAttributeValue(session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		}, nil
+	case pkcs11.CKK_EC, ckkECEdwards:
+		attrs, err := ctx.GetAttributeValue(session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// CKA_EC_POINT is a DER encoded octet string, though some tokens
+		// return the raw point instead.
+		point := attrs[1].Value
+		var decoded []byte
+		if rest, err := asn1.Unmarshal(point, &decoded); err == nil && len(rest) == 0 {
+			point = decoded
+		}
+
+		if keyType == ckkECEdwards {
+			if len(point) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("unsupported EdDSA key on PKCS#11 token")
+			}
+			return ed25519.PublicKey(point), nil
+		}
+
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(attrs[0].Value, &curve); err != nil || !curve.Equal(oidNamedCurveP256) {
+			return nil, fmt.Errorf("unsupported ECDSA curve on PKCS#11 token")
+		}
+		x, y := elliptic.Unmarshal(elliptic.P256(), point)
+		if x == nil {
+			return nil, fmt.Errorf("invalid ECDSA public key on PKCS#11 token")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported PKCS#11 key type %d", keyType)
+}
+
+// nativeEndian is the host's byte order.
+var nativeEndian = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// bytesToUint decodes a CK_ULONG attribute, which is in the host's byte order
+// and has the size of the module's CK_ULONG.
+func bytesToUint(b []byte) (uint64, error) {
+	switch len(b) {
+	case 4:
+		return uint64(nativeEndian.Uint32(b)), nil
+	case 8:
+		return nativeEndian.Uint64(b), nil
+	}
+	return 0, fmt.Errorf("unexpected CK_ULONG of %d bytes", len(b))
+}
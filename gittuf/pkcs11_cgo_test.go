@@ -0,0 +1,187 @@
+//go:build cgo
+
+package gittuf
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+	tufsign "github.com/theupdateframework/go-tuf/sign"
+)
+
+const (
+	softHSMModuleEnvVar = "GITTUF_TEST_SOFTHSM_MODULE"
+	softHSMTokenLabel   = "gittuf"
+	softHSMSOPIN        = "0000"
+	softHSMUserPIN      = "1234"
+)
+
+// findSoftHSMModule returns the path to SoftHSM's PKCS#11 module, which may be
+// set using GITTUF_TEST_SOFTHSM_MODULE.
+func findSoftHSMModule() string {
+	if path, set := os.LookupEnv(softHSMModuleEnvVar); set {
+		return path
+	}
+	for _, path := range []string{
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/lib64/pkcs11/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+		"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+/*
+setupSoftHSM creates a SoftHSM token in a temporary directory holding an ECDSA
+P-256 key labelled ecdsa and an RSA key labelled rsa, and returns the path to
+the module.
+*/
+func setupSoftHSM(t *testing.T) string {
+	t.Helper()
+
+	modulePath := findSoftHSMModule()
+	if len(modulePath) == 0 {
+		t.Skipf("SoftHSM not found, set %s to run PKCS#11 tests", softHSMModuleEnvVar)
+	}
+
+	dir := t.TempDir()
+	tokenDir := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokenDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	confPath := filepath.Join(dir, "softhsm2.conf")
+	conf := fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\n", tokenDir)
+	if err := os.WriteFile(confPath, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", confPath)
+
+	ctx := pkcs11.New(modulePath)
+	if ctx == nil {
+		t.Fatalf("unable to load %s", modulePath)
+	}
+	defer ctx.Destroy()
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Finalize()
+
+	slots, err := ctx.GetSlotList(false)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("no SoftHSM slots available: %v", err)
+	}
+	if err := ctx.InitToken(slots[0], softHSMSOPIN, softHSMTokenLabel); err != nil {
+		t.Fatal(err)
+	}
+
+	// SoftHSM moves an initialized token to a new slot
+	slot, err := findPKCS11Slot(ctx, &pkcs11URI{token: softHSMTokenLabel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.CloseSession(session)
+
+	if err := ctx.Login(session, pkcs11.CKU_SO, softHSMSOPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.InitPIN(session, softHSMUserPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Logout(session); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Login(session, pkcs11.CKU_USER, softHSMUserPIN); err != nil {
+		t.Fatal(err)
+	}
+
+	p256Params, err := asn1.Marshal(oidNamedCurveP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []struct {
+		label     string
+		mechanism uint
+		public    []*pkcs11.Attribute
+	}{
+		{
+			label:     "ecdsa",
+			mechanism: pkcs11.CKM_EC_KEY_PAIR_GEN,
+			public:    []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, p256Params)},
+		},
+		{
+			label:     "rsa",
+			mechanism: pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN,
+			public: []*pkcs11.Attribute{
+				pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, 2048),
+				pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+			},
+		},
+	}
+	for _, k := range keys {
+		public := append([]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, k.label),
+		}, k.public...)
+		private := []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, k.label),
+		}
+		if _, _, err := ctx.GenerateKeyPair(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(k.mechanism, nil)}, public, private); err != nil {
+			t.Fatalf("unable to generate %s key: %s", k.label, err)
+		}
+	}
+
+	return modulePath
+}
+
+func TestPKCS11Signer(t *testing.T) {
+	modulePath := setupSoftHSM(t)
+
+	for _, label := range []string{"ecdsa", "rsa"} {
+		t.Run(label, func(t *testing.T) {
+			uri := fmt.Sprintf("pkcs11:token=%s;object=%s?module-path=%s&pin-value=%s", softHSMTokenLabel, label, modulePath, softHSMUserPIN)
+			signer, err := NewPKCS11Signer(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer CloseSigners([]tufkeys.Signer{signer})
+
+			mb := tufdata.Signed{Signed: []byte(`{"_type":"targets"}`)}
+			if err := tufsign.Sign(&mb, signer); err != nil {
+				t.Fatal(err)
+			}
+			pubKey := signer.PublicData()
+			keys := map[string]*tufdata.PublicKey{}
+			for _, keyID := range pubKey.IDs() {
+				keys[keyID] = pubKey
+			}
+			if err := verifySignatures(&mb, keys, 1); err != nil {
+				t.Errorf("signature made on token does not verify: %s", err)
+			}
+		})
+	}
+
+	// Keys that are not on the token are not found
+	uri := fmt.Sprintf("pkcs11:token=%s;object=missing?module-path=%s&pin-value=%s", softHSMTokenLabel, modulePath, softHSMUserPIN)
+	if _, err := NewPKCS11Signer(uri); err == nil {
+		t.Error("expected error loading a key that does not exist")
+	}
+}
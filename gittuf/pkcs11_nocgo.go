@@ -0,0 +1,18 @@
+//go:build !cgo
+
+package gittuf
+
+import (
+	"fmt"
+
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// NewPKCS11Signer is unavailable as PKCS#11 modules can only be loaded in
+// builds with cgo.
+func NewPKCS11Signer(uri string) (tufkeys.Signer, error) {
+	if _, err := parsePKCS11URI(uri); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("pkcs11 support not built, gittuf must be built with cgo to use PKCS#11 keys")
+}
@@ -0,0 +1,44 @@
+package gittuf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	uri, err := parsePKCS11URI("pkcs11:token=gittuf;object=root%20key;slot-id=3?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.token != "gittuf" || uri.object != "root key" || uri.pin != "1234" || uri.modulePath != "/usr/lib/softhsm/libsofthsm2.so" {
+		t.Errorf("unexpected attributes %+v", uri)
+	}
+	if uri.slotID == nil || *uri.slotID != 3 {
+		t.Errorf("expected slot-id 3, got %v", uri.slotID)
+	}
+
+	uri, err = parsePKCS11URI("pkcs11:id=%01%02?module-path=/lib/p11.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(uri.id, []byte{1, 2}) {
+		t.Errorf("expected id 0102, got %x", uri.id)
+	}
+}
+
+func TestParsePKCS11URIErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing scheme":      "token=gittuf;object=root?module-path=/lib/p11.so",
+		"missing module path": "pkcs11:token=gittuf;object=root",
+		"missing key":         "pkcs11:token=gittuf?module-path=/lib/p11.so",
+		"invalid slot":        "pkcs11:slot-id=x;object=root?module-path=/lib/p11.so",
+		"invalid attribute":   "pkcs11:object?module-path=/lib/p11.so",
+	}
+	for name, uri := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parsePKCS11URI(uri); err == nil {
+				t.Errorf("expected error parsing %s", uri)
+			}
+		})
+	}
+}
@@ -0,0 +1,709 @@
+package gittuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	gitBranchRefPrefix = "refs/heads/"
+	gitTagRefPrefix    = "refs/tags/"
+)
+
+/*
+Policy is a declarative description of the rules protecting a repository.
+Principals name sets of keys, and rules refer to principals instead of keys.
+Rules are searched in the order they are listed. A rule is delegated by the
+top level targets role unless it names another rule as its parent, which
+must be listed before it. The allow rule is implicit and always last.
+*/
+type Policy struct {
+	Principals map[string]*PolicyPrincipal `yaml:"principals"`
+	Rules      []*PolicyRule               `yaml:"rules"`
+}
+
+// PolicyPrincipal is a named set of keys.
+type PolicyPrincipal struct {
+	Keys []*PolicyKey `yaml:"keys"`
+}
+
+// PolicyKey is a public key, either read from a file at Path, relative to the
+// policy file, or specified inline.
+type PolicyKey struct {
+	Path       string            `yaml:"path,omitempty"`
+	KeyType    string            `yaml:"keytype,omitempty"`
+	Scheme     string            `yaml:"scheme,omitempty"`
+	Algorithms []string          `yaml:"keyid_hash_algorithms,omitempty"`
+	KeyVal     map[string]string `yaml:"keyval,omitempty"`
+}
+
+// PolicyRule describes a rule. Refs are full ref names such as
+// refs/heads/main and are protected in addition to the paths. A rule without
+// operations authorizes every operation.
+type PolicyRule struct {
+	Name             string   `yaml:"name"`
+	Parent           string   `yaml:"parent,omitempty"`
+	Refs             []string `yaml:"refs,omitempty"`
+	Paths            []string `yaml:"paths,omitempty"`
+	PathHashPrefixes []string `yaml:"path_hash_prefixes,omitempty"`
+	Principals       []string `yaml:"principals"`
+	Threshold        int      `yaml:"threshold"`
+	Terminating      bool     `yaml:"terminating,omitempty"`
+	Operations       []string `yaml:"operations,omitempty"`
+}
+
+/*
+PolicyPlan holds the changes to the delegations needed to apply a policy, and
+the new metadata for the roles that change. Roles are ordered so that a role
+comes after the role that delegates it.
+*/
+type PolicyPlan struct {
+	Changes []string
+
+	roles      []string
+	metadata   map[string]*tufdata.Targets
+	keys       map[string]map[string]*tufdata.PublicKey
+	thresholds map[string]int
+}
+
+// LoadPolicy reads a policy file. Keys specified by path are loaded relative
+// to the directory of the policy file.
+func LoadPolicy(path string) (*Policy, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("unable to parse policy %s: %w", path, err)
+	}
+
+	for name, principal := range policy.Principals {
+		for i, k := range principal.Keys {
+			if len(k.Path) == 0 {
+				continue
+			}
+			keyPath := k.Path
+			if !filepath.IsAbs(keyPath) {
+				keyPath = filepath.Join(filepath.Dir(path), keyPath)
+			}
+			key, err := LoadPublicKey(keyPath)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load key for principal %s: %w", name, err)
+			}
+			principal.Keys[i], err = newPolicyKey(key)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &policy, nil
+}
+
+// Marshal returns the policy in the format read by LoadPolicy.
+func (p *Policy) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(p); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newPolicyKey(key *tufdata.PublicKey) (*PolicyKey, error) {
+	keyVal := map[string]string{}
+	if err := json.Unmarshal(key.Value, &keyVal); err != nil {
+		return nil, err
+	}
+	algorithms := []string{}
+	for _, a := range key.Algorithms {
+		algorithms = append(algorithms, string(a))
+	}
+	return &PolicyKey{
+		KeyType:    string(key.Type),
+		Scheme:     string(key.Scheme),
+		Algorithms: algorithms,
+		KeyVal:     keyVal,
+	}, nil
+}
+
+func (k *PolicyKey) publicKey() (*tufdata.PublicKey, error) {
+	if len(k.KeyType) == 0 || len(k.KeyVal) == 0 {
+		return nil, fmt.Errorf("key must specify either a path or keytype and keyval")
+	}
+	value, err := json.Marshal(k.KeyVal)
+	if err != nil {
+		return nil, err
+	}
+	algorithms := []tufdata.HashAlgorithm{}
+	for _, a := range k.Algorithms {
+		algorithms = append(algorithms, tufdata.HashAlgorithm(a))
+	}
+	if len(algorithms) == 0 {
+		algorithms = nil
+	}
+	return &tufdata.PublicKey{
+		Type:       tufdata.KeyType(k.KeyType),
+		Scheme:     tufdata.KeyScheme(k.Scheme),
+		Algorithms: algorithms,
+		Value:      value,
+	}, nil
+}
+
+// targetPaths returns the paths protected by the rule, with refs converted to
+// Git targets.
+func (r *PolicyRule) targetPaths() ([]string, error) {
+	paths := []string{}
+	for _, ref := range r.Refs {
+		target, err := refToGitTarget(ref)
+		if err != nil {
+			return []string{}, fmt.Errorf("invalid ref in rule %s: %w", r.Name, err)
+		}
+		paths = append(paths, target)
+	}
+	return append(paths, r.Paths...), nil
+}
+
+// refToGitTarget converts a full ref name such as refs/heads/main to a Git
+// target.
+func refToGitTarget(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, gitBranchRefPrefix):
+		return CreateGitTarget(strings.TrimPrefix(ref, gitBranchRefPrefix), GitBranchRef)
+	case strings.HasPrefix(ref, gitTagRefPrefix):
+		return CreateGitTarget(strings.TrimPrefix(ref, gitTagRefPrefix), GitTagRef)
+	}
+	return "", fmt.Errorf("ref %s must start with %s or %s", ref, gitBranchRefPrefix, gitTagRefPrefix)
+}
+
+// PrincipalNames returns the name of the principal each key ID belongs to.
+func (p *Policy) PrincipalNames() (map[string]string, error) {
+	names := map[string]string{}
+	for name, principal := range p.Principals {
+		for _, k := range principal.Keys {
+			key, err := k.publicKey()
+			if err != nil {
+				return map[string]string{}, fmt.Errorf("invalid key for principal %s: %w", name, err)
+			}
+			for _, keyID := range key.IDs() {
+				names[keyID] = name
+			}
+		}
+	}
+	return names, nil
+}
+
+/*
+ExportPolicy returns the policy currently recorded in the delegations tree.
+Each key becomes a principal named after its key ID. Hash bins and the rules
+they delegate are not included, as they are managed using rule bins.
+*/
+func ExportPolicy(state *gitstore.State) (*Policy, error) {
+	current, err := loadPolicyState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{
+		Principals: map[string]*PolicyPrincipal{},
+		Rules:      []*PolicyRule{},
+	}
+	for _, rule := range current.rules {
+		if rule.isAllowRule() || current.unmanaged[rule.Delegation.Name] {
+			continue
+		}
+
+		policyRule := &PolicyRule{
+			Name:             rule.Delegation.Name,
+			Refs:             []string{},
+			Paths:            []string{},
+			PathHashPrefixes: rule.Delegation.PathHashPrefixes,
+			Principals:       []string{},
+			Threshold:        rule.Delegation.Threshold,
+			Terminating:      rule.Delegation.Terminating,
+			Operations:       rule.Operations,
+		}
+		if rule.Parent != "targets" {
+			policyRule.Parent = rule.Parent
+		}
+		for _, p := range rule.Delegation.Paths {
+			if !IsValidGitTarget(p) {
+				policyRule.Paths = append(policyRule.Paths, p)
+				continue
+			}
+			refName, refType, err := ParseGitTarget(p)
+			if err != nil {
+				return nil, err
+			}
+			if refType == GitTagRef {
+				policyRule.Refs = append(policyRule.Refs, gitTagRefPrefix+refName)
+			} else {
+				policyRule.Refs = append(policyRule.Refs, gitBranchRefPrefix+refName)
+			}
+		}
+
+		seen := map[string]bool{}
+		for _, keyID := range rule.Delegation.KeyIDs {
+			key, ok := rule.Keys[keyID]
+			if !ok || seen[key.IDs()[0]] {
+				continue
+			}
+			seen[key.IDs()[0]] = true
+			name := fmt.Sprintf("key-%s", key.IDs()[0][:8])
+			if _, ok := policy.Principals[name]; !ok {
+				policyKey, err := newPolicyKey(key)
+				if err != nil {
+					return nil, err
+				}
+				policy.Principals[name] = &PolicyPrincipal{Keys: []*PolicyKey{policyKey}}
+			}
+			policyRule.Principals = append(policyRule.Principals, name)
+		}
+
+		policy.Rules = append(policy.Rules, policyRule)
+	}
+	return policy, nil
+}
+
+/*
+PlanPolicy compares the policy with the delegations tree and returns the
+changes needed to apply it. The metadata of every role whose delegations
+change is updated, as is the metadata of every rule whose keys or threshold
+change, since it must be signed again by the new keys.
+*/
+func PlanPolicy(state *gitstore.State, policy *Policy) (*PolicyPlan, error) {
+	current, err := loadPolicyState(state)
+	if err != nil {
+		return nil, err
+	}
+	desired, desiredRules, err := compilePolicy(state, policy, current)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &PolicyPlan{
+		Changes:    describePolicyChanges(current, desiredRules, policy),
+		roles:      []string{},
+		metadata:   map[string]*tufdata.Targets{},
+		keys:       map[string]map[string]*tufdata.PublicKey{},
+		thresholds: map[string]int{},
+	}
+
+	rootRole, err := loadRoot(state)
+	if err != nil {
+		return nil, err
+	}
+	targetsKeys, targetsThreshold := getRoleKeysFromRoot(rootRole, "targets")
+
+	candidates := []string{"targets"}
+	for _, rule := range policy.Rules {
+		candidates = append(candidates, rule.Name)
+	}
+	for _, roleName := range candidates {
+		currentRole, hasFile := current.roles[roleName]
+		delegations, delegates := desired[roleName]
+		if !hasFile && !delegates {
+			continue
+		}
+
+		var newRole *tufdata.Targets
+		if hasFile {
+			copied := *currentRole
+			newRole = &copied
+		} else {
+			newRole = tufdata.NewTargets()
+		}
+
+		changed := !hasFile
+		if current.binsParents[roleName] {
+			delegations = currentRole.Delegations
+		} else {
+			currentOperations, err := getRuleOperations(newRole)
+			if err != nil {
+				return nil, err
+			}
+			operations := map[string][]string{}
+			for _, rule := range desiredRules {
+				if rule.Parent == roleName && len(rule.Operations) > 0 {
+					operations[rule.Delegation.Name] = rule.Operations
+				}
+			}
+
+			if !delegationsEqual(newRole.Delegations, delegations) || !reflect.DeepEqual(currentOperations, operations) {
+				changed = true
+				if hasFile {
+					plan.Changes = append(plan.Changes, fmt.Sprintf("update delegations in %s", roleName))
+				} else {
+					plan.Changes = append(plan.Changes, fmt.Sprintf("create metadata for %s", roleName))
+				}
+			}
+			if err := replaceRuleOperations(newRole, operations); err != nil {
+				return nil, err
+			}
+		}
+
+		if roleName == "targets" {
+			plan.keys[roleName] = targetsKeys
+			plan.thresholds[roleName] = targetsThreshold
+		} else {
+			rule := desiredRules[roleName]
+			plan.keys[roleName] = rule.Keys
+			plan.thresholds[roleName] = rule.Delegation.Threshold
+			if currentRule, ok := current.ruleMap[roleName]; ok && hasFile && !sameAuthorization(currentRule.Delegation, rule.Delegation) {
+				if !changed {
+					plan.Changes = append(plan.Changes, fmt.Sprintf("sign metadata for %s with its new keys", roleName))
+				}
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		newRole.Delegations = delegations
+		newRole.Version++
+		plan.roles = append(plan.roles, roleName)
+		plan.metadata[roleName] = newRole
+	}
+
+	return plan, nil
+}
+
+/*
+SignPolicyPlan signs the new metadata for each role in the plan with the
+signers authorized for it. If requireThreshold is set, the signers must meet
+each role's threshold, otherwise the metadata is expected to be signed by
+others as a proposal.
+*/
+func SignPolicyPlan(plan *PolicyPlan, signers []tufkeys.Signer, requireThreshold bool) (map[string][]byte, error) {
+	signed := map[string][]byte{}
+	for _, roleName := range plan.roles {
+		keys := plan.keys[roleName]
+		roleSigners := []tufkeys.Signer{}
+		for _, signer := range signers {
+			if isKeyAuthorized(keys, signer.PublicData().IDs()) {
+				roleSigners = append(roleSigners, signer)
+			}
+		}
+		if len(roleSigners) == 0 {
+			return map[string][]byte{}, fmt.Errorf("no key specified is authorized to sign for %s", roleName)
+		}
+
+		mb, err := generateAndSignMbFromStruct(plan.metadata[roleName], roleSigners)
+		if err != nil {
+			return map[string][]byte{}, err
+		}
+		if requireThreshold {
+			if err := verifySignatures(&mb, keys, plan.thresholds[roleName]); err != nil {
+				return map[string][]byte{}, fmt.Errorf("metadata for %s is not signed by enough keys, use a proposal to collect more signatures: %w", roleName, err)
+			}
+		}
+
+		contents, err := json.Marshal(mb)
+		if err != nil {
+			return map[string][]byte{}, err
+		}
+		signed[roleName] = contents
+	}
+	return signed, nil
+}
+
+// policyState holds the delegations tree as it is recorded in a state.
+type policyState struct {
+	rules       []*delegatedRule
+	ruleMap     map[string]*delegatedRule
+	roles       map[string]*tufdata.Targets
+	binsParents map[string]bool
+	unmanaged   map[string]bool
+}
+
+/*
+loadPolicyState loads the rules in the delegations tree along with the
+verified metadata of every role that delegates rules. Hash bins and the
+rules below them are marked as unmanaged.
+*/
+func loadPolicyState(state *gitstore.State) (*policyState, error) {
+	rules, err := getAllRules(state)
+	if err != nil {
+		return nil, err
+	}
+	topLevelTargets, err := loadTopLevelTargets(state)
+	if err != nil {
+		return nil, err
+	}
+
+	current := &policyState{
+		rules:       rules,
+		ruleMap:     map[string]*delegatedRule{},
+		roles:       map[string]*tufdata.Targets{"targets": topLevelTargets},
+		binsParents: map[string]bool{},
+		unmanaged:   map[string]bool{},
+	}
+	for _, rule := range rules {
+		current.ruleMap[rule.Delegation.Name] = rule
+		if current.binsParents[rule.Parent] || current.unmanaged[rule.Parent] {
+			current.unmanaged[rule.Delegation.Name] = true
+		}
+		if rule.isAllowRule() || !state.HasFile(rule.Delegation.Name) {
+			continue
+		}
+
+		role, err := loadSpecificTargets(state, rule.Delegation.Name, rule.Keys, rule.Delegation.Threshold)
+		if err != nil {
+			return nil, fmt.Errorf("unable to verify metadata for rule %s: %w", rule.Delegation.Name, err)
+		}
+		current.roles[rule.Delegation.Name] = role
+		bins, err := getSuccinctRoles(role)
+		if err != nil {
+			return nil, err
+		}
+		if bins != nil {
+			current.binsParents[rule.Delegation.Name] = true
+		}
+	}
+	return current, nil
+}
+
+/*
+compilePolicy validates the policy and returns the delegations each role
+must make to implement it, along with the rules it defines.
+*/
+func compilePolicy(state *gitstore.State, policy *Policy, current *policyState) (map[string]*tufdata.Delegations, map[string]*delegatedRule, error) {
+	principalKeys := map[string][]*tufdata.PublicKey{}
+	for name, principal := range policy.Principals {
+		if principal == nil || len(principal.Keys) == 0 {
+			return nil, nil, fmt.Errorf("principal %s has no keys", name)
+		}
+		for _, k := range principal.Keys {
+			key, err := k.publicKey()
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid key for principal %s: %w", name, err)
+			}
+			principalKeys[name] = append(principalKeys[name], key)
+		}
+	}
+
+	desired := map[string]*tufdata.Delegations{
+		"targets": {Keys: map[string]*tufdata.PublicKey{}, Roles: []tufdata.DelegatedRole{}},
+	}
+	rules := map[string]*delegatedRule{}
+	for _, r := range policy.Rules {
+		switch {
+		case len(r.Name) == 0:
+			return nil, nil, fmt.Errorf("every rule must have a name")
+		case rules[r.Name] != nil:
+			return nil, nil, fmt.Errorf("rule %s is defined more than once", r.Name)
+		case current.unmanaged[r.Name]:
+			return nil, nil, fmt.Errorf("rule %s is a hash bin or is delegated by one", r.Name)
+		}
+		if err := validateRuleName(r.Name); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := current.ruleMap[r.Name]; !ok && state.HasFile(r.Name) {
+			return nil, nil, fmt.Errorf("metadata for %s already exists and is not a rule", r.Name)
+		}
+
+		parent := r.Parent
+		if len(parent) == 0 {
+			parent = "targets"
+		}
+		if parent != "targets" && rules[parent] == nil {
+			return nil, nil, fmt.Errorf("parent %s of rule %s must be defined before it", parent, r.Name)
+		}
+		if current.binsParents[parent] {
+			return nil, nil, fmt.Errorf("rule %s cannot be delegated by %s, which delegates to hash bins", r.Name, parent)
+		}
+
+		paths, err := r.targetPaths()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(paths) > 0 && len(r.PathHashPrefixes) > 0 {
+			return nil, nil, fmt.Errorf("rule %s cannot protect both paths and path hash prefixes", r.Name)
+		}
+		if err := validateOperations(r.Operations); err != nil {
+			return nil, nil, fmt.Errorf("invalid operations for rule %s: %w", r.Name, err)
+		}
+
+		keys := map[string]*tufdata.PublicKey{}
+		for _, principal := range r.Principals {
+			principalKey, ok := principalKeys[principal]
+			if !ok {
+				return nil, nil, fmt.Errorf("rule %s refers to unknown principal %s", r.Name, principal)
+			}
+			for _, key := range principalKey {
+				keys[key.IDs()[0]] = key
+			}
+		}
+		if r.Threshold < 1 || r.Threshold > len(keys) {
+			return nil, nil, fmt.Errorf("invalid threshold %d for rule %s with %d keys", r.Threshold, r.Name, len(keys))
+		}
+		keyIDs := []string{}
+		for keyID := range keys {
+			keyIDs = append(keyIDs, keyID)
+		}
+		sort.Strings(keyIDs)
+
+		delegation := tufdata.DelegatedRole{
+			Name:             r.Name,
+			KeyIDs:           keyIDs,
+			Threshold:        r.Threshold,
+			Terminating:      r.Terminating,
+			PathHashPrefixes: r.PathHashPrefixes,
+			Paths:            paths,
+		}
+		if _, ok := desired[parent]; !ok {
+			desired[parent] = &tufdata.Delegations{Keys: map[string]*tufdata.PublicKey{}, Roles: []tufdata.DelegatedRole{}}
+		}
+		for keyID, key := range keys {
+			desired[parent].Keys[keyID] = key
+		}
+		desired[parent].Roles = append(desired[parent].Roles, delegation)
+		rules[r.Name] = &delegatedRule{Parent: parent, Delegation: delegation, Keys: keys, Operations: r.Operations}
+	}
+	desired["targets"].Roles = append(desired["targets"].Roles, createAllowRule())
+
+	// Rules that no longer delegate anything keep their metadata, emptied
+	for roleName := range current.roles {
+		if _, ok := desired[roleName]; !ok && rules[roleName] != nil && !current.binsParents[roleName] {
+			desired[roleName] = &tufdata.Delegations{Keys: map[string]*tufdata.PublicKey{}, Roles: []tufdata.DelegatedRole{}}
+		}
+	}
+
+	return desired, rules, nil
+}
+
+// describePolicyChanges returns a description of how the rules in the policy
+// differ from the current rules.
+func describePolicyChanges(current *policyState, desired map[string]*delegatedRule, policy *Policy) []string {
+	changes := []string{}
+	for _, rule := range current.rules {
+		name := rule.Delegation.Name
+		if rule.isAllowRule() || current.unmanaged[name] {
+			continue
+		}
+		if _, ok := desired[name]; !ok {
+			changes = append(changes, fmt.Sprintf("remove rule %s from %s", name, rule.Parent))
+		}
+	}
+
+	order := map[string][]string{}
+	currentOrder := map[string][]string{}
+	for _, r := range policy.Rules {
+		rule := desired[r.Name]
+		currentRule, ok := current.ruleMap[r.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("add rule %s to %s", r.Name, rule.Parent))
+			continue
+		}
+		if currentRule.Parent != rule.Parent {
+			changes = append(changes, fmt.Sprintf("move rule %s from %s to %s", r.Name, currentRule.Parent, rule.Parent))
+		} else {
+			order[rule.Parent] = append(order[rule.Parent], r.Name)
+		}
+		if !stringsEqual(currentRule.Delegation.Paths, rule.Delegation.Paths) {
+			changes = append(changes, fmt.Sprintf("change paths of rule %s from [%s] to [%s]", r.Name, strings.Join(currentRule.Delegation.Paths, ", "), strings.Join(rule.Delegation.Paths, ", ")))
+		}
+		if !stringsEqual(currentRule.Delegation.PathHashPrefixes, rule.Delegation.PathHashPrefixes) {
+			changes = append(changes, fmt.Sprintf("change path hash prefixes of rule %s from [%s] to [%s]", r.Name, strings.Join(currentRule.Delegation.PathHashPrefixes, ", "), strings.Join(rule.Delegation.PathHashPrefixes, ", ")))
+		}
+		if !stringsEqual(sortedCopy(currentRule.Delegation.KeyIDs), rule.Delegation.KeyIDs) {
+			changes = append(changes, fmt.Sprintf("change keys of rule %s from [%s] to [%s]", r.Name, strings.Join(sortedCopy(currentRule.Delegation.KeyIDs), ", "), strings.Join(rule.Delegation.KeyIDs, ", ")))
+		}
+		if currentRule.Delegation.Threshold != rule.Delegation.Threshold {
+			changes = append(changes, fmt.Sprintf("change threshold of rule %s from %d to %d", r.Name, currentRule.Delegation.Threshold, rule.Delegation.Threshold))
+		}
+		if currentRule.Delegation.Terminating != rule.Delegation.Terminating {
+			changes = append(changes, fmt.Sprintf("change terminating of rule %s from %t to %t", r.Name, currentRule.Delegation.Terminating, rule.Delegation.Terminating))
+		}
+		if !stringsEqual(currentRule.Operations, rule.Operations) {
+			changes = append(changes, fmt.Sprintf("change operations of rule %s from [%s] to [%s]", r.Name, strings.Join(currentRule.Operations, ", "), strings.Join(rule.Operations, ", ")))
+		}
+	}
+
+	for _, rule := range current.rules {
+		if _, ok := desired[rule.Delegation.Name]; ok && desired[rule.Delegation.Name].Parent == rule.Parent {
+			currentOrder[rule.Parent] = append(currentOrder[rule.Parent], rule.Delegation.Name)
+		}
+	}
+	parents := []string{}
+	for parent := range order {
+		parents = append(parents, parent)
+	}
+	sort.Strings(parents)
+	for _, parent := range parents {
+		if !stringsEqual(currentOrder[parent], order[parent]) {
+			changes = append(changes, fmt.Sprintf("reorder rules in %s to %s", parent, strings.Join(order[parent], ", ")))
+		}
+	}
+
+	return changes
+}
+
+// delegationsEqual reports whether two sets of delegations delegate the same
+// rules, in the same order, to the same keys.
+func delegationsEqual(a *tufdata.Delegations, b *tufdata.Delegations) bool {
+	if a == nil || b == nil {
+		return (a == nil || len(a.Roles) == 0) && (b == nil || len(b.Roles) == 0)
+	}
+	if len(a.Roles) != len(b.Roles) || len(a.Keys) != len(b.Keys) {
+		return false
+	}
+	for keyID := range a.Keys {
+		if _, ok := b.Keys[keyID]; !ok {
+			return false
+		}
+	}
+	for i := range a.Roles {
+		x, y := a.Roles[i], b.Roles[i]
+		if x.Name != y.Name || x.Threshold != y.Threshold || x.Terminating != y.Terminating {
+			return false
+		}
+		if !stringsEqual(x.Paths, y.Paths) || !stringsEqual(x.PathHashPrefixes, y.PathHashPrefixes) {
+			return false
+		}
+		if !stringsEqual(sortedCopy(x.KeyIDs), sortedCopy(y.KeyIDs)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameAuthorization reports whether two delegations of a rule authorize the
+// same keys with the same threshold.
+func sameAuthorization(a tufdata.DelegatedRole, b tufdata.DelegatedRole) bool {
+	return a.Threshold == b.Threshold && stringsEqual(sortedCopy(a.KeyIDs), sortedCopy(b.KeyIDs))
+}
+
+// stringsEqual compares two lists, treating nil and empty lists as equal.
+func stringsEqual(a []string, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func sortedCopy(list []string) []string {
+	copied := append([]string{}, list...)
+	sort.Strings(copied)
+	return copied
+}
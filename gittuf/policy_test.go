@@ -0,0 +1,232 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// writeTestPolicy writes the policy to policy.yaml in dir and returns its
+// path.
+func writeTestPolicy(t *testing.T, dir string, policy string) string {
+	t.Helper()
+	path := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(path, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// applyTestPolicy plans the policy against the state and commits the signed
+// metadata, returning the planned changes.
+func applyTestPolicy(t *testing.T, state *gitstore.State, policy *Policy, signers []tufkeys.Signer) []string {
+	t.Helper()
+	plan, err := PlanPolicy(state, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := SignPolicyPlan(plan, signers, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.StageAndCommitMultipleMetadata(signed, testSnapshotter()); err != nil {
+		t.Fatal(err)
+	}
+	return plan.Changes
+}
+
+func TestLoadPolicy(t *testing.T) {
+	alice, bob := newTestSigner(t), newTestSigner(t)
+	dir := t.TempDir()
+
+	// Alice's key is read from a file, bob's is inline
+	aliceKey, err := json.Marshal(alice.PublicData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "alice.pub"), aliceKey, 0644); err != nil {
+		t.Fatal(err)
+	}
+	bobKey, err := newPolicyKey(bob.PublicData())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeTestPolicy(t, dir, `principals:
+  alice:
+    keys:
+      - path: alice.pub
+  bob:
+    keys:
+      - keytype: `+bobKey.KeyType+`
+        scheme: `+bobKey.Scheme+`
+        keyid_hash_algorithms: [`+strings.Join(bobKey.Algorithms, ", ")+`]
+        keyval:
+          public: `+bobKey.KeyVal["public"]+`
+rules:
+  - name: protect-main
+    refs: [refs/heads/main]
+    principals: [alice, bob]
+    threshold: 2
+`)
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := policy.PrincipalNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names[alice.PublicData().IDs()[0]] != "alice" || names[bob.PublicData().IDs()[0]] != "bob" {
+		t.Errorf("expected keys of alice and bob to be named, got %v", names)
+	}
+	if len(policy.Rules) != 1 || policy.Rules[0].Threshold != 2 {
+		t.Errorf("unexpected rules %+v", policy.Rules)
+	}
+
+	path = writeTestPolicy(t, dir, "rules:\n  - name: protect-main\n    branches: [main]\n")
+	if _, err := LoadPolicy(path); err == nil || !strings.Contains(err.Error(), "field branches not found") {
+		t.Errorf("expected unknown field to be rejected, got %v", err)
+	}
+}
+
+func TestApplyPolicy(t *testing.T) {
+	alice, bob, targetsSigner := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	aliceKey, err := newPolicyKey(alice.PublicData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobKey, err := newPolicyKey(bob.PublicData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	principals := map[string]*PolicyPrincipal{
+		"alice": {Keys: []*PolicyKey{aliceKey}},
+		"bob":   {Keys: []*PolicyKey{bobKey}},
+	}
+
+	store, _ := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+	state := store.State()
+	policy := &Policy{
+		Principals: principals,
+		Rules: []*PolicyRule{
+			{Name: "protect-main", Refs: []string{"refs/heads/main"}, Principals: []string{"alice"}, Threshold: 1},
+			{Name: "protect-src", Paths: []string{"src/*"}, Principals: []string{"alice", "bob"}, Threshold: 1},
+			{Name: "protect-src-a", Parent: "protect-src", Paths: []string{"src/a"}, Principals: []string{"bob"}, Threshold: 1, Terminating: true},
+		},
+	}
+	changes := applyTestPolicy(t, state, policy, []tufkeys.Signer{targetsSigner, alice})
+	if len(changes) == 0 {
+		t.Error("expected changes to be planned")
+	}
+
+	if names := listTestRuleNames(t, state); !reflect.DeepEqual(names, []string{"protect-main", "protect-src", "protect-src-a", AllowRule}) {
+		t.Errorf("expected rules of the policy followed by the allow rule, got %v", names)
+	}
+	assertExpectedRules(t, state, "git:branch=main", []string{"protect-main"})
+	assertExpectedRules(t, state, "src/a", []string{"protect-src-a"})
+
+	// Applying the same policy again changes nothing
+	plan, err := PlanPolicy(state, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("expected no changes, got %v", plan.Changes)
+	}
+
+	// The exported policy describes the same delegations
+	exported, err := ExportPolicy(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err = PlanPolicy(state, exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("expected exported policy to match the state, got changes %v", plan.Changes)
+	}
+	contents, err := exported.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadPolicy(writeTestPolicy(t, t.TempDir(), string(contents)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadedContents, err := reloaded.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reloadedContents) != string(contents) {
+		t.Errorf("expected exported policy to be read back unchanged, got\n%s", reloadedContents)
+	}
+
+	// Rules removed from the policy are removed from the state, and rules are
+	// reordered as listed
+	policy.Rules = []*PolicyRule{
+		{Name: "protect-src", Paths: []string{"src/*"}, Principals: []string{"bob"}, Threshold: 1},
+		{Name: "protect-main", Refs: []string{"refs/heads/main"}, Principals: []string{"alice"}, Threshold: 1},
+	}
+	changes = applyTestPolicy(t, state, policy, []tufkeys.Signer{targetsSigner, bob})
+	for _, change := range []string{"remove rule protect-src-a from protect-src", "change keys of rule protect-src", "reorder rules in targets"} {
+		found := false
+		for _, c := range changes {
+			found = found || strings.HasPrefix(c, change)
+		}
+		if !found {
+			t.Errorf("expected change '%s', got %v", change, changes)
+		}
+	}
+	if names := listTestRuleNames(t, state); !reflect.DeepEqual(names, []string{"protect-src", "protect-main", AllowRule}) {
+		t.Errorf("expected rules [protect-src protect-main %s], got %v", AllowRule, names)
+	}
+}
+
+func TestPlanPolicyRejected(t *testing.T) {
+	alice, targetsSigner := newTestSigner(t), newTestSigner(t)
+	aliceKey, err := newPolicyKey(alice.PublicData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	principals := map[string]*PolicyPrincipal{"alice": {Keys: []*PolicyKey{aliceKey}}}
+
+	tests := []struct {
+		name  string
+		rules []*PolicyRule
+		err   string
+	}{
+		{name: "unknown principal", rules: []*PolicyRule{{Name: "protect-src", Paths: []string{"src/*"}, Principals: []string{"bob"}, Threshold: 1}}, err: "refers to unknown principal bob"},
+		{name: "parent after rule", rules: []*PolicyRule{{Name: "protect-src-a", Parent: "protect-src", Paths: []string{"src/a"}, Principals: []string{"alice"}, Threshold: 1}, {Name: "protect-src", Paths: []string{"src/*"}, Principals: []string{"alice"}, Threshold: 1}}, err: "parent protect-src of rule protect-src-a must be defined before it"},
+		{name: "duplicate rule", rules: []*PolicyRule{{Name: "protect-src", Paths: []string{"src/*"}, Principals: []string{"alice"}, Threshold: 1}, {Name: "protect-src", Paths: []string{"lib/*"}, Principals: []string{"alice"}, Threshold: 1}}, err: "rule protect-src is defined more than once"},
+		{name: "threshold above keys", rules: []*PolicyRule{{Name: "protect-src", Paths: []string{"src/*"}, Principals: []string{"alice"}, Threshold: 2}}, err: "invalid threshold 2 for rule protect-src with 1 keys"},
+		{name: "invalid ref", rules: []*PolicyRule{{Name: "protect-main", Refs: []string{"main"}, Principals: []string{"alice"}, Threshold: 1}}, err: "must start with refs/heads/ or refs/tags/"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, _ := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+			_, err := PlanPolicy(store.State(), &Policy{Principals: principals, Rules: test.rules})
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing '%s', got %v", test.err, err)
+			}
+		})
+	}
+
+	t.Run("threshold not met", func(t *testing.T) {
+		store, _ := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+		plan, err := PlanPolicy(store.State(), &Policy{Principals: principals, Rules: []*PolicyRule{{Name: "protect-src", Paths: []string{"src/*"}, Principals: []string{"alice"}, Threshold: 1}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := SignPolicyPlan(plan, []tufkeys.Signer{alice}, true); err == nil || !strings.Contains(err.Error(), "no key specified is authorized to sign for targets") {
+			t.Errorf("expected plan signed without targets key to be rejected, got %v", err)
+		}
+	})
+}
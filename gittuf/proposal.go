@@ -0,0 +1,380 @@
+package gittuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/sirupsen/logrus"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+	tufsign "github.com/theupdateframework/go-tuf/sign"
+)
+
+/*
+SignProposal adds a signature from each signer to every role in the proposal
+that the signer is authorized to sign. Keys authorized for root and top level
+targets are read from the proposed root if the proposal includes one, and
+from the current state otherwise. Keys for delegated roles are read from the
+proposed or current top level targets. The proposal is committed once all
+signatures are added.
+*/
+func SignProposal(state *gitstore.State, proposal *gitstore.Proposal, signers []tufkeys.Signer) error {
+	metadata := proposal.Metadata()
+
+	for _, signer := range signers {
+		keyIDs := signer.PublicData().IDs()
+		signedRoles := []string{}
+
+		for roleName, contents := range metadata {
+			keys, _, err := getProposalRoleKeys(state, metadata, roleName)
+			if err != nil {
+				return err
+			}
+			if roleName == "root" && !state.TipHash().IsZero() {
+				// Root updates are also signed by the current root keys
+				currentRoot, err := loadRoot(state)
+				if err != nil {
+					return err
+				}
+				currentKeys, _ := getRoleKeysFromRoot(currentRoot, "root")
+				for keyID, key := range currentKeys {
+					keys[keyID] = key
+				}
+			}
+			if !isKeyAuthorized(keys, keyIDs) {
+				continue
+			}
+
+			var mb tufdata.Signed
+			if err := json.Unmarshal(contents, &mb); err != nil {
+				return err
+			}
+			if err := tufsign.Sign(&mb, signer); err != nil {
+				return err
+			}
+			signedContents, err := json.Marshal(mb)
+			if err != nil {
+				return err
+			}
+			proposal.StageMetadata(roleName, signedContents)
+			signedRoles = append(signedRoles, roleName)
+		}
+
+		if len(signedRoles) == 0 {
+			return fmt.Errorf("key %s is not authorized to sign any metadata in proposal %s", keyIDs[0], proposal.ID())
+		}
+		logrus.Debugf("Signed %v in proposal %s with key %s", signedRoles, proposal.ID(), keyIDs[0])
+	}
+
+	return proposal.Commit()
+}
+
+/*
+VerifyProposal checks that every role in the proposal is signed by a threshold
+of its authorized keys, and that every role whose metadata it removes is no
+longer delegated once the proposal is applied. It also checks that none of
+these roles were changed in the state after the proposal was created, and
+that no proposed role has a lower version than the same role in the state.
+*/
+func VerifyProposal(store *gitstore.GitStore, proposal *gitstore.Proposal) error {
+	state := store.State()
+	metadata := proposal.Metadata()
+
+	changedRoles := []string{}
+	for roleName := range metadata {
+		changedRoles = append(changedRoles, roleName)
+	}
+	changedRoles = append(changedRoles, proposal.RemovedMetadata()...)
+
+	if proposal.BaseState() != state.Tip() {
+		if proposal.BaseStateHash().IsZero() {
+			return fmt.Errorf("proposal %s initializes gittuf but the repository is already initialized", proposal.ID())
+		}
+		if state.TipHash().IsZero() {
+			return fmt.Errorf("proposal %s is based on state %s which is not available", proposal.ID(), proposal.BaseState())
+		}
+
+		baseState, err := store.SpecificState(proposal.BaseState())
+		if err != nil {
+			return err
+		}
+		for _, roleName := range changedRoles {
+			if baseState.HasFile(roleName) != state.HasFile(roleName) {
+				return fmt.Errorf("role %s changed since proposal %s was created", roleName, proposal.ID())
+			}
+			if !state.HasFile(roleName) {
+				continue
+			}
+			baseContents, err := baseState.GetCurrentMetadataBytes(roleName)
+			if err != nil {
+				return err
+			}
+			currentContents, err := state.GetCurrentMetadataBytes(roleName)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(baseContents, currentContents) {
+				return fmt.Errorf("role %s changed since proposal %s was created", roleName, proposal.ID())
+			}
+		}
+	}
+
+	if err := verifyProposalRemovals(state, proposal); err != nil {
+		return err
+	}
+
+	if !state.TipHash().IsZero() {
+		currentRoles, err := getRoleVersions(state)
+		if err != nil {
+			return err
+		}
+		proposedRoles, err := getMetadataVersions(metadata)
+		if err != nil {
+			return err
+		}
+		if err := compareRoleVersions(currentRoles, proposedRoles); err != nil {
+			return fmt.Errorf("rollback detected in proposal %s: %w", proposal.ID(), err)
+		}
+	}
+
+	for roleName, contents := range metadata {
+		var mb tufdata.Signed
+		if err := json.Unmarshal(contents, &mb); err != nil {
+			return err
+		}
+
+		if roleName == "root" {
+			var err error
+			if proposal.BaseStateHash().IsZero() {
+				var rootRole tufdata.Root
+				if err = json.Unmarshal(mb.Signed, &rootRole); err == nil {
+					err = verifyRootUpdate(nil, &rootRole, &mb)
+				}
+			} else {
+				_, err = verifyNewRoot(state, &mb)
+			}
+			if err != nil {
+				return fmt.Errorf("role %s in proposal %s: %w", roleName, proposal.ID(), err)
+			}
+			continue
+		}
+
+		keys, threshold, err := getProposalRoleKeys(state, metadata, roleName)
+		if err != nil {
+			return err
+		}
+		if err := verifySignatures(&mb, keys, threshold); err != nil {
+			return fmt.Errorf("role %s in proposal %s: %w", roleName, proposal.ID(), err)
+		}
+	}
+
+	return nil
+}
+
+/*
+ApplyProposal verifies the proposal and writes its metadata to the state,
+signing new snapshot metadata with the snapshot signers if the state uses it.
+If the proposal initializes the repository, the gittuf namespace is created
+with the root keys listed in the proposed root. The proposal is removed once
+it is applied.
+*/
+func ApplyProposal(repoRoot string, store *gitstore.GitStore, proposal *gitstore.Proposal, snapshotSigners []tufkeys.Signer) error {
+	if err := VerifyProposal(store, proposal); err != nil {
+		return err
+	}
+
+	if proposal.BaseStateHash().IsZero() {
+		rootKeys, err := getProposalRootKeys(proposal.Metadata())
+		if err != nil {
+			return err
+		}
+		newStore, err := gitstore.InitGitStore(repoRoot, rootKeys, proposal.Metadata())
+		if err != nil {
+			return err
+		}
+		if err := newStore.State().Commit(NewSnapshotter(snapshotSigners)); err != nil {
+			return err
+		}
+	} else {
+		state := store.State()
+		state.StageMultipleMetadata(proposal.Metadata())
+		state.StageMetadataRemoval(proposal.RemovedMetadata())
+		if _, ok := proposal.Metadata()["root"]; ok {
+			rootKeys, err := getProposalRootKeys(proposal.Metadata())
+			if err != nil {
+				return err
+			}
+			if err := state.ReplaceKeys(rootKeys); err != nil {
+				return err
+			}
+		}
+		if err := state.Commit(NewSnapshotter(snapshotSigners)); err != nil {
+			return err
+		}
+	}
+
+	return store.RemoveProposal(proposal.ID())
+}
+
+/*
+verifyProposalRemovals checks that the metadata removed by the proposal
+belongs to rules that the proposal stops delegating. The removal needs no
+signatures of its own, as the proposed metadata of the delegating role is
+signed.
+*/
+func verifyProposalRemovals(state *gitstore.State, proposal *gitstore.Proposal) error {
+	removed := proposal.RemovedMetadata()
+	if len(removed) == 0 {
+		return nil
+	}
+	if proposal.BaseStateHash().IsZero() {
+		return fmt.Errorf("proposal %s initializes gittuf and cannot remove metadata", proposal.ID())
+	}
+
+	rules, err := getAllRules(state)
+	if err != nil {
+		return err
+	}
+	metadata := proposal.Metadata()
+	for _, roleName := range removed {
+		switch roleName {
+		case "root", "targets", gitstore.SnapshotRole:
+			return fmt.Errorf("proposal %s cannot remove metadata for top level role %s", proposal.ID(), roleName)
+		}
+		if _, ok := metadata[roleName]; ok {
+			return fmt.Errorf("proposal %s both updates and removes role %s", proposal.ID(), roleName)
+		}
+
+		for _, rule := range rules {
+			if rule.Delegation.Name != roleName {
+				continue
+			}
+			contents, ok := metadata[rule.Parent]
+			if !ok {
+				return fmt.Errorf("proposal %s removes role %s which is still delegated by %s", proposal.ID(), roleName, rule.Parent)
+			}
+			var parentRole tufdata.Targets
+			if err := unmarshalSignedRole(contents, &parentRole); err != nil {
+				return err
+			}
+			if parentRole.Delegations != nil {
+				for _, d := range parentRole.Delegations.Roles {
+					if d.Name == roleName {
+						return fmt.Errorf("proposal %s removes role %s which is still delegated by %s", proposal.ID(), roleName, rule.Parent)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/*
+getProposalRoleKeys returns the keys authorized to sign the specified role in
+the proposal and their threshold. Rules delegated by other rules are looked up
+in the current state.
+*/
+func getProposalRoleKeys(state *gitstore.State, metadata map[string][]byte, roleName string) (map[string]*tufdata.PublicKey, int, error) {
+	switch roleName {
+	case "root", "targets", gitstore.SnapshotRole:
+		rootRole, err := getProposalRoot(state, metadata)
+		if err != nil {
+			return map[string]*tufdata.PublicKey{}, -1, err
+		}
+		if _, ok := rootRole.Roles[roleName]; !ok {
+			return map[string]*tufdata.PublicKey{}, -1, fmt.Errorf("role %s not found in root", roleName)
+		}
+		keys, threshold := getRoleKeysFromRoot(rootRole, roleName)
+		return keys, threshold, nil
+	}
+
+	var topLevelTargets *tufdata.Targets
+	if contents, ok := metadata["targets"]; ok {
+		topLevelTargets = &tufdata.Targets{}
+		if err := unmarshalSignedRole(contents, topLevelTargets); err != nil {
+			return map[string]*tufdata.PublicKey{}, -1, err
+		}
+	} else {
+		var err error
+		topLevelTargets, err = loadTopLevelTargets(state)
+		if err != nil {
+			return map[string]*tufdata.PublicKey{}, -1, err
+		}
+	}
+
+	if topLevelTargets.Delegations != nil {
+		for _, d := range topLevelTargets.Delegations.Roles {
+			if d.Name != roleName {
+				continue
+			}
+			if d.Threshold < 1 {
+				return map[string]*tufdata.PublicKey{}, -1, fmt.Errorf("rule %s has invalid threshold %d", d.Name, d.Threshold)
+			}
+			keys := map[string]*tufdata.PublicKey{}
+			for _, keyID := range d.KeyIDs {
+				if key, ok := topLevelTargets.Delegations.Keys[keyID]; ok {
+					keys[keyID] = key
+				}
+			}
+			return keys, d.Threshold, nil
+		}
+	}
+
+	// Rules may also be delegated by other rules
+	rule, err := findRule(state, roleName)
+	if err != nil {
+		return map[string]*tufdata.PublicKey{}, -1, fmt.Errorf("no rule found for role %s", roleName)
+	}
+	return rule.Keys, rule.Delegation.Threshold, nil
+}
+
+// getProposalRoot returns the proposed root if the proposal includes one, and
+// the verified root of the state otherwise.
+func getProposalRoot(state *gitstore.State, metadata map[string][]byte) (*tufdata.Root, error) {
+	contents, ok := metadata["root"]
+	if !ok {
+		return loadRoot(state)
+	}
+	var rootRole tufdata.Root
+	err := unmarshalSignedRole(contents, &rootRole)
+	return &rootRole, err
+}
+
+func getProposalRootKeys(metadata map[string][]byte) ([]*tufdata.PublicKey, error) {
+	contents, ok := metadata["root"]
+	if !ok {
+		return []*tufdata.PublicKey{}, fmt.Errorf("proposal does not include root metadata")
+	}
+	var rootRole tufdata.Root
+	if err := unmarshalSignedRole(contents, &rootRole); err != nil {
+		return []*tufdata.PublicKey{}, err
+	}
+	if _, ok := rootRole.Roles["root"]; !ok {
+		return []*tufdata.PublicKey{}, fmt.Errorf("role root not found in root")
+	}
+	roleKeys, _ := getRoleKeysFromRoot(&rootRole, "root")
+	keys := []*tufdata.PublicKey{}
+	for _, key := range roleKeys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func unmarshalSignedRole(contents []byte, role interface{}) error {
+	var mb tufdata.Signed
+	if err := json.Unmarshal(contents, &mb); err != nil {
+		return err
+	}
+	return json.Unmarshal(mb.Signed, role)
+}
+
+func isKeyAuthorized(keys map[string]*tufdata.PublicKey, keyIDs []string) bool {
+	for _, keyID := range keyIDs {
+		if _, ok := keys[keyID]; ok {
+			return true
+		}
+	}
+	return false
+}
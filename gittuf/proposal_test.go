@@ -0,0 +1,102 @@
+package gittuf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func TestVerifyProposalVersions(t *testing.T) {
+	alice := newTestSigner(t)
+	targetsSigner := newTestSigner(t)
+
+	/*
+		newRepository returns a store whose state delegates protect-src from
+		targets, and two further rules from protect-src. It also returns the
+		metadata of targets and protect-src as of each of their versions.
+	*/
+	newRepository := func(t *testing.T) (*gitstore.GitStore, map[string][][]byte) {
+		store, _ := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+		state := store.State()
+		history := map[string][][]byte{}
+		record := func(roleName string) {
+			contents, err := state.GetCurrentMetadataBytes(roleName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			history[roleName] = append(history[roleName], contents)
+		}
+
+		record("targets")
+		addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-src", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+		record("targets")
+		addTestRule(t, state, []tufkeys.Signer{alice}, "protect-src", "protect-src-a", 1, false, []string{"src/a"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+		record("protect-src")
+		addTestRule(t, state, []tufkeys.Signer{alice}, "protect-src", "protect-src-b", 1, false, []string{"src/b"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+		record("protect-src")
+		return store, history
+	}
+
+	tests := []struct {
+		name     string
+		metadata func(t *testing.T, store *gitstore.GitStore, history map[string][][]byte) map[string][]byte
+		err      string
+	}{
+		{
+			name: "newer targets",
+			metadata: func(t *testing.T, store *gitstore.GitStore, history map[string][][]byte) map[string][]byte {
+				updated, err := ResignRoles(store.State(), []string{"targets"}, []tufkeys.Signer{targetsSigner}, time.Now().AddDate(0, 0, 1))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return updated
+			},
+		},
+		{
+			name: "current targets",
+			metadata: func(t *testing.T, store *gitstore.GitStore, history map[string][][]byte) map[string][]byte {
+				return map[string][]byte{"targets": history["targets"][1]}
+			},
+		},
+		{
+			name: "stale targets",
+			metadata: func(t *testing.T, store *gitstore.GitStore, history map[string][][]byte) map[string][]byte {
+				return map[string][]byte{"targets": history["targets"][0]}
+			},
+			err: "role targets has version 1, lower than trusted version 2",
+		},
+		{
+			name: "stale rule",
+			metadata: func(t *testing.T, store *gitstore.GitStore, history map[string][][]byte) map[string][]byte {
+				return map[string][]byte{"protect-src": history["protect-src"][0]}
+			},
+			err: "role protect-src has version 1, lower than trusted version 2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, history := newRepository(t)
+			proposal, err := store.CreateProposal("proposal", test.metadata(t, store, history), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = VerifyProposal(store, proposal)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				if !strings.Contains(err.Error(), "rollback detected in proposal proposal") {
+					t.Errorf("expected rollback to be reported for the proposal, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -13,7 +13,13 @@ import (
 	tufdata "github.com/theupdateframework/go-tuf/data"
 )
 
-func Pull(store *gitstore.GitStore, remoteName string, refName string) error {
+/*
+Pull fetches the gittuf namespace and the branch from the remote, and updates
+the branch if every state since the branch's last trusted state is valid. Only
+the newest state is trusted, so only its metadata must not have expired,
+unless allowExpired is set.
+*/
+func Pull(store *gitstore.GitStore, remoteName string, refName string, allowExpired bool) error {
 	// TODO: If changes are invalid, what state should gitstore be in?
 	currentState := store.State()
 	repository := store.Repository()
@@ -29,6 +35,15 @@ func Pull(store *gitstore.GitStore, remoteName string, refName string) error {
 		logrus.Debug("Latest state available already")
 	}
 
+	if err := store.FetchTimestamp(remoteName); err != nil {
+		return err
+	}
+	if err := verifyTimestamp(store, currentState, allowExpired); err != nil {
+		return err
+	}
+
+	// Branches may be specified by their full ref name, refs/heads/feature/login
+	refName = strings.TrimPrefix(refName, gitBranchRefPrefix)
 	targetName, _ := CreateGitTarget(refName, GitBranchRef)
 	lastTrustedStateID, err := store.LastTrusted(targetName)
 	if err != nil {
@@ -59,6 +74,18 @@ func Pull(store *gitstore.GitStore, remoteName string, refName string) error {
 		return err
 	}
 
+	// Each state on the path must not roll back the roles trusted before it
+	trustedRoles, err := getTrustedRoles(store, targetName, lastTrustedState)
+	if err != nil {
+		return err
+	}
+	for _, s := range pathStates {
+		trustedRoles, err = verifyRoleVersions(trustedRoles, s)
+		if err != nil {
+			return err
+		}
+	}
+
 	// We need to fetch the requisite trees to ensure validation works
 	latestRecordedCommit, err := validateSuccessiveStates(lastTrustedState, pathStates, targetName)
 	if err != nil {
@@ -69,7 +96,11 @@ func Pull(store *gitstore.GitStore, remoteName string, refName string) error {
 		return fmt.Errorf("remote updated without change in state")
 	}
 
-	if err = store.UpdateTrustedState(targetName, newStateID); err != nil {
+	if err := verifyExpiry(currentState, targetName, allowExpired); err != nil {
+		return err
+	}
+
+	if err = store.UpdateTrustedState(targetName, newStateID, trustedRoles); err != nil {
 		return err
 	}
 
@@ -200,20 +231,19 @@ func validateSuccessiveStates(sourceState *gitstore.State, pathStates []*gitstor
 		logrus.Debugf("Comparing trees %s -> %s", currentTree.Hash.String(), nextTree.Hash.String())
 
 		if nextTree.Hash != currentTree.Hash {
-			// This next call is okay because we've verified signatures when loading nextTargets
-			signers, err := nextState.GetUnverifiedSignersForRole(nextRole)
+			signers, err := getVerifiedSigners(currentState, nextState, nextRole)
 			if err != nil {
 				return tufdata.HexBytes{}, err
 			}
 
 			logrus.Debugf("Target %s in state %s is signed by: %s", targetName, pathStates[i].Tip(), strings.Join(signers, ", "))
 
-			changes, err := currentTree.Diff(nextTree)
+			changes, err := diffTrees(currentTree, nextTree)
 			if err != nil {
 				return tufdata.HexBytes{}, err
 			}
 
-			err = validateChanges(currentState, changes, signers)
+			_, err = validateChanges(currentState, changes, signers)
 			if err != nil {
 				return tufdata.HexBytes{}, err
 			}
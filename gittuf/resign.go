@@ -0,0 +1,191 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+/*
+ResignRoles returns new versions of the specified roles with their version
+incremented and expiry updated. If expires is zero, the default expiry of each
+role is used. Each role is signed by the signers authorized by its delegating
+role, and must meet the threshold set there. Roles that have expired can be
+refreshed, but their current signatures must still be valid. Snapshot
+metadata is not included as it is recreated whenever the state is committed.
+*/
+func ResignRoles(state *gitstore.State, roleNames []string, signers []tufkeys.Signer, expires time.Time) (map[string][]byte, error) {
+	// Root and top level targets are refreshed first as they determine the
+	// keys for the remaining roles.
+	roleNames = append([]string{}, roleNames...)
+	sort.Slice(roleNames, func(i, j int) bool {
+		return resignOrder(roleNames[i]) < resignOrder(roleNames[j]) ||
+			(resignOrder(roleNames[i]) == resignOrder(roleNames[j]) && roleNames[i] < roleNames[j])
+	})
+
+	usedSigners := map[int]bool{}
+	updated := map[string][]byte{}
+	for _, roleName := range roleNames {
+		if _, ok := updated[roleName]; ok || roleName == gitstore.SnapshotRole {
+			continue
+		}
+		if !state.HasFile(roleName) {
+			return map[string][]byte{}, fmt.Errorf("metadata for role %s not found", roleName)
+		}
+
+		keys, threshold, err := getResignRoleKeys(state, updated, roleName)
+		if err != nil {
+			return map[string][]byte{}, err
+		}
+
+		// Roles recording a branch or tag are also signed by the keys that
+		// authorized the changes they record, which may belong to any rule
+		verify := verifySignatures
+		attestingKeys := map[string]*tufdata.PublicKey{}
+		if _, ok := getTargetForRoleName(roleName); ok {
+			verify = verifyThreshold
+			attestingKeys, err = getAllRuleKeys(state)
+			if err != nil {
+				return map[string][]byte{}, err
+			}
+		}
+
+		contents, err := state.GetCurrentMetadataBytes(roleName)
+		if err != nil {
+			return map[string][]byte{}, err
+		}
+		var mb tufdata.Signed
+		if err := json.Unmarshal(contents, &mb); err != nil {
+			return map[string][]byte{}, err
+		}
+
+		roleExpires := expires
+		if roleExpires.IsZero() {
+			roleExpires = tufdata.DefaultExpires(roleName)
+		}
+
+		var role interface{}
+		var currentRoot *tufdata.Root
+		if roleName == "root" {
+			currentRoot, err = loadRoot(state)
+			if err != nil {
+				return map[string][]byte{}, err
+			}
+			var rootRole tufdata.Root
+			if err := json.Unmarshal(mb.Signed, &rootRole); err != nil {
+				return map[string][]byte{}, err
+			}
+			rootRole.Version++
+			rootRole.Expires = roleExpires
+			role = &rootRole
+		} else {
+			if threshold > 0 {
+				if err := verify(&mb, keys, threshold); err != nil {
+					return map[string][]byte{}, fmt.Errorf("unable to verify current metadata for role %s: %w", roleName, err)
+				}
+			}
+			var targetsRole tufdata.Targets
+			if err := json.Unmarshal(mb.Signed, &targetsRole); err != nil {
+				return map[string][]byte{}, err
+			}
+			if targetsRole.Type != "targets" {
+				return map[string][]byte{}, fmt.Errorf("role %s has unsupported type %s", roleName, targetsRole.Type)
+			}
+			targetsRole.Version++
+			targetsRole.Expires = roleExpires
+			role = &targetsRole
+		}
+
+		roleSigners := []tufkeys.Signer{}
+		for i, signer := range signers {
+			// Any key may sign a role covered by the allow rule
+			if threshold == 0 || isKeyAuthorized(keys, signer.PublicData().IDs()) || isKeyAuthorized(attestingKeys, signer.PublicData().IDs()) {
+				roleSigners = append(roleSigners, signer)
+				usedSigners[i] = true
+			}
+		}
+
+		newMb, err := generateAndSignMbFromStruct(role, roleSigners)
+		if err != nil {
+			return map[string][]byte{}, err
+		}
+		if currentRoot != nil {
+			err = verifyRootUpdate(currentRoot, role.(*tufdata.Root), &newMb)
+		} else if threshold > 0 {
+			err = verify(&newMb, keys, threshold)
+		}
+		if err != nil {
+			return map[string][]byte{}, fmt.Errorf("role %s: %w", roleName, err)
+		}
+
+		newBytes, err := json.Marshal(newMb)
+		if err != nil {
+			return map[string][]byte{}, err
+		}
+		updated[roleName] = newBytes
+	}
+
+	for i, signer := range signers {
+		if !usedSigners[i] {
+			return map[string][]byte{}, fmt.Errorf("key %s is not authorized to sign any of the roles", signer.PublicData().IDs()[0])
+		}
+	}
+
+	return updated, nil
+}
+
+/*
+getResignRoleKeys returns the keys authorized to sign the role and their
+threshold. Roles that record the state of a branch or tag are signed by the
+keys of one of the rules that protect the ref, the first rule whose keys
+verify the current metadata is used. A threshold of zero indicates the ref is
+only covered by the allow rule.
+*/
+func getResignRoleKeys(state *gitstore.State, updated map[string][]byte, roleName string) (map[string]*tufdata.PublicKey, int, error) {
+	keys, threshold, err := getProposalRoleKeys(state, updated, roleName)
+	if err == nil || roleName == "root" || roleName == "targets" {
+		return keys, threshold, err
+	}
+
+	target, ok := getTargetForRoleName(roleName)
+	if !ok {
+		return keys, threshold, err
+	}
+	expected, err := ExpectedSignersForTarget(state, target)
+	if err != nil {
+		return map[string]*tufdata.PublicKey{}, -1, err
+	}
+
+	contents, err := state.GetCurrentMetadataBytes(roleName)
+	if err != nil {
+		return map[string]*tufdata.PublicKey{}, -1, err
+	}
+	var roleMb tufdata.Signed
+	if err := json.Unmarshal(contents, &roleMb); err != nil {
+		return map[string]*tufdata.PublicKey{}, -1, err
+	}
+	for _, e := range expected {
+		if e.IsAllowRule {
+			return e.Keys, 0, nil
+		}
+		if verifyThreshold(&roleMb, e.Keys, e.Threshold) == nil {
+			return e.Keys, e.Threshold, nil
+		}
+	}
+	return map[string]*tufdata.PublicKey{}, -1, fmt.Errorf("role %s is not signed by the keys of any rule protecting %s", roleName, target)
+}
+
+func resignOrder(roleName string) int {
+	switch roleName {
+	case "root":
+		return 0
+	case "targets":
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,128 @@
+package gittuf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func TestResignRoles(t *testing.T) {
+	alice, bob, carol := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	targetsSigner := newTestSigner(t)
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	/*
+		newRepository returns a store whose state delegates protect-src from
+		targets to alice and bob with a threshold of two, and protect-src-a from
+		protect-src.
+	*/
+	newRepository := func(t *testing.T) *gitstore.GitStore {
+		store, _ := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+		state := store.State()
+		addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-src", 2, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{alice, bob}))
+		addTestRule(t, state, []tufkeys.Signer{alice, bob}, "protect-src", "protect-src-a", 1, false, []string{"src/a"}, nil, publicKeysForSigners([]tufkeys.Signer{carol}))
+		return store
+	}
+
+	tests := []struct {
+		name    string
+		roles   []string
+		signers []tufkeys.Signer
+		err     string
+	}{
+		{name: "targets and rule", roles: []string{"protect-src", "targets"}, signers: []tufkeys.Signer{alice, bob, targetsSigner}},
+		{name: "rule below threshold", roles: []string{"protect-src"}, signers: []tufkeys.Signer{alice}, err: "role protect-src: threshold not met, 1 of 2 signatures"},
+		{name: "unauthorized key", roles: []string{"targets"}, signers: []tufkeys.Signer{targetsSigner, carol}, err: "is not authorized to sign any of the roles"},
+		{name: "missing role", roles: []string{"protect-src-a"}, signers: []tufkeys.Signer{carol}, err: "metadata for role protect-src-a not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newRepository(t)
+			state := store.State()
+			before, err := GetRoleExpiries(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			updated, err := ResignRoles(state, test.roles, test.signers, expires)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := state.StageAndCommitMultipleMetadata(updated, testSnapshotter()); err != nil {
+				t.Fatal(err)
+			}
+
+			after, err := GetRoleExpiries(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			versions := map[string]int64{}
+			for _, e := range before {
+				versions[e.Role] = e.Version
+			}
+			for _, e := range after {
+				if _, ok := updated[e.Role]; !ok {
+					continue
+				}
+				if e.Version != versions[e.Role]+1 {
+					t.Errorf("expected role %s to have version %d, got %d", e.Role, versions[e.Role]+1, e.Version)
+				}
+				if !e.Expires.Equal(expires) {
+					t.Errorf("expected role %s to expire at %s, got %s", e.Role, expires, e.Expires)
+				}
+			}
+
+			// The rule delegated by protect-src is only found if the resigned
+			// roles verify with the keys of the roles delegating them
+			if _, err := findRule(state, "protect-src-a"); err != nil {
+				t.Errorf("expected resigned roles to be verified, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGetRolesExpiringWithin(t *testing.T) {
+	alice, targetsSigner := newTestSigner(t), newTestSigner(t)
+	store, _ := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+	state := store.State()
+	addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-src", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+	addTestRule(t, state, []tufkeys.Signer{alice}, "protect-src", "protect-src-a", 1, false, []string{"src/a"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+
+	updated, err := ResignRoles(state, []string{"protect-src"}, []tufkeys.Signer{alice}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.StageAndCommitMultipleMetadata(updated, testSnapshotter()); err != nil {
+		t.Fatal(err)
+	}
+
+	expiring, err := GetRolesExpiringWithin(state, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expiring) != 1 || expiring[0].Role != "protect-src" {
+		t.Errorf("expected only protect-src to be expiring, got %v", expiring)
+	}
+
+	expiring, err = GetRolesExpiringWithin(state, tufdata.DefaultExpires("root").Sub(time.Now())+time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := state.GetAllCurrentMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expiring) != len(metadata) {
+		t.Errorf("expected every role to be expiring, got %v", expiring)
+	}
+}
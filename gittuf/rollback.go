@@ -0,0 +1,263 @@
+package gittuf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/sirupsen/logrus"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+)
+
+/*
+TrustState records the state as the last trusted state of the target. The
+versions of the roles in the state are checked against those previously
+trusted for the target to ensure none of them were rolled back, and the roles
+must not have expired unless allowExpired is set. For tags, the recorded
+object must also be unchanged unless its move was approved.
+*/
+func TrustState(store *gitstore.GitStore, target string, state *gitstore.State, allowExpired bool) error {
+	if _, refType, err := ParseGitTarget(target); err == nil && refType == GitTagRef {
+		if err := verifyTagImmutability(store, target, state); err != nil {
+			return err
+		}
+	}
+
+	if err := verifyExpiry(state, target, allowExpired); err != nil {
+		return err
+	}
+
+	trustedRoles, err := getTrustedRoles(store, target, state)
+	if err != nil {
+		return err
+	}
+	trustedRoles, err = verifyRoleVersions(trustedRoles, state)
+	if err != nil {
+		return err
+	}
+	return store.UpdateTrustedState(target, state.Tip(), trustedRoles)
+}
+
+/*
+getTrustedRoles returns the versions of the roles last trusted for the target.
+Records written before versions were tracked only hold the trusted state, in
+which case the versions are read from that state. A target that has no trusted
+state yet has no trusted versions. Roles whose removal is authorized in the
+history of state after the trusted state are left out, as a role created
+again with the same name starts over from the first version.
+*/
+func getTrustedRoles(store *gitstore.GitStore, target string, state *gitstore.State) (map[string]gitstore.TrustedRole, error) {
+	lastTrusted, err := store.GetLastTrusted()
+	if err != nil {
+		return map[string]gitstore.TrustedRole{}, err
+	}
+	trustedState, ok := lastTrusted[target]
+	if !ok {
+		return map[string]gitstore.TrustedRole{}, nil
+	}
+
+	trustedRoles := trustedState.Roles
+	if trustedRoles == nil {
+		s, err := store.SpecificState(trustedState.State)
+		if err != nil {
+			return map[string]gitstore.TrustedRole{}, err
+		}
+		trustedRoles, err = getRoleVersions(s)
+		if err != nil {
+			return map[string]gitstore.TrustedRole{}, err
+		}
+	}
+
+	roles := map[string]gitstore.TrustedRole{}
+	for roleName, role := range trustedRoles {
+		removed, err := isRoleRemovalAuthorized(store, state, trustedState.State, roleName)
+		if err != nil {
+			return map[string]gitstore.TrustedRole{}, err
+		}
+		if !removed {
+			roles[roleName] = role
+		}
+	}
+	return roles, nil
+}
+
+/*
+isRoleRemovalAuthorized reports whether the metadata of the role was removed
+in the history of state after the trusted state in a way that allows the role
+to be created again from the first version. A state in which the metadata is
+missing must be valid, so its snapshot, signed by the snapshot keys, does not
+list the role either. This suffices for roles recording branches and tags,
+which are removed by deleting their metadata. A rule must also no longer be
+delegated in that state, so its removal is signed by the role that delegated
+it. The top level roles can never be removed.
+*/
+func isRoleRemovalAuthorized(store *gitstore.GitStore, state *gitstore.State, trustedStateID string, roleName string) (bool, error) {
+	switch roleName {
+	case "root", "targets", gitstore.SnapshotRole:
+		return false, nil
+	}
+
+	removedIn, err := state.MetadataRemovedSince(trustedStateID, roleName)
+	if err != nil {
+		return false, err
+	}
+	for _, stateID := range removedIn {
+		removedState, err := store.SpecificState(stateID)
+		if err != nil {
+			return false, err
+		}
+		if _, err := loadRoot(removedState); err != nil {
+			logrus.Debugf("Ignoring removal of role %s in state %s: %s", roleName, stateID, err)
+			continue
+		}
+		if _, ok := getTargetForRoleName(roleName); ok {
+			return true, nil
+		}
+		delegated, err := isRuleDelegated(removedState, roleName)
+		if err != nil {
+			logrus.Debugf("Ignoring removal of role %s in state %s: %s", roleName, stateID, err)
+			continue
+		}
+		if !delegated {
+			return true, nil
+		}
+		logrus.Debugf("Ignoring removal of role %s in state %s as it is still delegated", roleName, stateID)
+	}
+	return false, nil
+}
+
+// isRuleDelegated reports whether the rule is delegated in the state.
+func isRuleDelegated(state *gitstore.State, ruleName string) (bool, error) {
+	rules, err := getAllRules(state)
+	if err != nil {
+		return false, err
+	}
+	for _, rule := range rules {
+		if rule.Delegation.Name == ruleName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/*
+verifyRoleVersions checks that no role in the state has a lower version than
+the trusted version, and that a role whose version is unchanged also has
+unchanged contents. It returns the versions of the roles in the state, which
+become the trusted versions once the state is trusted.
+*/
+func verifyRoleVersions(trustedRoles map[string]gitstore.TrustedRole, state *gitstore.State) (map[string]gitstore.TrustedRole, error) {
+	roles, err := getRoleVersions(state)
+	if err != nil {
+		return map[string]gitstore.TrustedRole{}, err
+	}
+	if err := compareRoleVersions(trustedRoles, roles); err != nil {
+		return map[string]gitstore.TrustedRole{}, fmt.Errorf("rollback detected in state %s: %w", state.Tip(), err)
+	}
+	return roles, nil
+}
+
+// compareRoleVersions checks the versions of the roles against the trusted
+// versions of roles with the same names.
+func compareRoleVersions(trustedRoles map[string]gitstore.TrustedRole, roles map[string]gitstore.TrustedRole) error {
+	for roleName, role := range roles {
+		trusted, ok := trustedRoles[roleName]
+		if !ok {
+			continue
+		}
+		if role.Version < trusted.Version {
+			return fmt.Errorf("role %s has version %d, lower than trusted version %d", roleName, role.Version, trusted.Version)
+		}
+		if role.Version == trusted.Version && role.Hash != trusted.Hash {
+			return fmt.Errorf("role %s changed without incrementing trusted version %d", roleName, trusted.Version)
+		}
+	}
+	return nil
+}
+
+// getRoleVersions returns the version and the hash of the signed contents of
+// every role in the state.
+func getRoleVersions(state *gitstore.State) (map[string]gitstore.TrustedRole, error) {
+	metadata, err := state.GetAllCurrentMetadata()
+	if err != nil {
+		return map[string]gitstore.TrustedRole{}, err
+	}
+	return getMetadataVersions(metadata)
+}
+
+// getMetadataVersions returns the version and the hash of the signed contents
+// of every role in the metadata.
+func getMetadataVersions(metadata map[string][]byte) (map[string]gitstore.TrustedRole, error) {
+	roles := map[string]gitstore.TrustedRole{}
+	for roleName, contents := range metadata {
+		var mb tufdata.Signed
+		if err := json.Unmarshal(contents, &mb); err != nil {
+			return map[string]gitstore.TrustedRole{}, err
+		}
+		var role struct {
+			Version int64 `json:"version"`
+		}
+		if err := json.Unmarshal(mb.Signed, &role); err != nil {
+			return map[string]gitstore.TrustedRole{}, fmt.Errorf("unable to read metadata for role %s: %w", roleName, err)
+		}
+		hash, err := hashSignedRole(&mb)
+		if err != nil {
+			return map[string]gitstore.TrustedRole{}, fmt.Errorf("unable to read metadata for role %s: %w", roleName, err)
+		}
+		roles[roleName] = gitstore.TrustedRole{
+			Version: role.Version,
+			Hash:    hash,
+		}
+	}
+	return roles, nil
+}
+
+/*
+hashSignedRole returns the hash of the signed contents of the role, which is
+recorded when the role is trusted. The contents are hashed in their canonical
+encoding, which is what the role's signatures cover, so the hash does not
+depend on how the metadata happens to be formatted.
+*/
+func hashSignedRole(mb *tufdata.Signed) (string, error) {
+	var role interface{}
+	if err := json.Unmarshal(mb.Signed, &role); err != nil {
+		return "", err
+	}
+	msg, err := cjson.EncodeCanonical(role)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(msg)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+/*
+getTrustedRootAnchor returns the highest version of root trusted locally for
+any target, along with the state it was trusted in. It returns nil if no
+version of root has been trusted yet, in which case the first root of a state
+is trusted on first use.
+*/
+func getTrustedRootAnchor(store *gitstore.GitStore) (*gitstore.TrustedRole, string, error) {
+	lastTrusted, err := store.GetLastTrusted()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var anchor *gitstore.TrustedRole
+	anchorState := ""
+	for _, trustedState := range lastTrusted {
+		role, ok := trustedState.Roles["root"]
+		if !ok {
+			continue
+		}
+		if anchor == nil || role.Version > anchor.Version {
+			role := role
+			anchor = &role
+			anchorState = trustedState.State
+		}
+	}
+	return anchor, anchorState, nil
+}
@@ -0,0 +1,264 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// writeTestTargets commits a version of the top level targets role, changed
+// by update, signed by signers.
+func writeTestTargets(t *testing.T, state *gitstore.State, signers []tufkeys.Signer, update func(*tufdata.Targets)) {
+	t.Helper()
+	targets, err := loadTopLevelTargets(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(targets)
+	targetsMb, err := generateAndSignMbFromStruct(targets, signers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := json.Marshal(targetsMb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.StageMetadataAndCommit("targets", contents, testSnapshotter()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashSignedRole(t *testing.T) {
+	tests := []struct {
+		name  string
+		a     string
+		b     string
+		equal bool
+	}{
+		{name: "identical", a: `{"_type":"targets","version":1}`, b: `{"_type":"targets","version":1}`, equal: true},
+		{name: "reordered", a: `{"_type":"targets","version":1}`, b: `{"version":1,"_type":"targets"}`, equal: true},
+		{name: "whitespace", a: `{"_type":"targets","version":1}`, b: "{\n  \"_type\": \"targets\",\n  \"version\": 1\n}", equal: true},
+		{name: "changed", a: `{"_type":"targets","version":1}`, b: `{"_type":"targets","version":2}`, equal: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hashA, err := hashSignedRole(&tufdata.Signed{Signed: []byte(test.a)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			hashB, err := hashSignedRole(&tufdata.Signed{Signed: []byte(test.b)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (hashA == hashB) != test.equal {
+				t.Errorf("expected equal hashes to be %t, got %s and %s", test.equal, hashA, hashB)
+			}
+		})
+	}
+
+	if _, err := hashSignedRole(&tufdata.Signed{Signed: []byte(`{`)}); err == nil {
+		t.Error("expected invalid metadata to be rejected")
+	}
+}
+
+func TestVerifyRoleVersions(t *testing.T) {
+	rootSigner, targetsSigner := newTestSigner(t), newTestSigner(t)
+	store, _ := newTestStore(t, []tufkeys.Signer{rootSigner}, []tufkeys.Signer{targetsSigner})
+	state := store.State()
+	writeTestTargets(t, state, []tufkeys.Signer{targetsSigner}, func(targets *tufdata.Targets) {
+		targets.Version = 2
+	})
+
+	current, err := getRoleVersions(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current["targets"].Version != 2 {
+		t.Fatalf("expected targets version 2, got %d", current["targets"].Version)
+	}
+
+	tests := []struct {
+		name    string
+		trusted gitstore.TrustedRole
+		err     string
+	}{
+		{name: "unchanged", trusted: current["targets"]},
+		{name: "older trusted version", trusted: gitstore.TrustedRole{Version: 1, Hash: "other"}},
+		{name: "newer trusted version", trusted: gitstore.TrustedRole{Version: 3, Hash: current["targets"].Hash}, err: "lower than trusted version 3"},
+		{name: "same version changed", trusted: gitstore.TrustedRole{Version: 2, Hash: "other"}, err: "changed without incrementing trusted version 2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			roles, err := verifyRoleVersions(map[string]gitstore.TrustedRole{"targets": test.trusted}, state)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if roles["targets"] != current["targets"] {
+				t.Errorf("expected trusted targets %v, got %v", current["targets"], roles["targets"])
+			}
+		})
+	}
+}
+
+func TestTrustStateRollback(t *testing.T) {
+	rootSigner, targetsSigner := newTestSigner(t), newTestSigner(t)
+	store, _ := newTestStore(t, []tufkeys.Signer{rootSigner}, []tufkeys.Signer{targetsSigner})
+	target := "git:branch=main"
+	state := store.State()
+	initialState := state.Tip()
+
+	writeTestTargets(t, state, []tufkeys.Signer{targetsSigner}, func(targets *tufdata.Targets) {
+		targets.Version = 2
+	})
+	if err := TrustState(store, target, state, false); err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := store.LastTrustedState(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trusted.State != state.Tip() || trusted.Roles["targets"].Version != 2 {
+		t.Fatalf("expected state %s with targets version 2 to be trusted, got %s with version %d", state.Tip(), trusted.State, trusted.Roles["targets"].Version)
+	}
+
+	// The older state has version 1 of targets
+	older, err := store.SpecificState(initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := TrustState(store, target, older, false); err == nil || !strings.Contains(err.Error(), "rollback detected") {
+		t.Errorf("expected rollback to be detected, got %v", err)
+	}
+
+	// A different version 2 is a rollback too
+	rewritten, err := store.SpecificState(initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestTargets(t, rewritten, []tufkeys.Signer{targetsSigner}, func(targets *tufdata.Targets) {
+		targets.Version = 2
+		targets.Expires = targets.Expires.AddDate(0, 0, 1)
+	})
+	if err := TrustState(store, target, rewritten, false); err == nil || !strings.Contains(err.Error(), "changed without incrementing") {
+		t.Errorf("expected changed role to be detected, got %v", err)
+	}
+
+	// Other targets have their own trusted versions
+	if err := TrustState(store, "git:branch=feature", older, false); err != nil {
+		t.Errorf("expected state to be trusted for another target, got %v", err)
+	}
+}
+
+func TestTrustStateRoleRemoval(t *testing.T) {
+	rootSigner, targetsSigner, alice := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	target := "git:branch=main"
+
+	// stageRole commits the version of the role signed by alice
+	stageRole := func(t *testing.T, state *gitstore.State, roleName string, version int64) {
+		role := tufdata.NewTargets()
+		role.Version = version
+		roleMb, err := generateAndSignMbFromStruct(role, []tufkeys.Signer{alice})
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := json.Marshal(roleMb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := state.StageMetadataAndCommit(roleName, contents, testSnapshotter()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		roleName string
+		remove   func(t *testing.T, state *gitstore.State)
+		err      string
+	}{
+		{
+			name:     "rule removed from delegations",
+			roleName: "protect-src",
+			remove: func(t *testing.T, state *gitstore.State) {
+				writeTestTargets(t, state, []tufkeys.Signer{targetsSigner}, func(targets *tufdata.Targets) {
+					targets.Version++
+					roles := []tufdata.DelegatedRole{}
+					for _, role := range targets.Delegations.Roles {
+						if role.Name != "protect-src" {
+							roles = append(roles, role)
+						}
+					}
+					targets.Delegations.Roles = roles
+				})
+				if err := state.RemoveMetadata([]string{"protect-src"}, testSnapshotter()); err != nil {
+					t.Fatal(err)
+				}
+				addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-src", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+			},
+		},
+		{
+			name:     "rule metadata removed while delegated",
+			roleName: "protect-src",
+			remove: func(t *testing.T, state *gitstore.State) {
+				if err := state.RemoveMetadata([]string{"protect-src"}, testSnapshotter()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "rollback detected",
+		},
+		{
+			name:     "branch role removed",
+			roleName: "branch/main",
+			remove: func(t *testing.T, state *gitstore.State) {
+				if err := state.RemoveMetadata([]string{"branch/main"}, testSnapshotter()); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:     "branch role removed without snapshot",
+			roleName: "branch/main",
+			remove: func(t *testing.T, state *gitstore.State) {
+				if err := state.RemoveMetadata([]string{"branch/main"}, nil); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "rollback detected",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, _ := newTestStore(t, []tufkeys.Signer{rootSigner}, []tufkeys.Signer{targetsSigner})
+			state := store.State()
+			addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-src", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+			stageRole(t, state, test.roleName, 2)
+			if err := TrustState(store, target, state, false); err != nil {
+				t.Fatal(err)
+			}
+
+			// The role is created again from the first version
+			test.remove(t, state)
+			stageRole(t, state, test.roleName, 1)
+			err := TrustState(store, target, state, false)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
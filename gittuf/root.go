@@ -0,0 +1,204 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// AddRootKeys returns a new version of root that adds the keys to the root
+// role.
+func AddRootKeys(state *gitstore.State, signers []tufkeys.Signer, keys []*tufdata.PublicKey, expires time.Time) (tufdata.Signed, error) {
+	return updateRoot(state, signers, expires, func(rootRole *tufdata.Root) error {
+		for _, key := range keys {
+			if err := addRootKey(rootRole, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveRootKeys returns a new version of root that removes the keys with the
+// specified IDs from the root role.
+func RemoveRootKeys(state *gitstore.State, signers []tufkeys.Signer, keyIDs []string, expires time.Time) (tufdata.Signed, error) {
+	return updateRoot(state, signers, expires, func(rootRole *tufdata.Root) error {
+		for _, keyID := range keyIDs {
+			if err := removeRootKey(rootRole, keyID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetRootThreshold returns a new version of root that changes the threshold of
+// the root role.
+func SetRootThreshold(state *gitstore.State, signers []tufkeys.Signer, threshold int, expires time.Time) (tufdata.Signed, error) {
+	return updateRoot(state, signers, expires, func(rootRole *tufdata.Root) error {
+		rootRole.Roles["root"].Threshold = threshold
+		return nil
+	})
+}
+
+/*
+RotateRootKeys returns a new version of root that replaces all the keys of the
+root role with the specified keys. If threshold is zero, the current threshold
+is retained.
+*/
+func RotateRootKeys(state *gitstore.State, signers []tufkeys.Signer, keys []*tufdata.PublicKey, threshold int, expires time.Time) (tufdata.Signed, error) {
+	return updateRoot(state, signers, expires, func(rootRole *tufdata.Root) error {
+		for _, keyID := range append([]string{}, rootRole.Roles["root"].KeyIDs...) {
+			if err := removeRootKey(rootRole, keyID); err != nil {
+				return err
+			}
+		}
+		for _, key := range keys {
+			if err := addRootKey(rootRole, key); err != nil {
+				return err
+			}
+		}
+		if threshold != 0 {
+			rootRole.Roles["root"].Threshold = threshold
+		}
+		return nil
+	})
+}
+
+/*
+WriteRoot verifies that the root metadata is a valid successor of the state's
+current root and commits it, along with snapshot metadata signed by the
+snapshot signers if the state uses it. The keys tree of the state is updated
+to match the keys of the new root role.
+*/
+func WriteRoot(state *gitstore.State, rootMb tufdata.Signed, snapshotSigners []tufkeys.Signer) error {
+	rootKeys, err := verifyNewRoot(state, &rootMb)
+	if err != nil {
+		return err
+	}
+
+	rootBytes, err := json.Marshal(rootMb)
+	if err != nil {
+		return err
+	}
+
+	state.StageMetadata("root", rootBytes)
+	if err := state.ReplaceKeys(rootKeys); err != nil {
+		return err
+	}
+	return state.Commit(NewSnapshotter(snapshotSigners))
+}
+
+/*
+updateRoot loads the current root of the state, applies the update, and
+returns the new version signed by the signers. Each signer must be a root key
+in either the current or the new version, and the new version must be signed
+by a threshold of both to be written to the state.
+*/
+func updateRoot(state *gitstore.State, signers []tufkeys.Signer, expires time.Time, update func(*tufdata.Root) error) (tufdata.Signed, error) {
+	currentRoot, err := loadRoot(state)
+	if err != nil {
+		return tufdata.Signed{}, err
+	}
+
+	// Work on a copy so the cached root is not modified
+	rootRole := &tufdata.Root{}
+	rootBytes, err := json.Marshal(currentRoot)
+	if err != nil {
+		return tufdata.Signed{}, err
+	}
+	if err := json.Unmarshal(rootBytes, rootRole); err != nil {
+		return tufdata.Signed{}, err
+	}
+
+	if err := update(rootRole); err != nil {
+		return tufdata.Signed{}, err
+	}
+
+	role := rootRole.Roles["root"]
+	if len(role.KeyIDs) == 0 {
+		return tufdata.Signed{}, fmt.Errorf("root role must have at least one key")
+	}
+	if role.Threshold < 1 || role.Threshold > len(role.KeyIDs) {
+		return tufdata.Signed{}, fmt.Errorf("root threshold %d is invalid for %d keys", role.Threshold, len(role.KeyIDs))
+	}
+
+	currentKeys, _ := getRoleKeysFromRoot(currentRoot, "root")
+	newKeys, _ := getRoleKeysFromRoot(rootRole, "root")
+	for _, signer := range signers {
+		keyIDs := signer.PublicData().IDs()
+		if !isKeyAuthorized(currentKeys, keyIDs) && !isKeyAuthorized(newKeys, keyIDs) {
+			return tufdata.Signed{}, fmt.Errorf("key %s is not a root key", keyIDs[0])
+		}
+	}
+
+	rootRole.Version = currentRoot.Version + 1
+	rootRole.Expires = expires
+
+	return generateAndSignMbFromStruct(rootRole, signers)
+}
+
+// verifyNewRoot checks the root metadata is a valid successor of the state's
+// current root and returns the keys of its root role.
+func verifyNewRoot(state *gitstore.State, rootMb *tufdata.Signed) ([]*tufdata.PublicKey, error) {
+	currentRoot, err := loadRoot(state)
+	if err != nil {
+		return []*tufdata.PublicKey{}, err
+	}
+
+	var newRoot tufdata.Root
+	if err := json.Unmarshal(rootMb.Signed, &newRoot); err != nil {
+		return []*tufdata.PublicKey{}, err
+	}
+	if err := verifyRootUpdate(currentRoot, &newRoot, rootMb); err != nil {
+		return []*tufdata.PublicKey{}, err
+	}
+
+	keys, _ := getRoleKeysFromRoot(&newRoot, "root")
+	rootKeys := []*tufdata.PublicKey{}
+	for _, key := range keys {
+		rootKeys = append(rootKeys, key)
+	}
+	return rootKeys, nil
+}
+
+func addRootKey(rootRole *tufdata.Root, key *tufdata.PublicKey) error {
+	keyID := key.IDs()[0]
+	for _, existingKeyID := range rootRole.Roles["root"].KeyIDs {
+		if existingKeyID == keyID {
+			return fmt.Errorf("key %s is already a root key", keyID)
+		}
+	}
+	rootRole.AddKey(key)
+	rootRole.Roles["root"].KeyIDs = append(rootRole.Roles["root"].KeyIDs, keyID)
+	return nil
+}
+
+func removeRootKey(rootRole *tufdata.Root, keyID string) error {
+	role := rootRole.Roles["root"]
+	keyIDs := []string{}
+	for _, existingKeyID := range role.KeyIDs {
+		if existingKeyID != keyID {
+			keyIDs = append(keyIDs, existingKeyID)
+		}
+	}
+	if len(keyIDs) == len(role.KeyIDs) {
+		return fmt.Errorf("key %s is not a root key", keyID)
+	}
+	role.KeyIDs = keyIDs
+
+	// Keys may also be used by other top level roles
+	for _, r := range rootRole.Roles {
+		for _, k := range r.KeyIDs {
+			if k == keyID {
+				return nil
+			}
+		}
+	}
+	delete(rootRole.Keys, keyID)
+	return nil
+}
@@ -0,0 +1,244 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// writeRootUnverified commits the root metadata to the state without checking
+// that it chains from the current root, as a malicious state would.
+func writeRootUnverified(t *testing.T, state *gitstore.State, rootMb tufdata.Signed) {
+	t.Helper()
+	var rootRole tufdata.Root
+	if err := json.Unmarshal(rootMb.Signed, &rootRole); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := getRoleKeysFromRoot(&rootRole, "root")
+	rootKeys := []*tufdata.PublicKey{}
+	for _, key := range keys {
+		rootKeys = append(rootKeys, key)
+	}
+	rootBytes, err := json.Marshal(rootMb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.StageMetadata("root", rootBytes)
+	if err := state.ReplaceKeys(rootKeys); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Commit(testSnapshotter()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rotateRoot returns a new version of root with the root keys replaced by
+// those of newSigners, signed by signers.
+func rotateRoot(t *testing.T, state *gitstore.State, newSigners []tufkeys.Signer, signers []tufkeys.Signer) tufdata.Signed {
+	t.Helper()
+	rootMb, err := RotateRootKeys(state, signers, publicKeysForSigners(newSigners), 0, tufdata.DefaultExpires("root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rootMb
+}
+
+func TestRootRotation(t *testing.T) {
+	oldKey, newKey, targetsKey := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	store, dir := newTestStore(t, []tufkeys.Signer{oldKey}, []tufkeys.Signer{targetsKey})
+	state := store.State()
+
+	rootMb := rotateRoot(t, state, []tufkeys.Signer{newKey}, []tufkeys.Signer{oldKey, newKey})
+	if err := WriteRoot(state, rootMb, []tufkeys.Signer{testSnapshotSigner}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := gitstore.LoadGitStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootRole, err := loadRoot(reloaded.State())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootRole.Version != 2 {
+		t.Errorf("expected root version 2, got %d", rootRole.Version)
+	}
+	if !isKeyAuthorized(rootRole.Keys, newKey.PublicData().IDs()) {
+		t.Errorf("expected rotated root to contain the new key")
+	}
+}
+
+func TestRootRotationRejected(t *testing.T) {
+	oldKey, newKey, targetsKey := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+
+	tests := map[string]struct {
+		signers  func() []tufkeys.Signer
+		expected string
+	}{
+		"not signed by previous root": {
+			signers:  func() []tufkeys.Signer { return []tufkeys.Signer{newKey} },
+			expected: "not signed by threshold of keys in version 1",
+		},
+		"not signed by new root": {
+			signers:  func() []tufkeys.Signer { return []tufkeys.Signer{oldKey} },
+			expected: "not signed by threshold of its own keys",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			store, dir := newTestStore(t, []tufkeys.Signer{oldKey}, []tufkeys.Signer{targetsKey})
+			state := store.State()
+
+			rootMb := rotateRoot(t, state, []tufkeys.Signer{newKey}, test.signers())
+			if err := WriteRoot(state, rootMb, []tufkeys.Signer{testSnapshotSigner}); err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Fatalf("expected error containing %q writing root, got %v", test.expected, err)
+			}
+
+			// A state that bypasses the check is rejected when loaded
+			writeRootUnverified(t, state, rootMb)
+			reloaded, err := gitstore.LoadGitStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadRoot(reloaded.State()); err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error containing %q loading root, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestRootAnchoredToTrustedRoot(t *testing.T) {
+	rootKey, newKey, otherKey, targetsKey := newTestSigner(t), newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	store, dir := newTestStore(t, []tufkeys.Signer{rootKey}, []tufkeys.Signer{targetsKey})
+	state := store.State()
+	initialState := state.Tip()
+
+	rootMb := rotateRoot(t, state, []tufkeys.Signer{newKey}, []tufkeys.Signer{rootKey, newKey})
+	if err := WriteRoot(state, rootMb, []tufkeys.Signer{testSnapshotSigner}); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := CreateGitTarget("main", GitBranchRef)
+	if err := TrustState(store, target, state, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The history version 2 of root was trusted in is accepted, including
+	// states from before it
+	reloaded, err := gitstore.LoadGitStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRoot(reloaded.State()); err != nil {
+		t.Fatal(err)
+	}
+	earlierState, err := reloaded.SpecificState(initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRoot(earlierState); err != nil {
+		t.Errorf("expected state in trusted history to be accepted, got %s", err)
+	}
+
+	// A rewritten history with a different version 2 of root is rejected,
+	// even though it is validly signed by the first root
+	rewritten, err := reloaded.SpecificState(initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRootMb := rotateRoot(t, rewritten, []tufkeys.Signer{otherKey}, []tufkeys.Signer{rootKey, otherKey})
+	writeRootUnverified(t, rewritten, otherRootMb)
+	if _, err := loadRoot(rewritten); err == nil || !strings.Contains(err.Error(), "does not match the trusted root") {
+		t.Errorf("expected rewritten root to be rejected, got %v", err)
+	}
+
+	// A rewritten history that stays on the first root is rejected too
+	stale, err := reloaded.SpecificState(initialState)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.StageSnapshot()
+	if err := stale.Commit(testSnapshotter()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRoot(stale); err == nil || !strings.Contains(err.Error(), "older than trusted root version 2") {
+		t.Errorf("expected state predating trusted root to be rejected, got %v", err)
+	}
+}
+
+func TestKeysTreeMatchesRoot(t *testing.T) {
+	rootKey, otherKey, targetsKey := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+
+	tests := []struct {
+		name   string
+		update func(t *testing.T, state *gitstore.State)
+		err    string
+	}{
+		{
+			name: "key added",
+			update: func(t *testing.T, state *gitstore.State) {
+				if err := state.StageKey(otherKey.PublicData()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "is not a root key",
+		},
+		{
+			name: "key replaced",
+			update: func(t *testing.T, state *gitstore.State) {
+				if err := state.ReplaceKeys([]*tufdata.PublicKey{otherKey.PublicData()}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "is not a root key",
+		},
+		{
+			name: "key removed",
+			update: func(t *testing.T, state *gitstore.State) {
+				if err := state.ReplaceKeys([]*tufdata.PublicKey{}); err != nil {
+					t.Fatal(err)
+				}
+				state.StageSnapshot()
+			},
+			err: "missing from keys tree",
+		},
+		{
+			name: "key restaged",
+			update: func(t *testing.T, state *gitstore.State) {
+				if err := state.StageKey(rootKey.PublicData()); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, dir := newTestStore(t, []tufkeys.Signer{rootKey}, []tufkeys.Signer{targetsKey})
+			state := store.State()
+			test.update(t, state)
+			if err := state.Commit(testSnapshotter()); err != nil {
+				t.Fatal(err)
+			}
+
+			reloaded, err := gitstore.LoadGitStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = loadRoot(reloaded.State())
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
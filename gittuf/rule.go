@@ -0,0 +1,310 @@
+package gittuf
+
+import (
+	"fmt"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// Rule describes a rule in the delegations tree.
+type Rule struct {
+	Name             string
+	Parent           string
+	KeyIDs           []string
+	Threshold        int
+	Terminating      bool
+	Paths            []string
+	PathHashPrefixes []string
+	Operations       []string
+}
+
+/*
+RuleUpdate holds the changes to make to a rule. A threshold of zero leaves
+the rule's threshold unchanged. Nil operations leave the rule's operations
+unchanged, while an empty list lets the rule authorize every operation.
+*/
+type RuleUpdate struct {
+	AddPaths     []string
+	RemovePaths  []string
+	AddKeys      []*tufdata.PublicKey
+	RemoveKeyIDs []string
+	Threshold    int
+	Operations   []string
+}
+
+func newRuleFromDelegation(rule *delegatedRule) *Rule {
+	return &Rule{
+		Name:             rule.Delegation.Name,
+		Parent:           rule.Parent,
+		KeyIDs:           rule.Delegation.KeyIDs,
+		Threshold:        rule.Delegation.Threshold,
+		Terminating:      rule.Delegation.Terminating,
+		Paths:            rule.Delegation.Paths,
+		PathHashPrefixes: rule.Delegation.PathHashPrefixes,
+		Operations:       rule.Operations,
+	}
+}
+
+// ListRules returns every rule in the delegations tree in the order they are
+// searched.
+func ListRules(state *gitstore.State) ([]*Rule, error) {
+	rules, err := getAllRules(state)
+	if err != nil {
+		return []*Rule{}, err
+	}
+	list := []*Rule{}
+	for _, rule := range rules {
+		list = append(list, newRuleFromDelegation(rule))
+	}
+	return list, nil
+}
+
+// GetRule returns the rule with the specified name.
+func GetRule(state *gitstore.State, ruleName string) (*Rule, error) {
+	rule, err := findRule(state, ruleName)
+	if err != nil {
+		return &Rule{}, err
+	}
+	return newRuleFromDelegation(rule), nil
+}
+
+/*
+UpdateRule returns the name of the role that delegates the rule and a new
+version of its metadata with the update applied to the rule. Keys that are
+no longer used by any rule the role delegates are dropped from the role.
+*/
+func UpdateRule(state *gitstore.State, roleSigners []tufkeys.Signer, ruleName string, update RuleUpdate) (string, tufdata.Signed, error) {
+	parentName, parentRole, index, err := loadDelegatingRole(state, roleSigners, ruleName)
+	if err != nil {
+		return "", tufdata.Signed{}, err
+	}
+	delegations := parentRole.Delegations
+	rule := delegations.Roles[index]
+
+	for _, p := range update.RemovePaths {
+		paths, removed := removeString(rule.Paths, p)
+		prefixes, removedPrefix := removeString(rule.PathHashPrefixes, p)
+		if !removed && !removedPrefix {
+			return "", tufdata.Signed{}, fmt.Errorf("rule %s does not protect %s", ruleName, p)
+		}
+		rule.Paths = paths
+		rule.PathHashPrefixes = prefixes
+	}
+	for _, p := range update.AddPaths {
+		if containsString(rule.Paths, p) {
+			return "", tufdata.Signed{}, fmt.Errorf("rule %s already protects %s", ruleName, p)
+		}
+		rule.Paths = append(rule.Paths, p)
+	}
+	if len(rule.Paths) > 0 && len(rule.PathHashPrefixes) > 0 {
+		return "", tufdata.Signed{}, fmt.Errorf("rule %s cannot protect both paths and path hash prefixes", ruleName)
+	}
+
+	for _, keyID := range update.RemoveKeyIDs {
+		key, ok := delegations.Keys[keyID]
+		if !ok || !containsString(rule.KeyIDs, keyID) {
+			return "", tufdata.Signed{}, fmt.Errorf("key %s is not authorized by rule %s", keyID, ruleName)
+		}
+		for _, id := range key.IDs() {
+			rule.KeyIDs, _ = removeString(rule.KeyIDs, id)
+		}
+		rule.KeyIDs, _ = removeString(rule.KeyIDs, keyID)
+	}
+	for _, key := range update.AddKeys {
+		for _, keyID := range key.IDs() {
+			if containsString(rule.KeyIDs, keyID) {
+				continue
+			}
+			rule.KeyIDs = append(rule.KeyIDs, keyID)
+			delegations.Keys[keyID] = &tufdata.PublicKey{
+				Type:       key.Type,
+				Scheme:     key.Scheme,
+				Algorithms: key.Algorithms,
+				Value:      key.Value,
+			}
+		}
+	}
+
+	if update.Threshold != 0 {
+		rule.Threshold = update.Threshold
+	}
+	if rule.Threshold < 1 {
+		return "", tufdata.Signed{}, fmt.Errorf("invalid threshold %d for rule %s", rule.Threshold, ruleName)
+	}
+	if numKeys := countAuthorizedKeys(delegations.Keys, rule.KeyIDs); numKeys < rule.Threshold {
+		return "", tufdata.Signed{}, fmt.Errorf("threshold %d for rule %s cannot be met by %d keys", rule.Threshold, ruleName, numKeys)
+	}
+
+	if update.Operations != nil {
+		if err := validateOperations(update.Operations); err != nil {
+			return "", tufdata.Signed{}, err
+		}
+		if err := setRuleOperations(parentRole, ruleName, update.Operations); err != nil {
+			return "", tufdata.Signed{}, err
+		}
+	}
+
+	delegations.Roles[index] = rule
+	pruneDelegationKeys(delegations)
+	parentRole.Version++
+
+	signed, err := generateAndSignMbFromStruct(parentRole, roleSigners)
+	return parentName, signed, err
+}
+
+/*
+RemoveRule returns the name of the role that delegates the rule and a new
+version of its metadata without the rule, along with the roles whose metadata
+must be removed in the same state. This is the rule's own metadata if it has
+any, so that snapshot metadata no longer lists it and the name can be reused.
+Rules that delegate other rules cannot be removed until the rules they
+delegate are removed.
+*/
+func RemoveRule(state *gitstore.State, roleSigners []tufkeys.Signer, ruleName string) (string, tufdata.Signed, []string, error) {
+	parentName, parentRole, index, err := loadDelegatingRole(state, roleSigners, ruleName)
+	if err != nil {
+		return "", tufdata.Signed{}, []string{}, err
+	}
+
+	rules, err := getAllRules(state)
+	if err != nil {
+		return "", tufdata.Signed{}, []string{}, err
+	}
+	for _, rule := range rules {
+		if rule.Parent == ruleName {
+			return "", tufdata.Signed{}, []string{}, fmt.Errorf("rule %s delegates rule %s, remove it first", ruleName, rule.Delegation.Name)
+		}
+	}
+
+	delegations := parentRole.Delegations
+	delegations.Roles = append(delegations.Roles[:index], delegations.Roles[index+1:]...)
+	pruneDelegationKeys(delegations)
+	if err := setRuleOperations(parentRole, ruleName, nil); err != nil {
+		return "", tufdata.Signed{}, []string{}, err
+	}
+	parentRole.Version++
+
+	removed := []string{}
+	if state.HasFile(ruleName) {
+		removed = append(removed, ruleName)
+	}
+
+	signed, err := generateAndSignMbFromStruct(parentRole, roleSigners)
+	return parentName, signed, removed, err
+}
+
+/*
+MoveRule returns the name of the role that delegates the rule and a new
+version of its metadata with the rule placed immediately before another rule
+delegated by the same role. As rules are searched in order, this changes
+which rule is consulted first.
+*/
+func MoveRule(state *gitstore.State, roleSigners []tufkeys.Signer, ruleName string, beforeName string) (string, tufdata.Signed, error) {
+	if ruleName == beforeName {
+		return "", tufdata.Signed{}, fmt.Errorf("rule %s cannot be moved before itself", ruleName)
+	}
+	parentName, parentRole, index, err := loadDelegatingRole(state, roleSigners, ruleName)
+	if err != nil {
+		return "", tufdata.Signed{}, err
+	}
+
+	delegations := parentRole.Delegations
+	rule := delegations.Roles[index]
+	roles := append([]tufdata.DelegatedRole{}, delegations.Roles[:index]...)
+	roles = append(roles, delegations.Roles[index+1:]...)
+
+	moved := []tufdata.DelegatedRole{}
+	for _, r := range roles {
+		if r.Name == beforeName {
+			moved = append(moved, rule)
+		}
+		moved = append(moved, r)
+	}
+	if len(moved) == len(roles) {
+		return "", tufdata.Signed{}, fmt.Errorf("rule %s is not delegated by %s", beforeName, parentName)
+	}
+	delegations.Roles = moved
+	parentRole.Version++
+
+	signed, err := generateAndSignMbFromStruct(parentRole, roleSigners)
+	return parentName, signed, err
+}
+
+/*
+loadDelegatingRole returns the name and verified metadata of the role that
+delegates the rule, along with the index of the rule in its delegations. The
+signers must be authorized to sign for the delegating role. The allow rule
+and hash bins cannot be changed individually.
+*/
+func loadDelegatingRole(state *gitstore.State, roleSigners []tufkeys.Signer, ruleName string) (string, *tufdata.Targets, int, error) {
+	if ruleName == AllowRule {
+		return "", &tufdata.Targets{}, -1, fmt.Errorf("rule %s cannot be changed", AllowRule)
+	}
+	rule, err := findRule(state, ruleName)
+	if err != nil {
+		return "", &tufdata.Targets{}, -1, err
+	}
+
+	parentRole, parentKeys, err := loadParentRole(state, rule.Parent)
+	if err != nil {
+		return "", &tufdata.Targets{}, -1, err
+	}
+	if bins, err := getSuccinctRoles(parentRole); err != nil {
+		return "", &tufdata.Targets{}, -1, err
+	} else if bins != nil {
+		return "", &tufdata.Targets{}, -1, fmt.Errorf("rule %s is one of the hash bins %s and cannot be changed individually", ruleName, bins.NamePrefix)
+	}
+	for _, signer := range roleSigners {
+		if !isKeyAuthorized(parentKeys, signer.PublicData().IDs()) {
+			return "", &tufdata.Targets{}, -1, fmt.Errorf("key %s is not authorized to sign for %s", signer.PublicData().IDs()[0], rule.Parent)
+		}
+	}
+
+	for i, d := range parentRole.Delegations.Roles {
+		if d.Name == ruleName {
+			return rule.Parent, parentRole, i, nil
+		}
+	}
+	return "", &tufdata.Targets{}, -1, fmt.Errorf("rule %s not found in %s", ruleName, rule.Parent)
+}
+
+// pruneDelegationKeys removes keys that are not used by any of the delegated
+// rules.
+func pruneDelegationKeys(delegations *tufdata.Delegations) {
+	used := map[string]bool{}
+	for _, role := range delegations.Roles {
+		for _, keyID := range role.KeyIDs {
+			used[keyID] = true
+		}
+	}
+	for keyID := range delegations.Keys {
+		if !used[keyID] {
+			delete(delegations.Keys, keyID)
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removeString returns the list without s, and whether s was in the list.
+func removeString(list []string, s string) ([]string, bool) {
+	result := []string{}
+	found := false
+	for _, item := range list {
+		if item == s {
+			found = true
+			continue
+		}
+		result = append(result, item)
+	}
+	return result, found
+}
@@ -0,0 +1,261 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// commitTestRuleChange commits the new metadata of the role delegating a rule,
+// and removes the metadata of the removed roles.
+func commitTestRuleChange(t *testing.T, state *gitstore.State, parentName string, parentMb tufdata.Signed, removed []string) {
+	t.Helper()
+	contents, err := json.Marshal(parentMb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.StageMetadata(parentName, contents)
+	state.StageMetadataRemoval(removed)
+	if err := state.Commit(testSnapshotter()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listTestRuleNames returns the names of the rules in the order they are
+// searched.
+func listTestRuleNames(t *testing.T, state *gitstore.State) []string {
+	t.Helper()
+	rules, err := ListRules(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	return names
+}
+
+/*
+newTestRuleStore returns a store whose state delegates first and second from
+targets, and nested from first. first is signed by alice, second by bob, and
+nested by carol.
+*/
+func newTestRuleStore(t *testing.T, targetsSigner tufkeys.Signer, alice tufkeys.Signer, bob tufkeys.Signer, carol tufkeys.Signer) *gitstore.GitStore {
+	t.Helper()
+	store, _ := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+	state := store.State()
+	addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "first", 1, false, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+	addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "second", 1, false, []string{"docs/*"}, nil, publicKeysForSigners([]tufkeys.Signer{bob}))
+	addTestRule(t, state, []tufkeys.Signer{alice}, "first", "nested", 1, false, []string{"src/a"}, nil, publicKeysForSigners([]tufkeys.Signer{carol}))
+	return store
+}
+
+func TestListRules(t *testing.T) {
+	targetsSigner, alice, bob, carol := newTestSigner(t), newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	store := newTestRuleStore(t, targetsSigner, alice, bob, carol)
+
+	if names := listTestRuleNames(t, store.State()); !reflect.DeepEqual(names, []string{"first", "nested", "second", AllowRule}) {
+		t.Errorf("expected rules in search order with the allow rule last, got %v", names)
+	}
+
+	rule, err := GetRule(store.State(), "nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Parent != "first" || !reflect.DeepEqual(rule.Paths, []string{"src/a"}) || rule.Threshold != 1 {
+		t.Errorf("unexpected rule %+v", rule)
+	}
+	if _, err := GetRule(store.State(), "missing"); err == nil {
+		t.Error("expected missing rule to be rejected")
+	}
+}
+
+func TestUpdateRule(t *testing.T) {
+	targetsSigner, alice, bob, carol := newTestSigner(t), newTestSigner(t), newTestSigner(t), newTestSigner(t)
+
+	tests := []struct {
+		name     string
+		rule     string
+		signers  []tufkeys.Signer
+		update   RuleUpdate
+		expected func(t *testing.T, rule *Rule)
+		err      string
+	}{
+		{
+			name:    "add and remove paths",
+			rule:    "first",
+			signers: []tufkeys.Signer{targetsSigner},
+			update:  RuleUpdate{AddPaths: []string{"lib/*"}, RemovePaths: []string{"src/*"}},
+			expected: func(t *testing.T, rule *Rule) {
+				if !reflect.DeepEqual(rule.Paths, []string{"lib/*"}) {
+					t.Errorf("expected paths [lib/*], got %v", rule.Paths)
+				}
+			},
+		},
+		{
+			name:    "add key and raise threshold",
+			rule:    "second",
+			signers: []tufkeys.Signer{targetsSigner},
+			update:  RuleUpdate{AddKeys: publicKeysForSigners([]tufkeys.Signer{carol}), Threshold: 2},
+			expected: func(t *testing.T, rule *Rule) {
+				if rule.Threshold != 2 || len(rule.KeyIDs) != 2 {
+					t.Errorf("expected threshold 2 of 2 keys, got threshold %d of %v", rule.Threshold, rule.KeyIDs)
+				}
+			},
+		},
+		{
+			name:    "replace key",
+			rule:    "second",
+			signers: []tufkeys.Signer{targetsSigner},
+			update:  RuleUpdate{AddKeys: publicKeysForSigners([]tufkeys.Signer{carol}), RemoveKeyIDs: []string{bob.PublicData().IDs()[0]}},
+			expected: func(t *testing.T, rule *Rule) {
+				if !reflect.DeepEqual(rule.KeyIDs, carol.PublicData().IDs()) {
+					t.Errorf("expected only carol's key, got %v", rule.KeyIDs)
+				}
+			},
+		},
+		{
+			name:    "rule delegated by rule",
+			rule:    "nested",
+			signers: []tufkeys.Signer{alice},
+			update:  RuleUpdate{AddPaths: []string{"src/b"}},
+			expected: func(t *testing.T, rule *Rule) {
+				if !reflect.DeepEqual(rule.Paths, []string{"src/a", "src/b"}) {
+					t.Errorf("expected paths [src/a src/b], got %v", rule.Paths)
+				}
+			},
+		},
+		{name: "remove missing path", rule: "first", signers: []tufkeys.Signer{targetsSigner}, update: RuleUpdate{RemovePaths: []string{"lib/*"}}, err: "rule first does not protect lib/*"},
+		{name: "add existing path", rule: "first", signers: []tufkeys.Signer{targetsSigner}, update: RuleUpdate{AddPaths: []string{"src/*"}}, err: "rule first already protects src/*"},
+		{name: "remove last key", rule: "first", signers: []tufkeys.Signer{targetsSigner}, update: RuleUpdate{RemoveKeyIDs: []string{alice.PublicData().IDs()[0]}}, err: "cannot be met by 0 keys"},
+		{name: "remove unknown key", rule: "first", signers: []tufkeys.Signer{targetsSigner}, update: RuleUpdate{RemoveKeyIDs: []string{bob.PublicData().IDs()[0]}}, err: "is not authorized by rule first"},
+		{name: "unauthorized signer", rule: "nested", signers: []tufkeys.Signer{targetsSigner}, update: RuleUpdate{AddPaths: []string{"src/b"}}, err: "is not authorized to sign for first"},
+		{name: "allow rule", rule: AllowRule, signers: []tufkeys.Signer{targetsSigner}, update: RuleUpdate{AddPaths: []string{"src/b"}}, err: "cannot be changed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestRuleStore(t, targetsSigner, alice, bob, carol)
+			state := store.State()
+
+			parentName, parentMb, err := UpdateRule(state, test.signers, test.rule, test.update)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			commitTestRuleChange(t, state, parentName, parentMb, nil)
+
+			rule, err := GetRule(state, test.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.expected(t, rule)
+
+			// Keys no longer used by any rule are dropped
+			parentRole, _, err := loadParentRole(state, parentName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for keyID := range parentRole.Delegations.Keys {
+				used := false
+				for _, d := range parentRole.Delegations.Roles {
+					used = used || containsString(d.KeyIDs, keyID)
+				}
+				if !used {
+					t.Errorf("expected unused key %s to be dropped from %s", keyID, parentName)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveRule(t *testing.T) {
+	targetsSigner, alice, bob, carol := newTestSigner(t), newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	store := newTestRuleStore(t, targetsSigner, alice, bob, carol)
+	state := store.State()
+
+	if _, _, _, err := RemoveRule(state, []tufkeys.Signer{targetsSigner}, "first"); err == nil || !strings.Contains(err.Error(), "delegates rule nested, remove it first") {
+		t.Fatalf("expected rule delegating other rules to be rejected, got %v", err)
+	}
+
+	parentName, parentMb, removed, err := RemoveRule(state, []tufkeys.Signer{alice}, "nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("expected no metadata to be removed with nested, got %v", removed)
+	}
+	commitTestRuleChange(t, state, parentName, parentMb, removed)
+
+	parentName, parentMb, removed, err = RemoveRule(state, []tufkeys.Signer{targetsSigner}, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, []string{"first"}) {
+		t.Errorf("expected metadata of first to be removed, got %v", removed)
+	}
+	commitTestRuleChange(t, state, parentName, parentMb, removed)
+
+	if state.HasFile("first") {
+		t.Error("expected metadata of first to be removed")
+	}
+	if names := listTestRuleNames(t, state); !reflect.DeepEqual(names, []string{"second", AllowRule}) {
+		t.Errorf("expected rules [second %s], got %v", AllowRule, names)
+	}
+
+	// The name of a removed rule can be reused
+	addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "first", 1, false, []string{"lib/*"}, nil, publicKeysForSigners([]tufkeys.Signer{bob}))
+	if names := listTestRuleNames(t, state); !reflect.DeepEqual(names, []string{"second", "first", AllowRule}) {
+		t.Errorf("expected rules [second first %s], got %v", AllowRule, names)
+	}
+}
+
+func TestMoveRule(t *testing.T) {
+	targetsSigner, alice, bob, carol := newTestSigner(t), newTestSigner(t), newTestSigner(t), newTestSigner(t)
+
+	tests := []struct {
+		name     string
+		rule     string
+		before   string
+		expected []string
+		err      string
+	}{
+		{name: "move before sibling", rule: "second", before: "first", expected: []string{"second", "first", "nested", AllowRule}},
+		{name: "move before itself", rule: "first", before: "first", err: "cannot be moved before itself"},
+		{name: "move before rule of other role", rule: "second", before: "nested", err: "rule nested is not delegated by targets"},
+		{name: "move before allow rule", rule: "first", before: AllowRule, expected: []string{"second", "first", "nested", AllowRule}},
+		{name: "move allow rule", rule: AllowRule, before: "first", err: "cannot be changed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestRuleStore(t, targetsSigner, alice, bob, carol)
+			state := store.State()
+
+			parentName, parentMb, err := MoveRule(state, []tufkeys.Signer{targetsSigner}, test.rule, test.before)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			commitTestRuleChange(t, state, parentName, parentMb, nil)
+
+			if names := listTestRuleNames(t, state); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected rules %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
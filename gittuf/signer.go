@@ -0,0 +1,96 @@
+package gittuf
+
+import (
+	"io"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+const SSHAgentSignerPrefix = "ssh-agent:"
+
+/*
+LoadSigner returns a signer for the specified signing key. Keys held by an
+ssh-agent are specified as ssh-agent:<fingerprint>, OpenPGP keys in gpg's
+keyring as gpg:<key ID>, OpenPGP secret keys exported to a file as
+openpgp:<path>, and keys on a PKCS#11 token as an RFC 7512 pkcs11: URI. Any
+other value is treated as the path to a private key on
+disk.
+*/
+func LoadSigner(signingKey string) (tufkeys.Signer, error) {
+	switch {
+	case strings.HasPrefix(signingKey, SSHAgentSignerPrefix):
+		return NewSSHAgentSigner(strings.TrimPrefix(signingKey, SSHAgentSignerPrefix))
+	case strings.HasPrefix(signingKey, GPGSignerPrefix):
+		return NewGPGSigner(strings.TrimPrefix(signingKey, GPGSignerPrefix))
+	case strings.HasPrefix(signingKey, PKCS11SignerPrefix):
+		return NewPKCS11Signer(signingKey)
+	case strings.HasPrefix(signingKey, OpenPGPKeyringSignerPrefix):
+		return NewOpenPGPKeyringSigner(strings.TrimPrefix(signingKey, OpenPGPKeyringSignerPrefix))
+	}
+
+	privKey, err := LoadPrivateKey(signingKey)
+	if err != nil {
+		return nil, err
+	}
+	return GetSigner(privKey)
+}
+
+/*
+GetSigner returns a go-tuf signer for the private key. The signer reports the
+public key returned by GetPublicKeyFromPrivateKey so that signatures carry the
+same key ID that is recorded in root and delegations metadata.
+*/
+func GetSigner(privKey *tufdata.PrivateKey) (tufkeys.Signer, error) {
+	signer, err := tufkeys.GetSigner(privKey)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := GetPublicKeyFromPrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	return &privateKeySigner{Signer: signer, publicKey: pubKey}, nil
+}
+
+type privateKeySigner struct {
+	tufkeys.Signer
+	publicKey *tufdata.PublicKey
+}
+
+func (s *privateKeySigner) PublicData() *tufdata.PublicKey {
+	return s.publicKey
+}
+
+// CloseSigners releases the resources held by the signers, such as sessions on
+// PKCS#11 tokens and connections to ssh-agent.
+func CloseSigners(signers []tufkeys.Signer) {
+	for _, signer := range signers {
+		closer, ok := signer.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			logrus.Debugf("Unable to close signer for key %s: %s", signer.PublicData().IDs()[0], err)
+		}
+	}
+}
+
+// getKeyIDsForSigners returns the distinct key IDs of the public keys of the
+// signers.
+func getKeyIDsForSigners(signers []tufkeys.Signer) []string {
+	keyIDs := []string{}
+	seen := map[string]bool{}
+	for _, s := range signers {
+		for _, keyID := range s.PublicData().IDs() {
+			if seen[keyID] {
+				continue
+			}
+			seen[keyID] = true
+			keyIDs = append(keyIDs, keyID)
+		}
+	}
+	return keyIDs
+}
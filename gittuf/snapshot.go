@@ -0,0 +1,156 @@
+package gittuf
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+/*
+NewSnapshotter returns a snapshotter that records the version and hash of
+every role in a state in snapshot metadata signed by those of the signers that
+hold snapshot keys. Every state must have snapshot metadata, so the state's
+root must define a snapshot role.
+*/
+func NewSnapshotter(signers []tufkeys.Signer) gitstore.Snapshotter {
+	return func(metadata map[string][]byte) ([]byte, error) {
+		rootBytes, ok := metadata["root"]
+		if !ok {
+			return nil, fmt.Errorf("root metadata not found")
+		}
+		var rootRole tufdata.Root
+		if err := unmarshalSignedRole(rootBytes, &rootRole); err != nil {
+			return nil, err
+		}
+		if _, ok := rootRole.Roles[gitstore.SnapshotRole]; !ok {
+			return nil, fmt.Errorf("root does not define a snapshot role")
+		}
+
+		keys, _ := getRoleKeysFromRoot(&rootRole, gitstore.SnapshotRole)
+		snapshotSigners := []tufkeys.Signer{}
+		for _, signer := range signers {
+			if isKeyAuthorized(keys, signer.PublicData().IDs()) {
+				snapshotSigners = append(snapshotSigners, signer)
+			}
+		}
+		if len(snapshotSigners) == 0 {
+			return nil, fmt.Errorf("state requires snapshot metadata, use --snapshot-key to specify a snapshot key")
+		}
+
+		snapshot, err := generateSnapshot(metadata)
+		if err != nil {
+			return nil, err
+		}
+		snapshotMb, err := generateAndSignMbFromStruct(snapshot, snapshotSigners)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(snapshotMb)
+	}
+}
+
+// generateSnapshot creates the next version of snapshot metadata listing the
+// roles in metadata.
+func generateSnapshot(metadata map[string][]byte) (*tufdata.Snapshot, error) {
+	snapshot := tufdata.NewSnapshot()
+	// States may go unchanged for long periods, so the default expiry of
+	// snapshot metadata is too short
+	snapshot.Expires = tufdata.DefaultExpires("targets")
+	snapshot.Version = 1
+	if contents, ok := metadata[gitstore.SnapshotRole]; ok {
+		var currentSnapshot tufdata.Snapshot
+		if err := unmarshalSignedRole(contents, &currentSnapshot); err != nil {
+			return &tufdata.Snapshot{}, err
+		}
+		snapshot.Version = currentSnapshot.Version + 1
+	}
+
+	for roleName, contents := range metadata {
+		if roleName == gitstore.SnapshotRole {
+			continue
+		}
+		fileMeta, err := getSnapshotFileMeta(roleName, contents)
+		if err != nil {
+			return &tufdata.Snapshot{}, err
+		}
+		snapshot.Meta[fmt.Sprintf("%s.json", roleName)] = fileMeta
+	}
+	return snapshot, nil
+}
+
+func getSnapshotFileMeta(roleName string, contents []byte) (tufdata.SnapshotFileMeta, error) {
+	var role struct {
+		Version int64 `json:"version"`
+	}
+	if err := unmarshalSignedRole(contents, &role); err != nil {
+		return tufdata.SnapshotFileMeta{}, fmt.Errorf("unable to read metadata for role %s: %w", roleName, err)
+	}
+	hash := sha256.Sum256(contents)
+	return tufdata.SnapshotFileMeta{
+		Length:  int64(len(contents)),
+		Hashes:  tufdata.Hashes{"sha256": hash[:]},
+		Version: role.Version,
+	}, nil
+}
+
+/*
+verifySnapshot checks that the state's snapshot metadata is signed by a
+threshold of the snapshot keys in root, and that the metadata in the state
+matches the snapshot exactly. The state's root must define a snapshot role.
+*/
+func verifySnapshot(state *gitstore.State, rootRole *tufdata.Root) (*tufdata.Snapshot, error) {
+	if _, ok := rootRole.Roles[gitstore.SnapshotRole]; !ok {
+		return &tufdata.Snapshot{}, fmt.Errorf("root in state %s does not define a snapshot role", state.Tip())
+	}
+	if !state.HasFile(gitstore.SnapshotRole) {
+		return &tufdata.Snapshot{}, fmt.Errorf("snapshot metadata not found in state %s", state.Tip())
+	}
+
+	metadata, err := state.GetAllCurrentMetadata()
+	if err != nil {
+		return &tufdata.Snapshot{}, err
+	}
+
+	var snapshotMb tufdata.Signed
+	if err := json.Unmarshal(metadata[gitstore.SnapshotRole], &snapshotMb); err != nil {
+		return &tufdata.Snapshot{}, err
+	}
+	keys, threshold := getRoleKeysFromRoot(rootRole, gitstore.SnapshotRole)
+	if err := verifySignatures(&snapshotMb, keys, threshold); err != nil {
+		return &tufdata.Snapshot{}, fmt.Errorf("unable to verify snapshot metadata: %w", err)
+	}
+	var snapshot tufdata.Snapshot
+	if err := json.Unmarshal(snapshotMb.Signed, &snapshot); err != nil {
+		return &tufdata.Snapshot{}, err
+	}
+
+	for roleName, contents := range metadata {
+		if roleName == gitstore.SnapshotRole {
+			continue
+		}
+		expected, ok := snapshot.Meta[fmt.Sprintf("%s.json", roleName)]
+		if !ok {
+			return &tufdata.Snapshot{}, fmt.Errorf("role %s is not listed in snapshot metadata", roleName)
+		}
+		actual, err := getSnapshotFileMeta(roleName, contents)
+		if err != nil {
+			return &tufdata.Snapshot{}, err
+		}
+		if actual.Version != expected.Version || actual.Length != expected.Length || actual.Hashes["sha256"].String() != expected.Hashes["sha256"].String() {
+			return &tufdata.Snapshot{}, fmt.Errorf("role %s does not match snapshot metadata", roleName)
+		}
+	}
+	for fileName := range snapshot.Meta {
+		roleName := strings.TrimSuffix(fileName, ".json")
+		if !state.HasFile(roleName) {
+			return &tufdata.Snapshot{}, fmt.Errorf("role %s listed in snapshot metadata not found", roleName)
+		}
+	}
+
+	return &snapshot, nil
+}
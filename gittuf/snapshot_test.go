@@ -0,0 +1,180 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func TestVerifySnapshot(t *testing.T) {
+	rootSigner, targetsSigner := newTestSigner(t), newTestSigner(t)
+
+	// stageTargets stages a new version of the top level targets role
+	stageTargets := func(t *testing.T, state *gitstore.State) {
+		targets, err := loadTopLevelTargets(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets.Version++
+		targetsMb, err := generateAndSignMbFromStruct(targets, []tufkeys.Signer{targetsSigner})
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := json.Marshal(targetsMb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.StageMetadata("targets", contents)
+	}
+
+	tests := []struct {
+		name   string
+		update func(t *testing.T, state *gitstore.State) error
+		err    string
+	}{
+		{
+			name: "updated with snapshot",
+			update: func(t *testing.T, state *gitstore.State) error {
+				stageTargets(t, state)
+				return state.Commit(testSnapshotter())
+			},
+		},
+		{
+			name: "updated without snapshot",
+			update: func(t *testing.T, state *gitstore.State) error {
+				stageTargets(t, state)
+				return state.Commit(nil)
+			},
+			err: "role targets does not match snapshot metadata",
+		},
+		{
+			name: "snapshot removed",
+			update: func(t *testing.T, state *gitstore.State) error {
+				return state.RemoveMetadata([]string{gitstore.SnapshotRole}, nil)
+			},
+			err: "snapshot metadata not found",
+		},
+		{
+			name: "snapshot signed by another key",
+			update: func(t *testing.T, state *gitstore.State) error {
+				stageTargets(t, state)
+				return state.Commit(func(metadata map[string][]byte) ([]byte, error) {
+					snapshot, err := generateSnapshot(metadata)
+					if err != nil {
+						return nil, err
+					}
+					snapshotMb, err := generateAndSignMbFromStruct(snapshot, []tufkeys.Signer{rootSigner})
+					if err != nil {
+						return nil, err
+					}
+					return json.Marshal(snapshotMb)
+				})
+			},
+			err: "unable to verify snapshot metadata",
+		},
+		{
+			name: "snapshotter without snapshot key",
+			update: func(t *testing.T, state *gitstore.State) error {
+				stageTargets(t, state)
+				return state.Commit(NewSnapshotter([]tufkeys.Signer{rootSigner}))
+			},
+			err: "state requires snapshot metadata",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, _ := newTestStore(t, []tufkeys.Signer{rootSigner}, []tufkeys.Signer{targetsSigner})
+			state := store.State()
+			err := test.update(t, state)
+			if err == nil {
+				_, err = loadRoot(state)
+			}
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("root without snapshot role", func(t *testing.T) {
+		dir := t.TempDir()
+		runGit(t, dir, "init", "-q", "-b", "main")
+		rootPubKeys := publicKeysForSigners([]tufkeys.Signer{rootSigner})
+		rootMb, err := initRoot([]tufkeys.Signer{rootSigner}, time.Time{}, 1, rootPubKeys, publicKeysForSigners([]tufkeys.Signer{targetsSigner}), 1, nil, 0, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var root tufdata.Root
+		if err := json.Unmarshal(rootMb.Signed, &root); err != nil {
+			t.Fatal(err)
+		}
+		delete(root.Roles, gitstore.SnapshotRole)
+		rootMb, err = generateAndSignMbFromStruct(root, []tufkeys.Signer{rootSigner})
+		if err != nil {
+			t.Fatal(err)
+		}
+		targetsMb, err := initTargets([]tufkeys.Signer{targetsSigner}, time.Time{}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata := map[string][]byte{}
+		for roleName, mb := range map[string]tufdata.Signed{"root": rootMb, "targets": targetsMb} {
+			contents, err := json.Marshal(mb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metadata[roleName] = contents
+		}
+
+		store, err := gitstore.InitGitStore(dir, rootPubKeys, metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.State().Commit(testSnapshotter()); err == nil || !strings.Contains(err.Error(), "root does not define a snapshot role") {
+			t.Fatalf("expected snapshotter to reject root without snapshot role, got %v", err)
+		}
+		if err := store.State().Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadRoot(store.State()); err == nil || !strings.Contains(err.Error(), "does not define a snapshot role") {
+			t.Errorf("expected state without snapshot role to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestInitRequiresSnapshotKeys(t *testing.T) {
+	rootSigner, targetsSigner := newTestSigner(t), newTestSigner(t)
+	dir := t.TempDir()
+	chdirTest(t, dir)
+
+	_, err := Init([]tufkeys.Signer{rootSigner}, time.Time{}, 1, publicKeysForSigners([]tufkeys.Signer{rootSigner}),
+		publicKeysForSigners([]tufkeys.Signer{targetsSigner}), []tufkeys.Signer{targetsSigner}, time.Time{}, 1,
+		nil, 1, nil, 0, "-q")
+	if err == nil || !strings.Contains(err.Error(), "snapshot keys must be specified") {
+		t.Fatalf("expected init without snapshot keys to be rejected, got %v", err)
+	}
+
+	roles, err := Init([]tufkeys.Signer{rootSigner}, time.Time{}, 1, publicKeysForSigners([]tufkeys.Signer{rootSigner}),
+		publicKeysForSigners([]tufkeys.Signer{targetsSigner}), []tufkeys.Signer{targetsSigner}, time.Time{}, 1,
+		publicKeysForSigners([]tufkeys.Signer{testSnapshotSigner}), 1, nil, 0, "-q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root tufdata.Root
+	if err := json.Unmarshal(roles["root"].Signed, &root); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := root.Roles[gitstore.SnapshotRole]; !ok {
+		t.Error("expected root to define a snapshot role")
+	}
+}
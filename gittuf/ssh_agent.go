@@ -0,0 +1,139 @@
+package gittuf
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const sshAuthSockEnvVar = "SSH_AUTH_SOCK"
+
+/*
+sshAgentSigner signs TUF metadata using a key held by an ssh-agent. The private
+key never leaves the agent. ED25519 and ECDSA P-256 keys are supported as
+their SSH signatures can be converted to the form go-tuf's verifiers expect.
+The connection to the agent is held until the signer is closed.
+*/
+type sshAgentSigner struct {
+	conn      net.Conn
+	agent     agent.Agent
+	sshKey    ssh.PublicKey
+	publicKey *tufdata.PublicKey
+}
+
+/*
+NewSSHAgentSigner connects to the ssh-agent listening on SSH_AUTH_SOCK and
+returns a signer for the key with the specified fingerprint. The fingerprint
+is in the SHA256 form printed by ssh-add -l, with or without the SHA256:
+prefix.
+*/
+func NewSSHAgentSigner(fingerprint string) (tufkeys.Signer, error) {
+	socket := os.Getenv(sshAuthSockEnvVar)
+	if len(socket) == 0 {
+		return nil, fmt.Errorf("%s is not set, cannot connect to ssh-agent", sshAuthSockEnvVar)
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newSSHAgentSigner(conn, fingerprint)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return signer, nil
+}
+
+// newSSHAgentSigner returns a signer for the key with the specified
+// fingerprint held by the agent at the other end of conn.
+func newSSHAgentSigner(conn net.Conn, fingerprint string) (*sshAgentSigner, error) {
+	sshAgent := agent.NewClient(conn)
+
+	agentKeys, err := sshAgent.List()
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint = strings.TrimPrefix(fingerprint, "SHA256:")
+	for _, k := range agentKeys {
+		if strings.TrimPrefix(ssh.FingerprintSHA256(k), "SHA256:") != fingerprint {
+			continue
+		}
+
+		switch k.Type() {
+		case ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256:
+		default:
+			return nil, fmt.Errorf("unsupported key type %s in ssh-agent", k.Type())
+		}
+
+		// The agent's key type does not expose the underlying crypto key
+		sshKey, err := ssh.ParsePublicKey(k.Marshal())
+		if err != nil {
+			return nil, err
+		}
+		pubKey, err := newPublicKeyFromSSH(sshKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return &sshAgentSigner{
+			conn:      conn,
+			agent:     sshAgent,
+			sshKey:    sshKey,
+			publicKey: pubKey,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("key with fingerprint SHA256:%s not found in ssh-agent", fingerprint)
+}
+
+func (s *sshAgentSigner) PublicData() *tufdata.PublicKey {
+	return s.publicKey
+}
+
+func (s *sshAgentSigner) SignMessage(message []byte) ([]byte, error) {
+	sig, err := s.agent.Sign(s.sshKey, message)
+	if err != nil {
+		return nil, err
+	}
+
+	switch sig.Format {
+	case ssh.KeyAlgoED25519:
+		return sig.Blob, nil
+	case ssh.KeyAlgoECDSA256:
+		// SSH encodes ECDSA signatures as two mpints while go-tuf expects
+		// the ASN.1 encoding.
+		var ecSig struct {
+			R *big.Int
+			S *big.Int
+		}
+		if err := ssh.Unmarshal(sig.Blob, &ecSig); err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(ecSig)
+	}
+
+	return nil, fmt.Errorf("unsupported signature format %s from ssh-agent", sig.Format)
+}
+
+// Close closes the connection to the agent.
+func (s *sshAgentSigner) Close() error {
+	return s.conn.Close()
+}
+
+func (s *sshAgentSigner) MarshalPrivateKey() (*tufdata.PrivateKey, error) {
+	return nil, fmt.Errorf("private keys held by ssh-agent cannot be exported")
+}
+
+func (s *sshAgentSigner) UnmarshalPrivateKey(key *tufdata.PrivateKey) error {
+	return fmt.Errorf("private keys cannot be loaded into ssh-agent signers")
+}
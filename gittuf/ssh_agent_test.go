@@ -0,0 +1,143 @@
+package gittuf
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+	tufsign "github.com/theupdateframework/go-tuf/sign"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+/*
+startTestAgent serves a keyring holding the keys on a socket in a temporary
+directory, and points SSH_AUTH_SOCK at it. The returned channel receives a
+value each time a connection to the agent is closed.
+*/
+func startTestAgent(t *testing.T, keys ...interface{}) <-chan struct{} {
+	t.Helper()
+	keyring := agent.NewKeyring()
+	for _, key := range keys {
+		if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	t.Setenv(sshAuthSockEnvVar, socket)
+
+	closed := make(chan struct{}, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				agent.ServeAgent(keyring, conn)
+				conn.Close()
+				closed <- struct{}{}
+			}()
+		}
+	}()
+	return closed
+}
+
+func getSSHFingerprint(t *testing.T, key interface{}) string {
+	t.Helper()
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ssh.FingerprintSHA256(signer.PublicKey())
+}
+
+func TestSSHAgentSigner(t *testing.T) {
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := startTestAgent(t, ed25519Key, ecdsaKey)
+
+	tests := map[string]interface{}{
+		"ed25519": ed25519Key,
+		"ecdsa":   ecdsaKey,
+	}
+	for name, key := range tests {
+		t.Run(name, func(t *testing.T) {
+			signer, err := LoadSigner(SSHAgentSignerPrefix + getSSHFingerprint(t, key))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mb := tufdata.Signed{Signed: []byte(`{"_type":"targets"}`)}
+			if err := tufsign.Sign(&mb, signer); err != nil {
+				t.Fatal(err)
+			}
+			pubKey := signer.PublicData()
+			keys := map[string]*tufdata.PublicKey{}
+			for _, keyID := range pubKey.IDs() {
+				keys[keyID] = pubKey
+			}
+			if err := verifySignatures(&mb, keys, 1); err != nil {
+				t.Errorf("signature made by ssh-agent does not verify: %s", err)
+			}
+
+			CloseSigners([]tufkeys.Signer{signer})
+			<-closed
+		})
+	}
+}
+
+func TestSSHAgentSignerErrors(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, missingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := startTestAgent(t, rsaKey)
+
+	tests := map[string]struct {
+		fingerprint string
+		expected    string
+	}{
+		"unsupported key type": {
+			fingerprint: getSSHFingerprint(t, rsaKey),
+			expected:    "unsupported key type",
+		},
+		"missing key": {
+			fingerprint: strings.TrimPrefix(getSSHFingerprint(t, missingKey), "SHA256:"),
+			expected:    "not found in ssh-agent",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewSSHAgentSigner(test.fingerprint); err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Fatalf("expected error containing %q, got %v", test.expected, err)
+			}
+			// The connection is closed when no signer is returned
+			<-closed
+		})
+	}
+}
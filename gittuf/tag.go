@@ -0,0 +1,346 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/sirupsen/logrus"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+// tagOverride approves moving a recorded tag to a different object.
+type tagOverride struct {
+	Target string `json:"target"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// tagCustom is recorded with a tag that was moved, and holds the signatures
+// approving the move.
+type tagCustom struct {
+	Override   *tagOverride        `json:"override,omitempty"`
+	Signatures []tufdata.Signature `json:"signatures,omitempty"`
+}
+
+/*
+Tag creates a tag using git tag and returns new metadata for the tag recording
+the tag's object ID, along with the tag's target name. The signers must be
+authorized by the rules protecting the tag. Tags are immutable once recorded.
+A recorded tag can only be moved with force, in which case the signers must
+also meet the threshold of the role that delegates the rule protecting the
+tag, and their approval is recorded with the tag. The new record is checked
+against the last trusted state before it is signed. The tag is deleted, or
+restored to its previous object, if an error occurs after it is created.
+*/
+func Tag(state *gitstore.State, tagName string, signers []tufkeys.Signer, expires time.Time, force bool, gitArgs ...string) (tufdata.Signed, string, error) {
+	targetName, _ := CreateGitTarget(tagName, GitTagRef)
+	roleName, _ := GetRoleNameForTarget(targetName)
+
+	role := tufdata.NewTargets()
+	role.Expires = time.Time{}
+	if state.HasFile(roleName) {
+		var err error
+		role, err = loadRoleForTarget(state, roleName, targetName)
+		if err != nil {
+			return tufdata.Signed{}, "", err
+		}
+		for name := range role.Targets {
+			if name != targetName {
+				return tufdata.Signed{}, "", fmt.Errorf("metadata for %s records %s, which is not the tag", roleName, name)
+			}
+		}
+	}
+	recorded, isRecorded := role.Targets[targetName]
+	if isRecorded && !force {
+		return tufdata.Signed{}, "", fmt.Errorf("tag %s is already recorded at %s and cannot be moved without --force", tagName, recorded.Hashes["sha1"].String())
+	}
+
+	operation := OperationCreate
+	if isRecorded {
+		operation = OperationModify
+	}
+	validation, err := validateRule(state, targetName, []string{operation}, getKeyIDsForSigners(signers))
+	if err != nil {
+		return tufdata.Signed{}, "", err
+	}
+
+	previousID, _ := GetTipCommitIDForRef(tagName, GitTagRef)
+	if err := createTag(tagName, force, gitArgs); err != nil {
+		return tufdata.Signed{}, "", err
+	}
+	objectID, err := GetTipCommitIDForRef(tagName, GitTagRef)
+	if err != nil {
+		return tufdata.Signed{}, "", UndoTag(tagName, previousID, err)
+	}
+
+	targetMeta := tufdata.TargetFileMeta{
+		FileMeta: tufdata.FileMeta{
+			Length: 1,
+			Hashes: map[string]tufdata.HexBytes{
+				"sha1": objectID,
+			},
+		},
+	}
+	if isRecorded {
+		if recorded.Hashes["sha1"].String() == objectID.String() {
+			return tufdata.Signed{}, "", UndoTag(tagName, previousID, fmt.Errorf("tag %s is already recorded at %s", tagName, objectID.String()))
+		}
+		custom, err := approveTagOverride(state, targetName, recorded.Hashes["sha1"].String(), objectID.String(), signers)
+		if err != nil {
+			return tufdata.Signed{}, "", UndoTag(tagName, previousID, err)
+		}
+		targetMeta.Custom = custom
+	}
+	if err := verifyTagRecord(state.Store(), targetName, &targetMeta); err != nil {
+		return tufdata.Signed{}, "", UndoTag(tagName, previousID, err)
+	}
+	role.Targets[targetName] = targetMeta
+	role.Version++
+	role.Expires = expires
+
+	roleSigners, err := getSignersForRule(state, targetName, validation.AuthorizedBy, signers)
+	if err != nil {
+		return tufdata.Signed{}, "", UndoTag(tagName, previousID, err)
+	}
+	signedRoleMb, err := generateAndSignMbFromStruct(role, roleSigners)
+	if err != nil {
+		return tufdata.Signed{}, "", UndoTag(tagName, previousID, err)
+	}
+
+	return signedRoleMb, targetName, nil
+}
+
+/*
+UndoTag restores the tag to the previous object ID, or deletes it if the tag
+did not exist before, and returns the cause.
+*/
+func UndoTag(tagName string, previousID tufdata.HexBytes, cause error) error {
+	mainRepo, err := GetRepoHandler()
+	if err != nil {
+		return fmt.Errorf("could not undo tag triggered due to error %w", cause)
+	}
+
+	refName := plumbing.NewTagReferenceName(tagName)
+	if len(previousID) == 0 {
+		err = mainRepo.Storer.RemoveReference(refName)
+	} else {
+		err = mainRepo.Storer.SetReference(plumbing.NewHashReference(refName, convertTUFHashHexBytesToPlumbingHash(previousID)))
+	}
+	if err != nil {
+		return fmt.Errorf("could not undo tag triggered due to error %w", cause)
+	}
+	return cause
+}
+
+func createTag(tagName string, force bool, gitArgs []string) error {
+	logrus.Debugf("Creating tag %s", tagName)
+
+	args := []string{"tag"}
+	if force {
+		args = append(args, "--force")
+	}
+	args = append(args, tagName)
+	cmd := exec.Command("git", append(args, gitArgs...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to create tag %s: %w: %s", tagName, err, string(output))
+	}
+	return nil
+}
+
+// getSignersForRule returns the signers authorized by the rule, or all
+// signers if the rule is the allow rule.
+func getSignersForRule(state *gitstore.State, targetName string, ruleName string, signers []tufkeys.Signer) ([]tufkeys.Signer, error) {
+	expected, err := ExpectedSignersForTarget(state, targetName)
+	if err != nil {
+		return []tufkeys.Signer{}, err
+	}
+	for _, e := range expected {
+		if e.Rule != ruleName {
+			continue
+		}
+		if e.IsAllowRule {
+			return signers, nil
+		}
+		ruleSigners := []tufkeys.Signer{}
+		for _, signer := range signers {
+			if isKeyAuthorized(e.Keys, signer.PublicData().IDs()) {
+				ruleSigners = append(ruleSigners, signer)
+			}
+		}
+		return ruleSigners, nil
+	}
+	return []tufkeys.Signer{}, fmt.Errorf("rule %s does not protect %s", ruleName, targetName)
+}
+
+/*
+getTagOverrideKeys returns the keys and threshold required to move a recorded
+tag. These are the keys of the role that delegates the first rule protecting
+the tag, so that the owners of a rule cannot rewrite history on their own.
+*/
+func getTagOverrideKeys(state *gitstore.State, targetName string) (map[string]*tufdata.PublicKey, int, error) {
+	rules, err := getCandidateRules(state, targetName)
+	if err != nil {
+		return map[string]*tufdata.PublicKey{}, -1, err
+	}
+	parentName := rules[0].Parent
+	if parentName == "targets" {
+		rootRole, err := loadRoot(state)
+		if err != nil {
+			return map[string]*tufdata.PublicKey{}, -1, err
+		}
+		keys, threshold := getRoleKeysFromRoot(rootRole, "targets")
+		return keys, threshold, nil
+	}
+	parent, err := findRule(state, parentName)
+	if err != nil {
+		return map[string]*tufdata.PublicKey{}, -1, err
+	}
+	return parent.Keys, parent.Delegation.Threshold, nil
+}
+
+// approveTagOverride signs the move of a tag with the signers authorized to
+// approve it, and returns the approval to record with the tag.
+func approveTagOverride(state *gitstore.State, targetName string, from string, to string, signers []tufkeys.Signer) (*json.RawMessage, error) {
+	keys, threshold, err := getTagOverrideKeys(state, targetName)
+	if err != nil {
+		return nil, err
+	}
+
+	override := &tagOverride{Target: targetName, From: from, To: to}
+	msg, err := cjson.EncodeCanonical(override)
+	if err != nil {
+		return nil, err
+	}
+
+	custom := tagCustom{Override: override, Signatures: []tufdata.Signature{}}
+	for _, signer := range signers {
+		if !isKeyAuthorized(keys, signer.PublicData().IDs()) {
+			continue
+		}
+		sig, err := signer.SignMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		custom.Signatures = append(custom.Signatures, tufdata.Signature{
+			KeyID:     signer.PublicData().IDs()[0],
+			Signature: sig,
+		})
+	}
+	if err := verifyTagOverride(&custom, keys, threshold); err != nil {
+		return nil, err
+	}
+
+	contents, err := json.Marshal(custom)
+	if err != nil {
+		return nil, err
+	}
+	raw := json.RawMessage(contents)
+	return &raw, nil
+}
+
+// verifyTagOverride checks that the approval to move a tag is signed by a
+// threshold of distinct keys.
+func verifyTagOverride(custom *tagCustom, keys map[string]*tufdata.PublicKey, threshold int) error {
+	msg, err := cjson.EncodeCanonical(custom.Override)
+	if err != nil {
+		return err
+	}
+
+	signedKeyIDs := []string{}
+	for _, sig := range custom.Signatures {
+		key, ok := keys[sig.KeyID]
+		if !ok {
+			continue
+		}
+		verifier, err := tufkeys.GetVerifier(key)
+		if err != nil {
+			return err
+		}
+		if err := verifier.Verify(msg, sig.Signature); err != nil {
+			return fmt.Errorf("invalid signature from key %s approving move of %s: %w", sig.KeyID, custom.Override.Target, err)
+		}
+		signedKeyIDs = append(signedKeyIDs, sig.KeyID)
+	}
+	if count := countAuthorizedKeys(keys, signedKeyIDs); count < threshold {
+		return fmt.Errorf("moving %s requires approval from a threshold of %d keys, met %d", custom.Override.Target, threshold, count)
+	}
+	return nil
+}
+
+/*
+verifyTagImmutability checks that a tag recorded in the last trusted state
+still points to the same object in the state, unless the move is approved by
+a threshold of the keys that could approve it in the last trusted state.
+*/
+func verifyTagImmutability(store *gitstore.GitStore, targetName string, state *gitstore.State) error {
+	currentRole, _, err := getTargetsRoleForTarget(state, targetName)
+	if err != nil {
+		return err
+	}
+	if current, ok := currentRole.Targets[targetName]; ok {
+		return verifyTagRecord(store, targetName, &current)
+	}
+	if err := verifyTagRecord(store, targetName, nil); err != nil {
+		return fmt.Errorf("%w from state %s", err, state.Tip())
+	}
+	return nil
+}
+
+/*
+verifyTagRecord checks the metadata recording a tag against the last trusted
+state, which is nil if the tag is not recorded. A tag recorded in the last
+trusted state must still point to the same object, unless the move is approved
+by a threshold of the keys that could approve it in the last trusted state.
+*/
+func verifyTagRecord(store *gitstore.GitStore, targetName string, current *tufdata.TargetFileMeta) error {
+	lastTrusted, err := store.GetLastTrusted()
+	if err != nil {
+		return err
+	}
+	trustedState, ok := lastTrusted[targetName]
+	if !ok {
+		return nil
+	}
+	previousState, err := store.SpecificState(trustedState.State)
+	if err != nil {
+		return err
+	}
+
+	previousRole, _, err := getTargetsRoleForTarget(previousState, targetName)
+	if err != nil {
+		return err
+	}
+	previous, ok := previousRole.Targets[targetName]
+	if !ok {
+		return nil
+	}
+	if current == nil {
+		return fmt.Errorf("tag %s was removed", targetName)
+	}
+
+	from, to := previous.Hashes["sha1"].String(), current.Hashes["sha1"].String()
+	if from == to {
+		return nil
+	}
+	if current.Custom == nil {
+		return fmt.Errorf("tag %s moved from %s to %s without approval", targetName, from, to)
+	}
+	var custom tagCustom
+	if err := json.Unmarshal(*current.Custom, &custom); err != nil {
+		return err
+	}
+	if custom.Override == nil || custom.Override.Target != targetName || custom.Override.From != from || custom.Override.To != to {
+		return fmt.Errorf("tag %s moved from %s to %s without approval", targetName, from, to)
+	}
+	keys, threshold, err := getTagOverrideKeys(previousState, targetName)
+	if err != nil {
+		return err
+	}
+	return verifyTagOverride(&custom, keys, threshold)
+}
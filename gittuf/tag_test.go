@@ -0,0 +1,139 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func TestTag(t *testing.T) {
+	alice, bob := newTestSigner(t), newTestSigner(t)
+	targetsSigner := newTestSigner(t)
+	expires := time.Now().AddDate(0, 0, 1)
+
+	/*
+		newRepository returns a store whose repository is the current directory,
+		with tags protected by a rule for alice's key delegated by targets. The
+		tag v1 is recorded and trusted at the first commit, and the returned
+		directory has a second commit checked out.
+	*/
+	newRepository := func(t *testing.T) (*gitstore.GitStore, string) {
+		store, dir := newTestStore(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{targetsSigner})
+		chdirTest(t, dir)
+		state := store.State()
+		addTestRule(t, state, []tufkeys.Signer{targetsSigner}, "targets", "protect-tags", 1, false, []string{"git:tag=v*"}, nil, publicKeysForSigners([]tufkeys.Signer{alice}))
+
+		writeTestFile(t, dir, "a", "a\n")
+		runGit(t, dir, "add", "a")
+		runGit(t, dir, "commit", "-q", "-m", "first")
+		roleMb, target, err := Tag(state, "v1", []tufkeys.Signer{alice}, expires, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stageTestRefRole(t, state, target, roleMb)
+		if err := TrustState(store, target, state, false); err != nil {
+			t.Fatal(err)
+		}
+
+		writeTestFile(t, dir, "a", "a\nsecond\n")
+		runGit(t, dir, "commit", "-q", "-am", "second")
+		return store, dir
+	}
+
+	tests := []struct {
+		name    string
+		signers []tufkeys.Signer
+		force   bool
+		err     string
+	}{
+		{name: "move without force", signers: []tufkeys.Signer{alice}, err: "cannot be moved without --force"},
+		{name: "move with rule keys", signers: []tufkeys.Signer{alice}, force: true, err: "requires approval from a threshold of 1 keys"},
+		{name: "move by unauthorized key", signers: []tufkeys.Signer{bob, targetsSigner}, force: true, err: "unauthorized modify of file git:tag=v1"},
+		{name: "move with override keys", signers: []tufkeys.Signer{alice, targetsSigner}, force: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, dir := newRepository(t)
+			state := store.State()
+			tagged := runGit(t, dir, "rev-parse", "v1")
+
+			roleMb, target, err := Tag(state, "v1", test.signers, expires, test.force)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				if current := runGit(t, dir, "rev-parse", "v1"); current != tagged {
+					t.Errorf("expected tag to remain at %s, got %s", tagged, current)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			stageTestRefRole(t, state, target, roleMb)
+			if err := TrustState(store, target, state, false); err != nil {
+				t.Errorf("expected approved move to be trusted, got %v", err)
+			}
+		})
+	}
+
+	t.Run("move from untrusted record", func(t *testing.T) {
+		store, dir := newRepository(t)
+		state := store.State()
+
+		// The state records an approved move of v1 that is never trusted
+		roleMb, target, err := Tag(state, "v1", []tufkeys.Signer{alice, targetsSigner}, expires, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stageTestRefRole(t, state, target, roleMb)
+		tagged := runGit(t, dir, "rev-parse", "v1")
+		tip := state.Tip()
+
+		// Moving the tag again approves the move from the untrusted record, not
+		// from the last trusted one, so the tag must not be recorded
+		writeTestFile(t, dir, "a", "a\nthird\n")
+		runGit(t, dir, "commit", "-q", "-am", "third")
+		if _, _, err := Tag(state, "v1", []tufkeys.Signer{alice, targetsSigner}, expires, true); err == nil || !strings.Contains(err.Error(), "without approval") {
+			t.Fatalf("expected move from untrusted record to be rejected, got %v", err)
+		}
+		if current := runGit(t, dir, "rev-parse", "v1"); current != tagged {
+			t.Errorf("expected tag to be restored to %s, got %s", tagged, current)
+		}
+		if state.Tip() != tip {
+			t.Error("expected state to be unchanged")
+		}
+	})
+
+	t.Run("resign tag role", func(t *testing.T) {
+		store, _ := newRepository(t)
+		state := store.State()
+
+		if _, err := ResignRoles(state, []string{"tag/v1"}, []tufkeys.Signer{bob}, expires.AddDate(0, 0, 1)); err == nil {
+			t.Fatal("expected resigning with unauthorized key to be rejected")
+		}
+
+		updated, err := ResignRoles(state, []string{"tag/v1"}, []tufkeys.Signer{alice}, expires.AddDate(0, 0, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resignedMb tufdata.Signed
+		if err := json.Unmarshal(updated["tag/v1"], &resignedMb); err != nil {
+			t.Fatal(err)
+		}
+		if !isSignedBy(resignedMb, alice) {
+			t.Error("expected resigned tag role to be signed by alice")
+		}
+		if err := state.StageMetadataAndCommit("tag/v1", updated["tag/v1"], testSnapshotter()); err != nil {
+			t.Fatal(err)
+		}
+		if err := TrustState(store, "git:tag=v1", state, false); err != nil {
+			t.Errorf("expected resigned tag role to be trusted, got %v", err)
+		}
+	})
+}
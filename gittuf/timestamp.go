@@ -0,0 +1,165 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+const TimestampRole = "timestamp"
+
+// timestampCustom identifies the state a timestamp was created for.
+type timestampCustom struct {
+	State string `json:"state"`
+}
+
+/*
+RefreshTimestamp returns a new version of the timestamp for the current state,
+signed by the timestamp keys in root. The timestamp records the state and its
+snapshot metadata. It is meant to be refreshed
+frequently using an online key, so clients can detect a remote that keeps
+serving an old state.
+*/
+func RefreshTimestamp(store *gitstore.GitStore, signers []tufkeys.Signer, expires time.Time) (tufdata.Signed, error) {
+	state := store.State()
+	rootRole, err := loadRoot(state)
+	if err != nil {
+		return tufdata.Signed{}, err
+	}
+	if _, ok := rootRole.Roles[TimestampRole]; !ok {
+		return tufdata.Signed{}, fmt.Errorf("root does not define a timestamp role")
+	}
+
+	keys, threshold := getRoleKeysFromRoot(rootRole, TimestampRole)
+	for _, signer := range signers {
+		if !isKeyAuthorized(keys, signer.PublicData().IDs()) {
+			return tufdata.Signed{}, fmt.Errorf("key %s is not a timestamp key", signer.PublicData().IDs()[0])
+		}
+	}
+
+	timestamp := tufdata.NewTimestamp()
+	timestamp.Expires = expires
+	timestamp.Version = 1
+	currentContents, err := store.GetTimestamp()
+	if err != nil {
+		return tufdata.Signed{}, err
+	}
+	if len(currentContents) > 0 {
+		var currentTimestamp tufdata.Timestamp
+		if err := unmarshalSignedRole(currentContents, &currentTimestamp); err != nil {
+			return tufdata.Signed{}, err
+		}
+		timestamp.Version = currentTimestamp.Version + 1
+	}
+
+	contents, err := state.GetCurrentMetadataBytes(gitstore.SnapshotRole)
+	if err != nil {
+		return tufdata.Signed{}, fmt.Errorf("unable to read snapshot metadata: %w", err)
+	}
+	fileMeta, err := getSnapshotFileMeta(gitstore.SnapshotRole, contents)
+	if err != nil {
+		return tufdata.Signed{}, err
+	}
+	timestamp.Meta[fmt.Sprintf("%s.json", gitstore.SnapshotRole)] = tufdata.TimestampFileMeta(fileMeta)
+
+	custom, err := json.Marshal(timestampCustom{State: state.Tip()})
+	if err != nil {
+		return tufdata.Signed{}, err
+	}
+	rawCustom := json.RawMessage(custom)
+	timestamp.Custom = &rawCustom
+
+	timestampMb, err := generateAndSignMbFromStruct(timestamp, signers)
+	if err != nil {
+		return tufdata.Signed{}, err
+	}
+	if err := verifySignatures(&timestampMb, keys, threshold); err != nil {
+		return tufdata.Signed{}, err
+	}
+	return timestampMb, nil
+}
+
+/*
+verifyTimestamp checks the repository's timestamp if the state's root defines
+a timestamp role. The timestamp must be signed by a threshold of the
+timestamp keys and must not have expired. It must also record the state or
+one of the states the state was created from, along with that state's
+snapshot metadata. A timestamp for a newer state indicates the state being
+verified is stale.
+*/
+func verifyTimestamp(store *gitstore.GitStore, state *gitstore.State, allowExpired bool) error {
+	rootRole, err := loadRoot(state)
+	if err != nil {
+		return err
+	}
+	if _, ok := rootRole.Roles[TimestampRole]; !ok {
+		return nil
+	}
+
+	contents, err := store.GetTimestamp()
+	if err != nil {
+		return err
+	}
+	if len(contents) == 0 {
+		return fmt.Errorf("timestamp metadata not found")
+	}
+
+	var timestampMb tufdata.Signed
+	if err := json.Unmarshal(contents, &timestampMb); err != nil {
+		return err
+	}
+	keys, threshold := getRoleKeysFromRoot(rootRole, TimestampRole)
+	if err := verifySignatures(&timestampMb, keys, threshold); err != nil {
+		return fmt.Errorf("unable to verify timestamp metadata: %w", err)
+	}
+	var timestamp tufdata.Timestamp
+	if err := json.Unmarshal(timestampMb.Signed, &timestamp); err != nil {
+		return err
+	}
+	if err := checkExpiry(TimestampRole, timestamp.Expires, allowExpired); err != nil {
+		return fmt.Errorf("timestamp is stale: %w", err)
+	}
+
+	var custom timestampCustom
+	if timestamp.Custom != nil {
+		if err := json.Unmarshal(*timestamp.Custom, &custom); err != nil {
+			return err
+		}
+	}
+	if len(custom.State) == 0 {
+		return fmt.Errorf("timestamp does not record a state")
+	}
+	found, err := state.ContainsState(custom.State)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("timestamp records state %s which is not in the history of state %s, the state is stale", custom.State, state.Tip())
+	}
+
+	expected, ok := timestamp.Meta[fmt.Sprintf("%s.json", gitstore.SnapshotRole)]
+	if !ok {
+		return fmt.Errorf("timestamp does not record snapshot metadata")
+	}
+	timestampedState, err := store.SpecificState(custom.State)
+	if err != nil {
+		return err
+	}
+	snapshotContents, err := timestampedState.GetCurrentMetadataBytes(gitstore.SnapshotRole)
+	if err != nil {
+		return err
+	}
+	actual, err := getSnapshotFileMeta(gitstore.SnapshotRole, snapshotContents)
+	if err != nil {
+		return err
+	}
+	if actual.Version != expected.Version || actual.Hashes["sha256"].String() != expected.Hashes["sha256"].String() {
+		return fmt.Errorf("snapshot in state %s does not match timestamp", custom.State)
+	}
+
+	return nil
+}
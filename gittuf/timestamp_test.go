@@ -0,0 +1,231 @@
+package gittuf
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityasaky/gittuf/internal/gitstore"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+	tufsign "github.com/theupdateframework/go-tuf/sign"
+)
+
+// writeTestTimestamp refreshes the timestamp for the store's current state.
+func writeTestTimestamp(t *testing.T, store *gitstore.GitStore, signers []tufkeys.Signer, expires time.Time) {
+	t.Helper()
+	timestampMb, err := RefreshTimestamp(store, signers, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := json.Marshal(timestampMb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteTimestamp(contents); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyTimestamp(t *testing.T) {
+	rootSigner, targetsSigner, timestampSigner := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	timestampSigners := []tufkeys.Signer{timestampSigner}
+	newStore := func(t *testing.T) (*gitstore.GitStore, string) {
+		store, _ := newTestStoreWithTimestamp(t, []tufkeys.Signer{rootSigner}, []tufkeys.Signer{targetsSigner}, timestampSigners)
+		initialState := store.State().Tip()
+		writeTestTargets(t, store.State(), []tufkeys.Signer{targetsSigner}, func(targets *tufdata.Targets) {
+			targets.Version = 2
+		})
+		return store, initialState
+	}
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, store *gitstore.GitStore, initialState string) *gitstore.State
+		err   string
+	}{
+		{
+			name: "fresh",
+			setup: func(t *testing.T, store *gitstore.GitStore, initialState string) *gitstore.State {
+				writeTestTimestamp(t, store, timestampSigners, time.Now().Add(time.Hour))
+				return store.State()
+			},
+		},
+		{
+			name: "timestamp for an earlier state",
+			setup: func(t *testing.T, store *gitstore.GitStore, initialState string) *gitstore.State {
+				state, err := store.SpecificState(initialState)
+				if err != nil {
+					t.Fatal(err)
+				}
+				timestampMb, err := RefreshTimestamp(store, timestampSigners, time.Now().Add(time.Hour))
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Record the earlier state in the timestamp instead
+				var timestamp tufdata.Timestamp
+				if err := json.Unmarshal(timestampMb.Signed, &timestamp); err != nil {
+					t.Fatal(err)
+				}
+				custom := json.RawMessage(`{"state":"` + state.Tip() + `"}`)
+				timestamp.Custom = &custom
+				snapshotContents, err := state.GetCurrentMetadataBytes(gitstore.SnapshotRole)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fileMeta, err := getSnapshotFileMeta(gitstore.SnapshotRole, snapshotContents)
+				if err != nil {
+					t.Fatal(err)
+				}
+				timestamp.Meta["snapshot.json"] = tufdata.TimestampFileMeta(fileMeta)
+				timestampMb, err = generateAndSignMbFromStruct(timestamp, timestampSigners)
+				if err != nil {
+					t.Fatal(err)
+				}
+				contents, err := json.Marshal(timestampMb)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := store.WriteTimestamp(contents); err != nil {
+					t.Fatal(err)
+				}
+				return store.State()
+			},
+		},
+		{
+			name: "missing",
+			setup: func(t *testing.T, store *gitstore.GitStore, initialState string) *gitstore.State {
+				return store.State()
+			},
+			err: "timestamp metadata not found",
+		},
+		{
+			name: "expired",
+			setup: func(t *testing.T, store *gitstore.GitStore, initialState string) *gitstore.State {
+				writeTestTimestamp(t, store, timestampSigners, time.Now().Add(-time.Hour))
+				return store.State()
+			},
+			err: "timestamp is stale",
+		},
+		{
+			name: "stale state",
+			setup: func(t *testing.T, store *gitstore.GitStore, initialState string) *gitstore.State {
+				writeTestTimestamp(t, store, timestampSigners, time.Now().Add(time.Hour))
+				state, err := store.SpecificState(initialState)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return state
+			},
+			err: "the state is stale",
+		},
+		{
+			name: "signed by another key",
+			setup: func(t *testing.T, store *gitstore.GitStore, initialState string) *gitstore.State {
+				timestampMb, err := RefreshTimestamp(store, timestampSigners, time.Now().Add(time.Hour))
+				if err != nil {
+					t.Fatal(err)
+				}
+				timestampMb.Signatures = nil
+				if err := tufsign.Sign(&timestampMb, newTestSigner(t)); err != nil {
+					t.Fatal(err)
+				}
+				contents, err := json.Marshal(timestampMb)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := store.WriteTimestamp(contents); err != nil {
+					t.Fatal(err)
+				}
+				return store.State()
+			},
+			err: "unable to verify timestamp metadata",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, initialState := newStore(t)
+			state := test.setup(t, store, initialState)
+			err := verifyTimestamp(store, state, false)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("not a timestamp key", func(t *testing.T) {
+		store, _ := newStore(t)
+		if _, err := RefreshTimestamp(store, []tufkeys.Signer{targetsSigner}, time.Now().Add(time.Hour)); err == nil || !strings.Contains(err.Error(), "is not a timestamp key") {
+			t.Errorf("expected targets key to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("no timestamp role", func(t *testing.T) {
+		store, _ := newTestStore(t, []tufkeys.Signer{rootSigner}, []tufkeys.Signer{targetsSigner})
+		if err := verifyTimestamp(store, store.State(), false); err != nil {
+			t.Errorf("expected states without a timestamp role to be accepted, got %v", err)
+		}
+	})
+}
+
+func TestFetchTimestamp(t *testing.T) {
+	timestampSigners := []tufkeys.Signer{newTestSigner(t)}
+	remote, remoteDir := newTestStoreWithTimestamp(t, []tufkeys.Signer{newTestSigner(t)}, []tufkeys.Signer{newTestSigner(t)}, timestampSigners)
+	writeTestTimestamp(t, remote, timestampSigners, time.Now().Add(time.Hour))
+	olderContents, err := remote.GetTimestamp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is trusted on the remote, and an empty record cannot be served
+	if err := os.Remove(filepath.Join(remoteDir, ".git", gitstore.LastTrustedRef)); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q", "-b", "main")
+	runGit(t, dir, "remote", "add", "origin", remoteDir)
+	if err := gitstore.InitNamespace(dir); err != nil {
+		t.Fatal(err)
+	}
+	store, err := gitstore.LoadGitStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.FetchTimestamp("origin"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Newer timestamps replace the local timestamp
+	writeTestTimestamp(t, remote, timestampSigners, time.Now().Add(time.Hour))
+	newerContents, err := remote.GetTimestamp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.FetchTimestamp("origin"); err != nil {
+		t.Fatal(err)
+	}
+	if contents, err := store.GetTimestamp(); err != nil || string(contents) != string(newerContents) {
+		t.Fatalf("expected newer timestamp to be fetched, got %v", err)
+	}
+
+	// The remote serves an older timestamp again
+	if err := remote.WriteTimestamp(olderContents); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.FetchTimestamp("origin"); err == nil || !strings.Contains(err.Error(), "has version 1, lower than local version 2") {
+		t.Fatalf("expected older timestamp to be rejected, got %v", err)
+	}
+	if contents, err := store.GetTimestamp(); err != nil || string(contents) != string(newerContents) {
+		t.Errorf("expected local timestamp to be kept, got %v", err)
+	}
+}
@@ -1,10 +1,9 @@
 package gittuf
 
 import (
-	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
-	"os"
+	"strings"
 
 	"github.com/adityasaky/gittuf/internal/gitstore"
 	"github.com/go-git/go-git/v5/plumbing/object"
@@ -17,57 +16,196 @@ import (
 
 var METADATADIR = "../metadata" // FIXME: embed metadata in Git repo
 
+/*
+loadRoot returns the root role of the state after verifying the chain of root
+metadata versions recorded in the state's history, the way TUF clients update
+root. The chain is anchored to the highest version of root trusted locally:
+the state's history must include that exact version, and every later version
+must chain from it. A state that predates the trusted root is only accepted
+if it is part of the history in which that root was trusted. Without a
+trusted root, the first root is trusted on first use and must be signed by a
+threshold of its own keys. Every later version must increase the version
+number by one and be signed by a threshold of the keys in both the previous
+root and itself. The keys tree of the state must match the keys of the
+resulting root role, and the state's metadata must match its snapshot.
+*/
 func loadRoot(state *gitstore.State) (*tufdata.Root, error) {
-	var role tufdata.Root
+	store := state.Store()
 
-	roleBytes, err := state.GetCurrentMetadataBytes("root")
-	if err != nil {
-		return &tufdata.Root{}, err
+	var anchor *gitstore.TrustedRole
+	anchorState := ""
+	if store != nil {
+		var err error
+		anchor, anchorState, err = getTrustedRootAnchor(store)
+		if err != nil {
+			return &tufdata.Root{}, err
+		}
 	}
 
-	var roleMb tufdata.Signed
-	err = json.Unmarshal(roleBytes, &roleMb)
+	cacheKey := fmt.Sprintf("root:%s", state.Tip())
+	if anchor != nil {
+		cacheKey = fmt.Sprintf("%s:%d:%s", cacheKey, anchor.Version, anchor.Hash)
+	}
+	if store != nil {
+		if cached, ok := store.CachedResult(cacheKey); ok {
+			return cached.(*tufdata.Root), nil
+		}
+	}
+
+	trustedRoot, err := verifyRootChain(state, anchor, anchorState)
 	if err != nil {
 		return &tufdata.Root{}, err
 	}
 
-	err = json.Unmarshal(roleMb.Signed, &role)
-	if err != nil {
+	if err := verifyKeysMatchRoot(state, trustedRoot); err != nil {
 		return &tufdata.Root{}, err
 	}
 
-	// TODO: use verifySignatures
-	rootKeys, err := state.GetAllRootKeys()
-	if err != nil {
+	if _, err := verifySnapshot(state, trustedRoot); err != nil {
 		return &tufdata.Root{}, err
 	}
 
-	msg, err := cjson.EncodeCanonical(role)
+	if store != nil {
+		store.CacheResult(cacheKey, trustedRoot)
+	}
+	return trustedRoot, nil
+}
+
+/*
+verifyRootChain verifies the root metadata versions in the state's history
+and returns the latest. If anchor is set, it is the trusted version of root,
+trusted in anchorState.
+*/
+func verifyRootChain(state *gitstore.State, anchor *gitstore.TrustedRole, anchorState string) (*tufdata.Root, error) {
+	history, err := state.GetRootMetadataHistory()
 	if err != nil {
 		return &tufdata.Root{}, err
 	}
+	if len(history) == 0 {
+		return &tufdata.Root{}, fmt.Errorf("root metadata not found")
+	}
 
-	verifiedKeyIDs := []string{}
-	for _, sig := range roleMb.Signatures {
-		key := rootKeys[sig.KeyID]
-		verifier, err := tufkeys.GetVerifier(&key)
+	var trustedRoot *tufdata.Root
+	anchored := false
+	for _, rootBytes := range history {
+		var roleMb tufdata.Signed
+		if err := json.Unmarshal(rootBytes, &roleMb); err != nil {
+			return &tufdata.Root{}, err
+		}
+		var role tufdata.Root
+		if err := json.Unmarshal(roleMb.Signed, &role); err != nil {
+			return &tufdata.Root{}, err
+		}
+
+		if anchor != nil && role.Version == anchor.Version {
+			// The trusted root replaces whatever chain led up to it
+			hash, err := hashSignedRole(&roleMb)
+			if err != nil {
+				return &tufdata.Root{}, err
+			}
+			if hash != anchor.Hash {
+				return &tufdata.Root{}, fmt.Errorf("root version %d in state %s does not match the trusted root", role.Version, state.Tip())
+			}
+			trustedRoot = &role
+			anchored = true
+			continue
+		}
+
+		if err := verifyRootUpdate(trustedRoot, &role, &roleMb); err != nil {
+			return &tufdata.Root{}, err
+		}
+		trustedRoot = &role
+	}
+
+	if anchor != nil && !anchored {
+		// The state predates the trusted root, which is only acceptable if
+		// the state is in the history the root was trusted in
+		if trustedRoot.Version > anchor.Version {
+			return &tufdata.Root{}, fmt.Errorf("root chain in state %s does not include trusted root version %d", state.Tip(), anchor.Version)
+		}
+		trustedState, err := state.Store().SpecificState(anchorState)
 		if err != nil {
 			return &tufdata.Root{}, err
 		}
-		err = verifier.Verify(msg, sig.Signature)
+		contained, err := trustedState.ContainsState(state.Tip())
 		if err != nil {
-			// TODO: do we fail for any sig that fails? What's the threshold
-			// strategy?
 			return &tufdata.Root{}, err
 		}
-		verifiedKeyIDs = append(verifiedKeyIDs, sig.KeyID)
+		if !contained {
+			return &tufdata.Root{}, fmt.Errorf("state %s has root version %d, older than trusted root version %d", state.Tip(), trustedRoot.Version, anchor.Version)
+		}
 	}
 
-	if len(verifiedKeyIDs) == 0 {
-		return &tufdata.Root{}, fmt.Errorf("root role verified with zero keys")
+	return trustedRoot, nil
+}
+
+/*
+verifyKeysMatchRoot checks that the keys tree of the state contains exactly the
+keys of the verified root role. The keys tree is only a copy of these keys, and
+a state where it was changed without a root update is rejected.
+*/
+func verifyKeysMatchRoot(state *gitstore.State, rootRole *tufdata.Root) error {
+	stateKeys, err := state.GetAllRootKeys()
+	if err != nil {
+		return err
 	}
+	rootKeys, _ := getRoleKeysFromRoot(rootRole, "root")
 
-	return &role, err
+	for keyID, key := range stateKeys {
+		if _, ok := rootKeys[keyID]; !ok {
+			return fmt.Errorf("key %s in keys tree is not a root key", keyID)
+		}
+		matchesID := false
+		for _, id := range key.IDs() {
+			matchesID = matchesID || id == keyID
+		}
+		if !matchesID {
+			return fmt.Errorf("key in keys tree does not match its ID %s", keyID)
+		}
+	}
+	for keyID := range rootKeys {
+		if _, ok := stateKeys[keyID]; !ok {
+			return fmt.Errorf("root key %s missing from keys tree", keyID)
+		}
+	}
+	return nil
+}
+
+/*
+verifyRootUpdate checks that newRoot, whose signed envelope is newRootMb, is a
+valid successor of trustedRoot. trustedRoot is nil for the first root.
+*/
+func verifyRootUpdate(trustedRoot *tufdata.Root, newRoot *tufdata.Root, newRootMb *tufdata.Signed) error {
+	if trustedRoot != nil {
+		if newRoot.Version != trustedRoot.Version+1 {
+			return fmt.Errorf("root version %d does not follow trusted root version %d", newRoot.Version, trustedRoot.Version)
+		}
+		keys, threshold := getRoleKeysFromRoot(trustedRoot, "root")
+		if err := verifyThreshold(newRootMb, keys, threshold); err != nil {
+			return fmt.Errorf("root version %d not signed by threshold of keys in version %d: %w", newRoot.Version, trustedRoot.Version, err)
+		}
+	}
+
+	keys, threshold := getRoleKeysFromRoot(newRoot, "root")
+	if err := verifyThreshold(newRootMb, keys, threshold); err != nil {
+		return fmt.Errorf("root version %d not signed by threshold of its own keys: %w", newRoot.Version, err)
+	}
+	return nil
+}
+
+// getRoleKeysFromRoot returns the keys and threshold of a top level role.
+func getRoleKeysFromRoot(root *tufdata.Root, roleName string) (map[string]*tufdata.PublicKey, int) {
+	keys := map[string]*tufdata.PublicKey{}
+	role, ok := root.Roles[roleName]
+	if !ok {
+		return keys, -1
+	}
+	for _, keyID := range role.KeyIDs {
+		if key, ok := root.Keys[keyID]; ok {
+			keys[keyID] = key
+		}
+	}
+	return keys, role.Threshold
 }
 
 func loadTopLevelTargets(state *gitstore.State) (*tufdata.Targets, error) {
@@ -76,10 +214,7 @@ func loadTopLevelTargets(state *gitstore.State) (*tufdata.Targets, error) {
 		return &tufdata.Targets{}, err
 	}
 
-	topLevelTargetsKeys := map[string]tufdata.PublicKey{}
-	for _, k := range rootRole.Roles["targets"].KeyIDs {
-		topLevelTargetsKeys[k] = *rootRole.Keys[k]
-	}
+	topLevelTargetsKeys, _ := getRoleKeysFromRoot(rootRole, "targets")
 
 	topLevelTargetsBytes, err := state.GetCurrentMetadataBytes("targets")
 	if err != nil {
@@ -106,7 +241,7 @@ func loadTopLevelTargets(state *gitstore.State) (*tufdata.Targets, error) {
 	return &topLevelTargets, nil
 }
 
-func loadSpecificTargets(state *gitstore.State, roleName string, keys map[string]tufdata.PublicKey, threshold int) (*tufdata.Targets, error) {
+func loadSpecificTargets(state *gitstore.State, roleName string, keys map[string]*tufdata.PublicKey, threshold int) (*tufdata.Targets, error) {
 	targetsBytes, err := state.GetCurrentMetadataBytes(roleName)
 	if err != nil {
 		return &tufdata.Targets{}, err
@@ -125,7 +260,37 @@ func loadSpecificTargets(state *gitstore.State, roleName string, keys map[string
 
 	var role tufdata.Targets
 	err = json.Unmarshal(mb.Signed, &role)
-	return &role, err
+	if err != nil {
+		return &tufdata.Targets{}, err
+	}
+	return &role, nil
+}
+
+// loadSpecificTargetsWithThreshold loads the role like loadSpecificTargets,
+// but ignores signatures from keys other than the specified keys.
+func loadSpecificTargetsWithThreshold(state *gitstore.State, roleName string, keys map[string]*tufdata.PublicKey, threshold int) (*tufdata.Targets, error) {
+	targetsBytes, err := state.GetCurrentMetadataBytes(roleName)
+	if err != nil {
+		return &tufdata.Targets{}, err
+	}
+
+	var mb tufdata.Signed
+	err = json.Unmarshal(targetsBytes, &mb)
+	if err != nil {
+		return &tufdata.Targets{}, err
+	}
+
+	err = verifyThreshold(&mb, keys, threshold)
+	if err != nil {
+		return &tufdata.Targets{}, err
+	}
+
+	var role tufdata.Targets
+	err = json.Unmarshal(mb.Signed, &role)
+	if err != nil {
+		return &tufdata.Targets{}, err
+	}
+	return &role, nil
 }
 
 func loadSpecificTargetsWithoutVerification(state *gitstore.State, roleName string) (*tufdata.Targets, error) {
@@ -145,135 +310,99 @@ func loadSpecificTargetsWithoutVerification(state *gitstore.State, roleName stri
 	return &role, err
 }
 
-func verifySignatures(envelope *tufdata.Signed, keys map[string]tufdata.PublicKey, threshold int) error {
-	var role interface{}
-	if err := json.Unmarshal(envelope.Signed, &role); err != nil {
-		return err
-	}
-	msg, err := cjson.EncodeCanonical(role)
+func verifySignatures(envelope *tufdata.Signed, keys map[string]*tufdata.PublicKey, threshold int) error {
+	verifiedKeyIDs, unknownKeyIDs, err := getVerifiedKeyIDs(envelope, keys)
 	if err != nil {
 		return err
 	}
-	verifiedKeyIDs := []string{}
-	for _, sig := range envelope.Signatures {
-		key := keys[sig.KeyID]
-		verifier, err := tufkeys.GetVerifier(&key)
-		if err != nil {
-			return err
-		}
-		err = verifier.Verify(msg, sig.Signature)
-		if err != nil {
-			return err
-		}
-		verifiedKeyIDs = append(verifiedKeyIDs, sig.KeyID)
+	if len(unknownKeyIDs) > 0 {
+		return fmt.Errorf("metadata signed by unknown key %s", unknownKeyIDs[0])
 	}
 	if len(verifiedKeyIDs) < threshold {
-		// TODO: this threshold check can be circumvented with multiple signatures from the same key
-		return fmt.Errorf("threshold not met")
+		return fmt.Errorf("threshold not met, %d of %d signatures, signed by keys [%s]", len(verifiedKeyIDs), threshold, strings.Join(verifiedKeyIDs, ", "))
 	}
 	return nil
 }
 
-func getTreeObjectForTargetState(state *gitstore.State, targets *tufdata.Targets, targetName string) (*object.Tree, error) {
-	lastTrustedCommit, err := state.GetCommitObjectFromHash(
-		convertTUFHashHexBytesToPlumbingHash(
-			targets.Targets[targetName].Hashes["sha1"],
-		),
-	)
-	if err != nil {
-		return &object.Tree{}, err
+/*
+verifyThreshold checks that the envelope has valid signatures from at least
+threshold distinct keys in keys. Unlike verifySignatures, signatures from
+other keys are ignored, as root updates are signed by both the old and new
+root keys.
+*/
+func verifyThreshold(envelope *tufdata.Signed, keys map[string]*tufdata.PublicKey, threshold int) error {
+	if threshold < 1 {
+		return fmt.Errorf("invalid threshold %d", threshold)
 	}
-	return state.GetTreeObjectFromHash(lastTrustedCommit.TreeHash)
-}
 
-func LoadEd25519PublicKeyFromSslib(path string) (tufdata.PublicKey, error) {
-	var pubKey tufdata.PublicKey
-	pubKeyData, err := os.ReadFile(path)
+	verifiedKeyIDs, _, err := getVerifiedKeyIDs(envelope, keys)
 	if err != nil {
-		return tufdata.PublicKey{}, err
+		return err
 	}
-	err = json.Unmarshal(pubKeyData, &pubKey)
-	if err != nil {
-		return tufdata.PublicKey{}, err
+	if len(verifiedKeyIDs) < threshold {
+		return fmt.Errorf("threshold not met, %d of %d signatures, signed by keys [%s]", len(verifiedKeyIDs), threshold, strings.Join(verifiedKeyIDs, ", "))
 	}
-
-	return pubKey, nil
+	return nil
 }
 
-func LoadEd25519PrivateKeyFromSslib(path string) (tufdata.PrivateKey, error) {
-	var privKey tufdata.PrivateKey
-	privKeyData, err := os.ReadFile(path)
-	if err != nil {
-		return tufdata.PrivateKey{}, err
+/*
+getVerifiedKeyIDs checks the envelope's signatures made by keys in keys, and
+returns the IDs of the distinct keys that signed it. Repeated signatures from
+the same key, including under another of the key's IDs, are only counted
+once. The IDs of signatures made by keys not in keys are returned separately
+and are not verified.
+*/
+func getVerifiedKeyIDs(envelope *tufdata.Signed, keys map[string]*tufdata.PublicKey) ([]string, []string, error) {
+	var role interface{}
+	if err := json.Unmarshal(envelope.Signed, &role); err != nil {
+		return []string{}, []string{}, err
 	}
-	err = json.Unmarshal(privKeyData, &privKey)
+	msg, err := cjson.EncodeCanonical(role)
 	if err != nil {
-		return tufdata.PrivateKey{}, err
+		return []string{}, []string{}, err
 	}
 
-	var keyValue KeyValue
-	err = json.Unmarshal(privKey.Value, &keyValue)
-	if err != nil {
-		return tufdata.PrivateKey{}, err
-	}
-	/*
-		Here, the assumption is that the key pair is in the securesystemslib
-		format. However, the default python-sslib format does not contain the
-		private and the public halves of the key in the "private" field as
-		go-tuf expects. So, while a keypair can be generated using python-sslib,
-		the public portion must be appended to the private portion in the JSON
-		representation.
-	*/
-	if len(keyValue.Private) < ed25519.PrivateKeySize {
-		fullPrivateValue, err := json.Marshal(KeyValue{
-			Private: append(keyValue.Private, keyValue.Public...),
-			Public:  keyValue.Public,
-		})
+	verifiedKeyIDs := []string{}
+	unknownKeyIDs := []string{}
+	seen := map[string]bool{}
+	for _, sig := range envelope.Signatures {
+		key, ok := keys[sig.KeyID]
+		if !ok {
+			unknownKeyIDs = append(unknownKeyIDs, sig.KeyID)
+			continue
+		}
+		verifier, err := tufkeys.GetVerifier(key)
 		if err != nil {
-			return tufdata.PrivateKey{}, err
+			return []string{}, []string{}, err
+		}
+		if err := verifier.Verify(msg, sig.Signature); err != nil {
+			return []string{}, []string{}, fmt.Errorf("invalid signature from key %s: %w", sig.KeyID, err)
+		}
+		if seen[sig.KeyID] {
+			continue
 		}
-		return tufdata.PrivateKey{
-			Type:       privKey.Type,
-			Scheme:     privKey.Scheme,
-			Algorithms: privKey.Algorithms,
-			Value:      fullPrivateValue,
-		}, nil
+		for _, id := range key.IDs() {
+			seen[id] = true
+		}
+		seen[sig.KeyID] = true
+		verifiedKeyIDs = append(verifiedKeyIDs, sig.KeyID)
 	}
-
-	return privKey, nil
+	return verifiedKeyIDs, unknownKeyIDs, nil
 }
 
-func GetEd25519PublicKeyFromPrivateKey(privKey *tufdata.PrivateKey) (tufdata.PublicKey, error) {
-	var keyValue KeyValue
-
-	err := json.Unmarshal(privKey.Value, &keyValue)
-	if err != nil {
-		return tufdata.PublicKey{}, err
-	}
-
-	newValue, err := json.Marshal(KeyValue{
-		Private: []byte{},
-		Public:  keyValue.Public,
-	})
+func getTreeObjectForTargetState(state *gitstore.State, targets *tufdata.Targets, targetName string) (*object.Tree, error) {
+	lastTrustedCommit, err := state.GetCommitObjectFromHash(
+		convertTUFHashHexBytesToPlumbingHash(
+			targets.Targets[targetName].Hashes["sha1"],
+		),
+	)
 	if err != nil {
-		return tufdata.PublicKey{}, err
+		return &object.Tree{}, err
 	}
-
-	return tufdata.PublicKey{
-		Type:       privKey.Type,
-		Scheme:     privKey.Scheme,
-		Algorithms: privKey.Algorithms,
-		Value:      newValue,
-	}, nil
-
-}
-
-type KeyValue struct {
-	Private []byte `json:"private,omitempty"`
-	Public  []byte `json:"public,omitempty"`
+	return state.GetTreeObjectFromHash(lastTrustedCommit.TreeHash)
 }
 
-func generateAndSignMbFromStruct(content interface{}, keys []tufdata.PrivateKey) (tufdata.Signed, error) {
+func generateAndSignMbFromStruct(content interface{}, signers []tufkeys.Signer) (tufdata.Signed, error) {
 	var newMb tufdata.Signed
 	newJson, err := json.Marshal(content)
 	if err != nil {
@@ -283,11 +412,7 @@ func generateAndSignMbFromStruct(content interface{}, keys []tufdata.PrivateKey)
 		Signed:     newJson,
 		Signatures: []tufdata.Signature{},
 	}
-	for _, key := range keys {
-		signer, err := tufkeys.GetSigner(&key)
-		if err != nil {
-			return newMb, err
-		}
+	for _, signer := range signers {
 		err = tufsign.Sign(&newMb, signer)
 		if err != nil {
 			return newMb, err
@@ -296,31 +421,73 @@ func generateAndSignMbFromStruct(content interface{}, keys []tufdata.PrivateKey)
 	return newMb, nil
 }
 
-func ExpectedSignersForTarget(state *gitstore.State, target string) (map[string]tufdata.PublicKey, int, error) {
-	topLevelTargets, err := loadTopLevelTargets(state)
+// ExpectedSigners holds the keys a rule authorizes to sign for a target, and
+// the operations the rule authorizes, if it is limited to some. The allow rule
+// places no restrictions on who can sign.
+type ExpectedSigners struct {
+	Rule        string
+	Keys        map[string]*tufdata.PublicKey
+	Threshold   int
+	Operations  []string
+	IsAllowRule bool
+}
+
+/*
+ExpectedSignersForTarget returns the keys authorized to sign for the target by
+each rule protecting it, in the order the rules must be consulted. A change
+to the target is authorized if it is signed by the keys of any of these
+rules. The allow rule is only returned if the target is covered by no other
+rule.
+*/
+func ExpectedSignersForTarget(state *gitstore.State, target string) ([]ExpectedSigners, error) {
+	rules, err := getCandidateRules(state, target)
 	if err != nil {
-		return map[string]tufdata.PublicKey{}, -1, err
+		return []ExpectedSigners{}, err
 	}
 
-	if topLevelTargets.Delegations == nil {
-		return map[string]tufdata.PublicKey{}, -1, fmt.Errorf("no rules found in targets")
+	expected := []ExpectedSigners{}
+	for _, rule := range rules {
+		if rule.isAllowRule() {
+			expected = append(expected, ExpectedSigners{Rule: rule.Delegation.Name, Keys: map[string]*tufdata.PublicKey{}, IsAllowRule: true})
+			continue
+		}
+		expected = append(expected, ExpectedSigners{
+			Rule:       rule.Delegation.Name,
+			Keys:       rule.Keys,
+			Threshold:  rule.Delegation.Threshold,
+			Operations: rule.Operations,
+		})
 	}
+	return expected, nil
+}
 
-	for _, d := range topLevelTargets.Delegations.Roles {
-		if d.Name == AllowRule {
-			return map[string]tufdata.PublicKey{}, 0, nil
-		}
-		match, err := d.MatchesPath(target)
-		if err != nil {
-			return map[string]tufdata.PublicKey{}, -1, err
+/*
+loadRoleForTarget returns the role recording the target. The role must be
+signed by a threshold of the keys of one of the rules protecting the target.
+Signatures from other keys are ignored, as the role is also signed by the keys
+that authorized the changes it records, which are checked against the rules
+protecting each changed path.
+*/
+func loadRoleForTarget(state *gitstore.State, roleName string, target string) (*tufdata.Targets, error) {
+	if !state.HasFile(roleName) {
+		return &tufdata.Targets{}, fmt.Errorf("metadata for role %s not found", roleName)
+	}
+
+	expected, err := ExpectedSignersForTarget(state, target)
+	if err != nil {
+		return &tufdata.Targets{}, err
+	}
+
+	var lastErr error
+	for _, e := range expected {
+		if e.IsAllowRule {
+			return loadSpecificTargetsWithoutVerification(state, roleName)
 		}
-		if match {
-			keys := map[string]tufdata.PublicKey{}
-			for _, k := range d.KeyIDs {
-				keys[k] = *topLevelTargets.Delegations.Keys[k]
-			}
-			return keys, d.Threshold, nil
+		role, err := loadSpecificTargetsWithThreshold(state, roleName, e.Keys, e.Threshold)
+		if err == nil {
+			return role, nil
 		}
+		lastErr = err
 	}
-	return map[string]tufdata.PublicKey{}, -1, fmt.Errorf("no rule found for tagret %s", target)
+	return &tufdata.Targets{}, fmt.Errorf("role %s is not signed by the keys of any rule protecting %s: %w", roleName, target, lastErr)
 }
@@ -4,13 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/adityasaky/gittuf/internal/gitstore"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/sirupsen/logrus"
 	tufdata "github.com/theupdateframework/go-tuf/data"
-	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
 )
 
 const AllowRule = "allow-*"
@@ -19,9 +19,10 @@ const AllowRule = "allow-*"
 VerifyTrustedStates compares two TUF states of the repository, stateA and
 stateB, and validates if the repository can move from stateA to stateB.
 Both states are specified as tips of the gittuf namespace. Note that this API
-does NOT update the contents of the gittuf namespace.
+does NOT update the contents of the gittuf namespace. As neither state is
+trusted as a result, the expiry of their metadata is not checked.
 */
-func VerifyTrustedStates(target string, stateA string, stateB string) error {
+func VerifyTrustedStates(store *gitstore.GitStore, target string, stateA string, stateB string) error {
 	if stateA == stateB {
 		return nil
 	}
@@ -31,12 +32,7 @@ func VerifyTrustedStates(target string, stateA string, stateB string) error {
 		return fmt.Errorf("specified ref '%s' is not in valid git format", target)
 	}
 
-	repoRoot, err := GetRepoRootDir()
-	if err != nil {
-		return err
-	}
-
-	stateARepo, err := gitstore.LoadAtState(repoRoot, stateA)
+	stateARepo, err := loadStateInHistory(store, stateA)
 	if err != nil {
 		return err
 	}
@@ -47,7 +43,7 @@ func VerifyTrustedStates(target string, stateA string, stateB string) error {
 		return err
 	}
 
-	stateBRepo, err := gitstore.LoadAtState(repoRoot, stateB)
+	stateBRepo, err := loadStateInHistory(store, stateB)
 	if err != nil {
 		return err
 	}
@@ -61,32 +57,39 @@ func VerifyTrustedStates(target string, stateA string, stateB string) error {
 	if err != nil {
 		return err
 	}
-	roleBytes, err := stateBRepo.GetCurrentMetadataBytes(roleName)
+	usedKeyIDs, err := getVerifiedSigners(stateARepo, stateBRepo, roleName)
 	if err != nil {
 		return err
 	}
-	var roleSigned tufdata.Signed
-	err = json.Unmarshal(roleBytes, &roleSigned)
+
+	changes, err := diffTrees(stateARefTree, stateBRefTree)
 	if err != nil {
 		return err
 	}
-	usedKeyIDs := []string{}
-	for _, sig := range roleSigned.Signatures {
-		usedKeyIDs = append(usedKeyIDs, sig.KeyID)
-	}
 
-	changes, err := stateARefTree.Diff(stateBRefTree)
+	_, err = validateChanges(stateARepo, changes, usedKeyIDs)
+	return err
+}
+
+// loadStateInHistory loads the specified state, which must be in the history of
+// the store's current state.
+func loadStateInHistory(store *gitstore.GitStore, stateID string) (*gitstore.State, error) {
+	contained, err := store.State().ContainsState(stateID)
 	if err != nil {
-		return err
+		return &gitstore.State{}, err
 	}
-
-	return validateChanges(stateARepo, changes, usedKeyIDs)
+	if !contained {
+		return &gitstore.State{}, fmt.Errorf("state %s not found in the history of the gittuf namespace", stateID)
+	}
+	return store.SpecificState(stateID)
 }
 
 /*
-VerifyState checks that a target has the hash specified in the TUF delegations tree.
+VerifyState checks that a target has the hash specified in the TUF delegations
+tree. The metadata of the current state must not have expired unless
+allowExpired is set.
 */
-func VerifyState(store *gitstore.GitStore, target string) error {
+func VerifyState(store *gitstore.GitStore, target string, allowExpired bool) error {
 	state := store.State()
 	activeID, err := getCurrentCommitID(target)
 	if err != nil {
@@ -120,6 +123,22 @@ func VerifyState(store *gitstore.GitStore, target string) error {
 		return fmt.Errorf("role %s has recorded different hash value %s from current hash %s", role, lastTrustedTargetsID.String(), activeID.String())
 	}
 
+	trustedRoles, err := getTrustedRoles(store, target, state)
+	if err != nil {
+		return err
+	}
+	if _, err := verifyRoleVersions(trustedRoles, state); err != nil {
+		return err
+	}
+
+	if err := verifyExpiry(state, target, allowExpired); err != nil {
+		return err
+	}
+
+	if err := verifyTimestamp(store, state, allowExpired); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -141,69 +160,17 @@ func getCurrentCommitID(target string) (tufdata.HexBytes, error) {
 }
 
 func getTargetsRoleForTarget(state *gitstore.State, target string) (*tufdata.Targets, string, error) {
-	topLevelTargets, err := loadTopLevelTargets(state)
-	if err != nil {
-		return &tufdata.Targets{}, "", err
-	}
-
-	refName, _, err := ParseGitTarget(target)
+	roleName, err := GetRoleNameForTarget(target)
 	if err != nil {
 		return &tufdata.Targets{}, "", err
 	}
 
-	allowRuleHit := false
-	acceptedKeys := map[string]*tufdata.PublicKey{}
-	for _, delegation := range topLevelTargets.Delegations.Roles {
-		if delegation.Name == AllowRule {
-			// there are no restrictions on who can sign
-			allowRuleHit = true
-			break
-		}
-		matches, err := delegation.MatchesPath(target)
-		if err != nil {
-			return &tufdata.Targets{}, "", err
-		}
-		if matches {
-			acceptedKeys = topLevelTargets.Delegations.Keys
-		}
-	}
-
-	contents, err := state.GetCurrentMetadataBytes(refName)
+	role, err := loadRoleForTarget(state, roleName, target)
 	if err != nil {
 		return &tufdata.Targets{}, "", err
 	}
 
-	var s *tufdata.Signed
-	err = json.Unmarshal(contents, &s)
-	if err != nil {
-		return &tufdata.Targets{}, "", err
-	}
-
-	var role *tufdata.Targets
-	err = json.Unmarshal(s.Signed, &role)
-	if err != nil {
-		return &tufdata.Targets{}, "", err
-	}
-
-	if !allowRuleHit {
-		msg, err := cjson.EncodeCanonical(role)
-		if err != nil {
-			return &tufdata.Targets{}, "", err
-		}
-
-		for _, signature := range s.Signatures {
-			verifier, err := tufkeys.GetVerifier(acceptedKeys[signature.KeyID])
-			if err != nil {
-				return &tufdata.Targets{}, "", err
-			}
-			err = verifier.Verify(msg, signature.Signature)
-			if err != nil {
-				return &tufdata.Targets{}, "", err
-			}
-		}
-	}
-
-	return role, refName, nil
+	return role, roleName, nil
 }
 
 func getStateTree(metadataRepo *gitstore.State, target string) (*object.Tree, error) {
@@ -226,64 +193,144 @@ func getStateTree(metadataRepo *gitstore.State, target string) (*object.Tree, er
 	return mainRepo.TreeObject(stateRefCommit.TreeHash)
 }
 
-func validateUsedKeyIDs(authorizedKeyIDs map[string]tufdata.PublicKey, usedKeyIDs []string) bool {
-	set := map[string]bool{}
-	for k := range authorizedKeyIDs {
-		set[k] = true
+/*
+getVerifiedSigners returns the distinct keys that signed the role in state,
+checking each signature against the keys of the rules in ruleState.
+Signatures from keys that no rule in ruleState knows are ignored, as they
+cannot authorize any change.
+*/
+func getVerifiedSigners(ruleState *gitstore.State, state *gitstore.State, roleName string) ([]string, error) {
+	keys, err := getAllRuleKeys(ruleState)
+	if err != nil {
+		return []string{}, err
 	}
-	for _, k := range usedKeyIDs {
-		if _, ok := set[k]; !ok {
-			return false
-		}
+
+	contents, err := state.GetCurrentMetadataBytes(roleName)
+	if err != nil {
+		return []string{}, err
+	}
+	var mb tufdata.Signed
+	if err := json.Unmarshal(contents, &mb); err != nil {
+		return []string{}, err
 	}
-	return true
+
+	verifiedKeyIDs, _, err := getVerifiedKeyIDs(&mb, keys)
+	return verifiedKeyIDs, err
 }
 
-func validateRule(ruleState *gitstore.State, path string, usedKeyIDs []string) error {
-	keys, threshold, err := ExpectedSignersForTarget(ruleState, path)
+// getAllRuleKeys returns the keys of every rule in the state.
+func getAllRuleKeys(state *gitstore.State) (map[string]*tufdata.PublicKey, error) {
+	rules, err := getAllRules(state)
 	if err != nil {
-		return err
+		return map[string]*tufdata.PublicKey{}, err
 	}
-	if threshold == 0 {
-		return nil
+	keys := map[string]*tufdata.PublicKey{}
+	for _, rule := range rules {
+		for keyID, key := range rule.Keys {
+			keys[keyID] = key
+		}
+	}
+	return keys, nil
+}
+
+// countAuthorizedKeys returns the number of distinct authorized keys among the
+// used key IDs. A key listed under more than one of its IDs is counted once.
+func countAuthorizedKeys(authorizedKeys map[string]*tufdata.PublicKey, usedKeyIDs []string) int {
+	seen := map[string]bool{}
+	count := 0
+	for _, keyID := range usedKeyIDs {
+		key, ok := authorizedKeys[keyID]
+		if !ok || seen[keyID] {
+			continue
+		}
+		for _, id := range key.IDs() {
+			seen[id] = true
+		}
+		seen[keyID] = true
+		count++
 	}
+	return count
+}
 
-	// TODO: threshold
-	if !validateUsedKeyIDs(keys, usedKeyIDs) {
-		return fmt.Errorf("unauthorized change to file %s", path)
+// RuleValidation records the rules consulted for a change to a path and the
+// rule that authorized it.
+type RuleValidation struct {
+	Path         string
+	Consulted    []string
+	AuthorizedBy string
+}
+
+/*
+validateRule consults the rules protecting the path in order, and returns the
+first rule that authorizes all of the operations and whose threshold is met by
+the used keys. Keys not authorized by a rule do not count towards its threshold.
+Consulting stops at the first terminating rule.
+*/
+func validateRule(ruleState *gitstore.State, path string, operations []string, usedKeyIDs []string) (*RuleValidation, error) {
+	expected, err := ExpectedSignersForTarget(ruleState, path)
+	if err != nil {
+		return &RuleValidation{}, err
 	}
 
-	return nil
+	result := &RuleValidation{Path: path, Consulted: []string{}}
+	failures := []string{}
+	for _, e := range expected {
+		result.Consulted = append(result.Consulted, e.Rule)
+		if e.IsAllowRule {
+			result.AuthorizedBy = e.Rule
+			return result, nil
+		}
+		if disallowed := disallowedOperations(e.Operations, operations); len(disallowed) > 0 {
+			failures = append(failures, fmt.Sprintf("rule %s does not allow %s", e.Rule, strings.Join(disallowed, ", ")))
+			continue
+		}
+		count := countAuthorizedKeys(e.Keys, usedKeyIDs)
+		if count >= e.Threshold {
+			result.AuthorizedBy = e.Rule
+			return result, nil
+		}
+		failures = append(failures, fmt.Sprintf("rule %s requires a threshold of %d, met %d", e.Rule, e.Threshold, count))
+	}
+
+	return result, fmt.Errorf("unauthorized %s of file %s signed by keys [%s]: %s", strings.Join(operations, ", "), path, strings.Join(usedKeyIDs, ", "), strings.Join(failures, "; "))
 }
 
-func validateChanges(ruleState *gitstore.State, changes object.Changes, usedKeyIDs []string) error {
+/*
+validateChanges checks that the used keys are authorized to make every change,
+and returns the validation of each path changed.
+*/
+func validateChanges(ruleState *gitstore.State, changes []*fileChange, usedKeyIDs []string) ([]*RuleValidation, error) {
+	validations := []*RuleValidation{}
 	for _, c := range changes {
 		// For each change to a file, we want to verify that the policy allows
-		// the keys that were used to sign changes for the file.
+		// the keys that were used to sign changes for the file to perform the
+		// change's operations. Besides creating, modifying, deleting,
+		// renaming, or copying the file, a change may alter its mode, write a
+		// symlink, or point a submodule at another commit.
 
 		// First, we get the delegations entry for the target. If we end up at
 		// the catch all rule, we move on to the next change.
 
 		// Once we have a delegations entry, we get a list of keys authorized
-		// to sign for the target. We then check if the keys used were part of
-		// this authorized set.
+		// to sign for the target. We then check if the rule allows all of the
+		// operations, and if a threshold of distinct keys from this authorized
+		// set were used.
 
-		// If the change includes a rename, we follow the above rules for the
+		// If the change is a rename, we follow the above rules for the
 		// original name AND the new name. This ensures that a rename does not
-		// result in a file being written to a protected namespace.
+		// result in a file being written to a protected namespace. A copy only
+		// writes to the new name.
 
-		if len(c.From.Name) > 0 {
-			if err := validateRule(ruleState, c.From.Name, usedKeyIDs); err != nil {
-				return err
-			}
-		}
-
-		if c.From.Name != c.To.Name && len(c.To.Name) > 0 {
-			if err := validateRule(ruleState, c.To.Name, usedKeyIDs); err != nil {
-				return err
+		operations := c.operations()
+		for _, path := range c.paths() {
+			result, err := validateRule(ruleState, path, operations, usedKeyIDs)
+			if err != nil {
+				return []*RuleValidation{}, err
 			}
+			logrus.Debugf("%s of %s authorized by rule %s, consulted rules %s", strings.Join(operations, ", "), path, result.AuthorizedBy, strings.Join(result.Consulted, ", "))
+			validations = append(validations, result)
 		}
 
 	}
-	return nil
+	return validations, nil
 }
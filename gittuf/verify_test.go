@@ -0,0 +1,148 @@
+package gittuf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+	tufkeys "github.com/theupdateframework/go-tuf/pkg/keys"
+)
+
+func TestCountAuthorizedKeys(t *testing.T) {
+	alice, bob, carol := newTestSigner(t).PublicData(), newTestSigner(t).PublicData(), newTestSigner(t).PublicData()
+	aliceID, bobID, carolID := alice.IDs()[0], bob.IDs()[0], carol.IDs()[0]
+	authorizedKeys := map[string]*tufdata.PublicKey{
+		aliceID:     alice,
+		bobID:       bob,
+		"alice-alt": alice,
+	}
+
+	tests := []struct {
+		name       string
+		usedKeyIDs []string
+		expected   int
+	}{
+		{name: "no keys", usedKeyIDs: []string{}, expected: 0},
+		{name: "one key", usedKeyIDs: []string{aliceID}, expected: 1},
+		{name: "distinct keys", usedKeyIDs: []string{aliceID, bobID}, expected: 2},
+		{name: "repeated key", usedKeyIDs: []string{aliceID, aliceID}, expected: 1},
+		{name: "key under another ID", usedKeyIDs: []string{"alice-alt", aliceID}, expected: 1},
+		{name: "unauthorized key", usedKeyIDs: []string{aliceID, carolID}, expected: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if count := countAuthorizedKeys(authorizedKeys, test.usedKeyIDs); count != test.expected {
+				t.Errorf("expected %d keys, got %d", test.expected, count)
+			}
+		})
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	rootSigner, targetsSigner := newTestSigner(t), newTestSigner(t)
+	alice, bob, carol := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	aliceID, bobID, carolID := alice.PublicData().IDs()[0], bob.PublicData().IDs()[0], carol.PublicData().IDs()[0]
+
+	store, _ := newTestStore(t, []tufkeys.Signer{rootSigner}, []tufkeys.Signer{targetsSigner})
+	state := store.State()
+	targetsSigners := []tufkeys.Signer{targetsSigner}
+	addTestRule(t, state, targetsSigners, "targets", "maintainers", 2, false, []string{"src/*"}, []string{OperationModify}, publicKeysForSigners([]tufkeys.Signer{alice, bob}))
+	addTestRule(t, state, targetsSigners, "targets", "release", 1, true, []string{"src/*"}, nil, publicKeysForSigners([]tufkeys.Signer{carol}))
+
+	tests := []struct {
+		name         string
+		path         string
+		operations   []string
+		usedKeyIDs   []string
+		authorizedBy string
+		consulted    []string
+		err          string
+	}{
+		{name: "threshold met", path: "src/a", operations: []string{OperationModify}, usedKeyIDs: []string{aliceID, bobID}, authorizedBy: "maintainers", consulted: []string{"maintainers"}},
+		{name: "threshold met by later rule", path: "src/a", operations: []string{OperationModify}, usedKeyIDs: []string{carolID}, authorizedBy: "release", consulted: []string{"maintainers", "release"}},
+		{name: "threshold not met", path: "src/a", operations: []string{OperationModify}, usedKeyIDs: []string{aliceID}, err: "rule maintainers requires a threshold of 2, met 1; rule release requires a threshold of 1, met 0"},
+		{name: "repeated key does not meet threshold", path: "src/a", operations: []string{OperationModify}, usedKeyIDs: []string{aliceID, aliceID}, err: "rule maintainers requires a threshold of 2, met 1"},
+		{name: "operation not allowed", path: "src/a", operations: []string{OperationDelete}, usedKeyIDs: []string{aliceID, bobID}, err: "rule maintainers does not allow delete"},
+		{name: "operation allowed by later rule", path: "src/a", operations: []string{OperationDelete}, usedKeyIDs: []string{carolID}, authorizedBy: "release", consulted: []string{"maintainers", "release"}},
+		{name: "unprotected path", path: "docs/a", operations: []string{OperationDelete}, usedKeyIDs: []string{}, authorizedBy: AllowRule, consulted: []string{AllowRule}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := validateRule(state, test.path, test.operations, test.usedKeyIDs)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.AuthorizedBy != test.authorizedBy {
+				t.Errorf("expected change to be authorized by %s, got %s", test.authorizedBy, result.AuthorizedBy)
+			}
+			if !reflect.DeepEqual(result.Consulted, test.consulted) {
+				t.Errorf("expected rules %v to be consulted, got %v", test.consulted, result.Consulted)
+			}
+		})
+	}
+}
+
+func TestValidateChanges(t *testing.T) {
+	rootSigner, targetsSigner := newTestSigner(t), newTestSigner(t)
+	alice, bob := newTestSigner(t), newTestSigner(t)
+	aliceID, bobID := alice.PublicData().IDs()[0], bob.PublicData().IDs()[0]
+
+	store, _ := newTestStore(t, []tufkeys.Signer{rootSigner}, []tufkeys.Signer{targetsSigner})
+	state := store.State()
+	targetsSigners := []tufkeys.Signer{targetsSigner}
+	aliceKeys := publicKeysForSigners([]tufkeys.Signer{alice})
+	addTestRule(t, state, targetsSigners, "targets", "bin", 1, true, []string{"bin/*"}, []string{OperationCreate, OperationModify, OperationDelete}, aliceKeys)
+	addTestRule(t, state, targetsSigners, "targets", "secret", 1, true, []string{"secret/*"}, []string{OperationCreate, OperationModify, OperationDelete, OperationRename, OperationCopy, OperationMode}, aliceKeys)
+	addTestRule(t, state, targetsSigners, "targets", "vendor-x", 1, true, []string{"vendor/x"}, nil, aliceKeys)
+	addTestRule(t, state, targetsSigners, "targets", "external-symlinks", 1, true, []string{ExternalSymlinkTarget}, nil, aliceKeys)
+
+	tests := []struct {
+		name         string
+		change       fileChange
+		usedKeyIDs   []string
+		authorizedBy []string
+		err          string
+	}{
+		{name: "modify", change: fileChange{Operation: OperationModify, From: "bin/tool", To: "bin/tool", FromMode: filemode.Regular, ToMode: filemode.Regular}, usedKeyIDs: []string{aliceID}, authorizedBy: []string{"bin"}},
+		{name: "mode not allowed", change: fileChange{Operation: OperationModify, From: "bin/tool", To: "bin/tool", FromMode: filemode.Regular, ToMode: filemode.Executable}, usedKeyIDs: []string{aliceID}, err: "rule bin does not allow mode"},
+		{name: "mode of unprotected file", change: fileChange{Operation: OperationModify, From: "docs/tool", To: "docs/tool", FromMode: filemode.Regular, ToMode: filemode.Executable}, usedKeyIDs: []string{bobID}, authorizedBy: []string{AllowRule}},
+		{name: "symlink not allowed", change: fileChange{Operation: OperationCreate, To: "secret/l", ToMode: filemode.Symlink, LinkTarget: "docs/a"}, usedKeyIDs: []string{aliceID}, err: "rule secret does not allow symlink"},
+		{name: "symlink to protected path", change: fileChange{Operation: OperationCreate, To: "docs/l", ToMode: filemode.Symlink, LinkTarget: "secret/a"}, usedKeyIDs: []string{bobID}, err: "unauthorized create, symlink of file secret/a"},
+		{name: "symlink to protected path by authorized key", change: fileChange{Operation: OperationCreate, To: "docs/l", ToMode: filemode.Symlink, LinkTarget: "vendor/x"}, usedKeyIDs: []string{aliceID}, authorizedBy: []string{AllowRule, "vendor-x"}},
+		{name: "symlink outside repository", change: fileChange{Operation: OperationCreate, To: "docs/l", ToMode: filemode.Symlink, LinkTarget: ExternalSymlinkTarget}, usedKeyIDs: []string{bobID}, err: "unauthorized create, symlink of file " + ExternalSymlinkTarget},
+		{name: "symlink outside repository by authorized key", change: fileChange{Operation: OperationCreate, To: "docs/l", ToMode: filemode.Symlink, LinkTarget: ExternalSymlinkTarget}, usedKeyIDs: []string{aliceID}, authorizedBy: []string{AllowRule, "external-symlinks"}},
+		{name: "submodule update", change: fileChange{Operation: OperationModify, From: "vendor/x", To: "vendor/x", FromMode: filemode.Submodule, ToMode: filemode.Submodule}, usedKeyIDs: []string{aliceID}, authorizedBy: []string{"vendor-x"}},
+		{name: "submodule update by unauthorized key", change: fileChange{Operation: OperationModify, From: "vendor/x", To: "vendor/x", FromMode: filemode.Submodule, ToMode: filemode.Submodule}, usedKeyIDs: []string{bobID}, err: "unauthorized modify, submodule of file vendor/x"},
+		{name: "submodule replaced by file", change: fileChange{Operation: OperationModify, From: "vendor/x", To: "vendor/x", FromMode: filemode.Submodule, ToMode: filemode.Regular}, usedKeyIDs: []string{bobID}, err: "unauthorized modify, mode, submodule of file vendor/x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			change := test.change
+			validations, err := validateChanges(state, []*fileChange{&change}, test.usedKeyIDs)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			authorizedBy := []string{}
+			for _, v := range validations {
+				authorizedBy = append(authorizedBy, v.AuthorizedBy)
+			}
+			if !reflect.DeepEqual(authorizedBy, test.authorizedBy) {
+				t.Errorf("expected changes to be authorized by %v, got %v", test.authorizedBy, authorizedBy)
+			}
+		})
+	}
+}
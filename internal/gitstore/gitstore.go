@@ -34,13 +34,18 @@ func InitNamespace(repoRoot string) error {
 	return nil
 }
 
+/*
+GitStore is the gittuf namespace of a repository. States loaded from the store
+refer back to it, and share its cache of verification results.
+*/
 type GitStore struct {
 	repository  *git.Repository
 	state       *State
 	lastTrusted plumbing.Hash
+	cache       map[string]interface{}
 }
 
-func InitGitStore(repoRoot string, rootPublicKeys []tufdata.PublicKey, metadata map[string][]byte) (*GitStore, error) {
+func InitGitStore(repoRoot string, rootPublicKeys []*tufdata.PublicKey, metadata map[string][]byte) (*GitStore, error) {
 	err := InitNamespace(repoRoot)
 	if err != nil {
 		return &GitStore{}, err
@@ -56,11 +61,14 @@ func InitGitStore(repoRoot string, rootPublicKeys []tufdata.PublicKey, metadata
 		return &GitStore{}, err
 	}
 
-	return &GitStore{
+	store := &GitStore{
 		repository:  repo,
 		state:       state,
 		lastTrusted: plumbing.ZeroHash,
-	}, nil
+		cache:       map[string]interface{}{},
+	}
+	state.store = store
+	return store, nil
 }
 
 func LoadGitStore(repoRoot string) (*GitStore, error) {
@@ -75,7 +83,7 @@ func LoadGitStore(repoRoot string) (*GitStore, error) {
 	}
 
 	if stateRef.Hash().IsZero() {
-		return &GitStore{
+		store := &GitStore{
 			repository: repo,
 			state: &State{
 				metadataStaging:     map[string][]byte{},
@@ -88,7 +96,10 @@ func LoadGitStore(repoRoot string) (*GitStore, error) {
 				written:             true,
 			},
 			lastTrusted: plumbing.ZeroHash,
-		}, nil
+			cache:       map[string]interface{}{},
+		}
+		store.state.store = store
+		return store, nil
 	}
 
 	state, err := loadState(repo, stateRef.Hash())
@@ -101,28 +112,65 @@ func LoadGitStore(repoRoot string) (*GitStore, error) {
 		return &GitStore{}, err
 	}
 
-	return &GitStore{
+	store := &GitStore{
 		repository:  repo,
 		state:       state,
 		lastTrusted: lastTrustedRef.Hash(),
-	}, nil
+		cache:       map[string]interface{}{},
+	}
+	state.store = store
+	return store, nil
+}
+
+/*
+TrustedState records the last trusted state of a target along with the
+versions of the roles trusted in it. Versions are used to detect rollbacks in
+subsequent states.
+*/
+type TrustedState struct {
+	State string                 `json:"state"`
+	Roles map[string]TrustedRole `json:"roles,omitempty"`
+}
+
+// TrustedRole records the version of a role and the hash of its signed
+// contents.
+type TrustedRole struct {
+	Version int64  `json:"version"`
+	Hash    string `json:"hash"`
 }
 
-func (g *GitStore) GetLastTrusted() (map[string]string, error) {
+func (g *GitStore) GetLastTrusted() (map[string]*TrustedState, error) {
 	if g.lastTrusted.IsZero() {
-		return map[string]string{}, nil
+		return map[string]*TrustedState{}, nil
 	}
 
 	_, contents, err := readBlob(g.repository, g.lastTrusted)
 	if err != nil {
-		return map[string]string{}, err
+		return map[string]*TrustedState{}, err
 	}
-	var lastTrusted map[string]string
-	err = json.Unmarshal(contents, &lastTrusted)
-	return lastTrusted, err
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(contents, &entries); err != nil {
+		return map[string]*TrustedState{}, err
+	}
+
+	lastTrusted := map[string]*TrustedState{}
+	for target, entry := range entries {
+		// Older records only hold the ID of the trusted state
+		var stateID string
+		if err := json.Unmarshal(entry, &stateID); err == nil {
+			lastTrusted[target] = &TrustedState{State: stateID}
+			continue
+		}
+		var trustedState TrustedState
+		if err := json.Unmarshal(entry, &trustedState); err != nil {
+			return map[string]*TrustedState{}, err
+		}
+		lastTrusted[target] = &trustedState
+	}
+	return lastTrusted, nil
 }
 
-func (g *GitStore) WriteLastTrusted(lastTrusted map[string]string) error {
+func (g *GitStore) WriteLastTrusted(lastTrusted map[string]*TrustedState) error {
 	contents, err := json.Marshal(lastTrusted)
 	if err != nil {
 		return err
@@ -154,27 +202,56 @@ func (g *GitStore) Repository() *git.Repository {
 // SpecificState returns the specified state.
 func (g *GitStore) SpecificState(stateID string) (*State, error) {
 	stateHash := plumbing.NewHash(stateID)
-	return loadState(g.repository, stateHash)
+	state, err := loadState(g.repository, stateHash)
+	if err != nil {
+		return &State{}, err
+	}
+	state.store = g
+	return state, nil
+}
+
+// CachedResult returns the result cached for the key, if any.
+func (g *GitStore) CachedResult(key string) (interface{}, bool) {
+	result, ok := g.cache[key]
+	return result, ok
+}
+
+// CacheResult caches the result of verifying a state for the lifetime of the
+// store.
+func (g *GitStore) CacheResult(key string, result interface{}) {
+	g.cache[key] = result
 }
 
 func (g *GitStore) LastTrusted(target string) (string, error) {
-	lastTrusted, err := g.GetLastTrusted()
+	trustedState, err := g.LastTrustedState(target)
 	if err != nil {
 		return "", err
 	}
-	stateID, exists := lastTrusted[target]
+	return trustedState.State, nil
+}
+
+// LastTrustedState returns the record of the last trusted state of the target.
+func (g *GitStore) LastTrustedState(target string) (*TrustedState, error) {
+	lastTrusted, err := g.GetLastTrusted()
+	if err != nil {
+		return &TrustedState{}, err
+	}
+	trustedState, exists := lastTrusted[target]
 	if !exists {
-		return "", fmt.Errorf("no trusted state found for %s", target)
+		return &TrustedState{}, fmt.Errorf("no trusted state found for %s", target)
 	}
-	return stateID, nil
+	return trustedState, nil
 }
 
-func (g *GitStore) UpdateTrustedState(target, stateID string) error {
+func (g *GitStore) UpdateTrustedState(target, stateID string, roles map[string]TrustedRole) error {
 	lastTrusted, err := g.GetLastTrusted()
 	if err != nil {
 		return err
 	}
-	lastTrusted[target] = stateID
+	lastTrusted[target] = &TrustedState{
+		State: stateID,
+		Roles: roles,
+	}
 
 	return g.WriteLastTrusted(lastTrusted)
 }
@@ -1,7 +1,9 @@
 package gitstore
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"sort"
 	"strings"
 	"time"
@@ -23,11 +25,31 @@ func getNameWithoutExtension(fileName string) string {
 	return fileName
 }
 
+/*
+getMetadataFileName returns the name of the file in the metadata tree for the
+role. Roles recording refs, such as branch/feature/login, have slashes in
+their names, so the name is escaped to keep every role directly in the
+metadata tree.
+*/
+func getMetadataFileName(roleName string) string {
+	return fmt.Sprintf("%s.json", url.PathEscape(roleName))
+}
+
+// MetadataRoleName returns the name of the role stored in the metadata file.
+func MetadataRoleName(fileName string) string {
+	name := getNameWithoutExtension(fileName)
+	roleName, err := url.PathUnescape(name)
+	if err != nil {
+		return name
+	}
+	return roleName
+}
+
 /*
 initState is invoked during the init workflow. A set of TUF metadata is
 created and passed in. This is then written to the store.
 */
-func initState(repo *git.Repository, rootPublicKeys []tufdata.PublicKey, metadata map[string][]byte) (*State, error) {
+func initState(repo *git.Repository, rootPublicKeys []*tufdata.PublicKey, metadata map[string][]byte) (*State, error) {
 	r := &State{
 		metadataStaging:     map[string][]byte{},
 		keysStaging:         map[string][]byte{},
@@ -79,7 +101,7 @@ func loadState(repo *git.Repository, commitID plumbing.Hash) (*State, error) {
 
 	metadataIdentifiers := map[string]object.TreeEntry{}
 	for _, entry := range metadataTree.Entries {
-		metadataIdentifiers[getNameWithoutExtension(entry.Name)] = entry
+		metadataIdentifiers[MetadataRoleName(entry.Name)] = entry
 	}
 
 	rootKeys := map[string]object.TreeEntry{}
@@ -145,14 +167,15 @@ func writeTree(repo *git.Repository, entries []object.TreeEntry) (plumbing.Hash,
 	return repo.Storer.SetEncodedObject(obj)
 }
 
-func commit(repo *git.Repository, parent plumbing.Hash, treeHash plumbing.Hash, targetRef string) (plumbing.Hash, error) {
+func commit(repo *git.Repository, parent plumbing.Hash, treeHash plumbing.Hash, targetRef string, message string) (plumbing.Hash, error) {
 	gitConfig, err := repo.ConfigScoped(config.GlobalScope)
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
+	// curRef is nil when targetRef is being created
 	curRef, err := repo.Reference(plumbing.ReferenceName(targetRef), true)
-	if err != nil {
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
 		return plumbing.ZeroHash, err
 	}
 
@@ -166,7 +189,7 @@ func commit(repo *git.Repository, parent plumbing.Hash, treeHash plumbing.Hash,
 		Author:    author,
 		Committer: author,
 		TreeHash:  treeHash,
-		Message:   fmt.Sprintf("gittuf: Writing state tree %s", treeHash.String()),
+		Message:   message,
 	}
 	if parent != plumbing.ZeroHash {
 		commit.ParentHashes = []plumbing.Hash{parent}
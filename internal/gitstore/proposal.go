@@ -0,0 +1,276 @@
+package gitstore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const (
+	ProposalsRefPrefix = "refs/gittuf/proposals/"
+	BaseStateFile      = "base-state"
+	RemovedFile        = "removed"
+)
+
+/*
+Proposal holds metadata that has not been applied to the state yet, typically
+because it must be signed by a threshold of keys held by different people.
+Each proposal is stored in refs/gittuf/proposals/<id>. Its tree contains the
+proposed metadata in the metadata directory, like a state, and the ID of the
+state the proposal was created against in base-state. The roles whose
+metadata the proposal removes are listed in removed, one per line. Every
+signature added to the proposal creates a new commit on the ref.
+*/
+type Proposal struct {
+	repository *git.Repository
+	id         string
+	tip        plumbing.Hash
+	baseState  plumbing.Hash
+	metadata   map[string][]byte // rolename: contents, rolename should NOT include extension
+	removed    []string
+}
+
+func getProposalRef(id string) string {
+	return ProposalsRefPrefix + id
+}
+
+// CreateProposal records the metadata, and the removal of the metadata of the
+// removed roles, as a new proposal against the current state.
+func (g *GitStore) CreateProposal(id string, metadata map[string][]byte, removed []string) (*Proposal, error) {
+	if len(id) == 0 || strings.Contains(id, "..") || strings.ContainsAny(id, " ~^:?*[\\") {
+		return &Proposal{}, fmt.Errorf("invalid proposal ID '%s'", id)
+	}
+
+	_, err := g.repository.Reference(plumbing.ReferenceName(getProposalRef(id)), true)
+	if err == nil {
+		return &Proposal{}, fmt.Errorf("proposal %s already exists", id)
+	}
+	if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return &Proposal{}, err
+	}
+
+	proposal := &Proposal{
+		repository: g.repository,
+		id:         id,
+		tip:        plumbing.ZeroHash,
+		baseState:  g.state.tip,
+		metadata:   metadata,
+		removed:    removed,
+	}
+	return proposal, proposal.Commit()
+}
+
+func (g *GitStore) LoadProposal(id string) (*Proposal, error) {
+	ref, err := g.repository.Reference(plumbing.ReferenceName(getProposalRef(id)), true)
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return &Proposal{}, fmt.Errorf("proposal %s not found", id)
+		}
+		return &Proposal{}, err
+	}
+
+	commitObj, err := g.repository.CommitObject(ref.Hash())
+	if err != nil {
+		return &Proposal{}, err
+	}
+	tree, err := g.repository.TreeObject(commitObj.TreeHash)
+	if err != nil {
+		return &Proposal{}, err
+	}
+
+	proposal := &Proposal{
+		repository: g.repository,
+		id:         id,
+		tip:        commitObj.Hash,
+		baseState:  plumbing.ZeroHash,
+		metadata:   map[string][]byte{},
+	}
+
+	for _, entry := range tree.Entries {
+		switch entry.Name {
+		case BaseStateFile:
+			_, contents, err := readBlob(g.repository, entry.Hash)
+			if err != nil {
+				return &Proposal{}, err
+			}
+			proposal.baseState = plumbing.NewHash(strings.TrimSpace(string(contents)))
+		case RemovedFile:
+			_, contents, err := readBlob(g.repository, entry.Hash)
+			if err != nil {
+				return &Proposal{}, err
+			}
+			for _, roleName := range strings.Split(string(contents), "\n") {
+				if len(roleName) > 0 {
+					proposal.removed = append(proposal.removed, roleName)
+				}
+			}
+		case MetadataDir:
+			metadataTree, err := g.repository.TreeObject(entry.Hash)
+			if err != nil {
+				return &Proposal{}, err
+			}
+			for _, e := range metadataTree.Entries {
+				_, contents, err := readBlob(g.repository, e.Hash)
+				if err != nil {
+					return &Proposal{}, err
+				}
+				proposal.metadata[MetadataRoleName(e.Name)] = contents
+			}
+		}
+	}
+
+	return proposal, nil
+}
+
+// ListProposals returns the IDs of all proposals in the repository.
+func (g *GitStore) ListProposals() ([]string, error) {
+	refs, err := g.repository.References()
+	if err != nil {
+		return []string{}, err
+	}
+
+	ids := []string{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().String()
+		if strings.HasPrefix(name, ProposalsRefPrefix) {
+			ids = append(ids, strings.TrimPrefix(name, ProposalsRefPrefix))
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// FetchProposal updates the proposal from the specified remote.
+func (g *GitStore) FetchProposal(remoteName string, id string) error {
+	proposalRef := getProposalRef(id)
+	refSpec := config.RefSpec(fmt.Sprintf("+%s:%s", proposalRef, proposalRef))
+	err := g.repository.Fetch(&git.FetchOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []config.RefSpec{refSpec},
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+	return nil
+}
+
+/*
+PushProposal updates the proposal on the specified remote. The remote
+proposal must be an ancestor of the local one, so signatures added to the
+remote proposal since it was fetched are not lost.
+*/
+func (g *GitStore) PushProposal(remoteName string, id string) error {
+	proposalRef := getProposalRef(id)
+	refSpec := config.RefSpec(fmt.Sprintf("%s:%s", proposalRef, proposalRef))
+	err := g.repository.Push(&git.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []config.RefSpec{refSpec},
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("unable to push proposal %s to %s: %w", id, remoteName, err)
+	}
+	return nil
+}
+
+func (g *GitStore) RemoveProposal(id string) error {
+	return g.repository.Storer.RemoveReference(plumbing.ReferenceName(getProposalRef(id)))
+}
+
+func (p *Proposal) ID() string {
+	return p.id
+}
+
+func (p *Proposal) Tip() string {
+	return p.tip.String()
+}
+
+// BaseState returns the ID of the state the proposal was created against. It
+// is the zero hash for proposals that initialize the repository.
+func (p *Proposal) BaseState() string {
+	return p.baseState.String()
+}
+
+func (p *Proposal) BaseStateHash() plumbing.Hash {
+	return p.baseState
+}
+
+func (p *Proposal) Metadata() map[string][]byte {
+	return p.metadata
+}
+
+// RemovedMetadata returns the roles whose metadata the proposal removes.
+func (p *Proposal) RemovedMetadata() []string {
+	return p.removed
+}
+
+func (p *Proposal) StageMetadata(roleName string, contents []byte) {
+	p.metadata[roleName] = contents
+}
+
+// Commit writes the proposal's current metadata to its ref.
+func (p *Proposal) Commit() error {
+	metadataEntries := []object.TreeEntry{}
+	for roleName, contents := range p.metadata {
+		identifier, err := writeBlob(p.repository, contents)
+		if err != nil {
+			return err
+		}
+		metadataEntries = append(metadataEntries, object.TreeEntry{
+			Name: getMetadataFileName(roleName),
+			Mode: filemode.Regular,
+			Hash: identifier,
+		})
+	}
+	metadataTreeHash, err := writeTree(p.repository, metadataEntries)
+	if err != nil {
+		return err
+	}
+
+	baseStateHash, err := writeBlob(p.repository, []byte(p.baseState.String()))
+	if err != nil {
+		return err
+	}
+
+	entries := []object.TreeEntry{
+		{
+			Name: MetadataDir,
+			Mode: filemode.Dir,
+			Hash: metadataTreeHash,
+		},
+		{
+			Name: BaseStateFile,
+			Mode: filemode.Regular,
+			Hash: baseStateHash,
+		},
+	}
+	if len(p.removed) > 0 {
+		removedHash, err := writeBlob(p.repository, []byte(strings.Join(p.removed, "\n")+"\n"))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, object.TreeEntry{
+			Name: RemovedFile,
+			Mode: filemode.Regular,
+			Hash: removedHash,
+		})
+	}
+
+	treeHash, err := writeTree(p.repository, entries)
+	if err != nil {
+		return err
+	}
+
+	commitHash, err := commit(p.repository, p.tip, treeHash, getProposalRef(p.id), fmt.Sprintf("gittuf: Writing proposal %s", p.id))
+	if err != nil {
+		return err
+	}
+	p.tip = commitHash
+
+	return nil
+}
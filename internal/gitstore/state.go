@@ -18,8 +18,17 @@ const (
 	DefaultRemote = "origin"
 	MetadataDir   = "metadata"
 	KeysDir       = "keys"
+	SnapshotRole  = "snapshot"
 )
 
+/*
+Snapshotter creates the snapshot metadata for the complete set of metadata in
+a state, which includes the current snapshot if there is one. It returns nil
+if the state does not use snapshot metadata. A snapshotter is passed to every
+commit of a state.
+*/
+type Snapshotter func(metadata map[string][]byte) ([]byte, error)
+
 func LoadState(repoRoot string) (*State, error) {
 	repo, err := git.PlainOpen(repoRoot)
 	if err != nil {
@@ -94,6 +103,7 @@ func LoadAtState(repoRoot string, stateID string) (*State, error) {
 
 type State struct {
 	repository          *git.Repository
+	store               *GitStore
 	metadataStaging     map[string][]byte // rolename: contents, rolename should NOT include extension
 	keysStaging         map[string][]byte // keyID: PubKey
 	tip                 plumbing.Hash
@@ -145,13 +155,19 @@ func (s *State) FetchFromRemote(remoteName string) error {
 		return err
 	}
 	for _, e := range metadataTree.Entries {
-		metadataIdentifiers[getNameWithoutExtension(e.Name)] = e
+		metadataIdentifiers[MetadataRoleName(e.Name)] = e
 	}
 	s.metadataIdentifiers = metadataIdentifiers
 
 	return nil
 }
 
+// Store returns the store the state was loaded from, or nil if the state was
+// loaded on its own.
+func (s *State) Store() *GitStore {
+	return s.store
+}
+
 func (s *State) Tip() string {
 	return s.tip.String()
 }
@@ -270,14 +286,14 @@ func (s *State) GetAllCurrentMetadata() (map[string][]byte, error) {
 	return metadata, nil
 }
 
-func (s *State) GetRootKey(keyID string) (tufdata.PublicKey, error) {
+func (s *State) GetRootKey(keyID string) (*tufdata.PublicKey, error) {
 	var key tufdata.PublicKey
 	contents, err := s.GetRootKeyBytes(keyID)
 	if err != nil {
-		return tufdata.PublicKey{}, err
+		return &tufdata.PublicKey{}, err
 	}
 	err = json.Unmarshal(contents, &key)
-	return key, err
+	return &key, err
 }
 
 func (s *State) GetRootKeyBytes(keyID string) ([]byte, error) {
@@ -290,33 +306,127 @@ func (s *State) GetRootKeyString(keyID string) (string, error) {
 	return string(contents), err
 }
 
-func (s *State) GetAllRootKeys() (map[string]tufdata.PublicKey, error) {
-	keys := map[string]tufdata.PublicKey{}
+func (s *State) GetAllRootKeys() (map[string]*tufdata.PublicKey, error) {
+	keys := map[string]*tufdata.PublicKey{}
 	for keyID, treeEntry := range s.rootKeys {
 		_, contents, err := readBlob(s.repository, treeEntry.Hash)
 		if err != nil {
-			return map[string]tufdata.PublicKey{}, err
+			return map[string]*tufdata.PublicKey{}, err
 		}
 
 		var key tufdata.PublicKey
 		err = json.Unmarshal(contents, &key)
 		if err != nil {
-			return map[string]tufdata.PublicKey{}, err
+			return map[string]*tufdata.PublicKey{}, err
 		}
 
-		keys[keyID] = key
+		keys[keyID] = &key
 	}
 	return keys, nil
 }
 
+/*
+GetRootMetadataHistory returns every version of the root metadata recorded in
+the history of the state, oldest first. Consecutive states that share the
+same root metadata are only included once.
+*/
+func (s *State) GetRootMetadataHistory() ([][]byte, error) {
+	rootBlobs := []plumbing.Hash{}
+	iteratorHash := s.tip
+	for !iteratorHash.IsZero() {
+		commitObj, err := s.repository.CommitObject(iteratorHash)
+		if err != nil {
+			return [][]byte{}, err
+		}
+		tree, err := s.repository.TreeObject(commitObj.TreeHash)
+		if err != nil {
+			return [][]byte{}, err
+		}
+		entry, err := tree.FindEntry(fmt.Sprintf("%s/root.json", MetadataDir))
+		if err == nil && (len(rootBlobs) == 0 || rootBlobs[len(rootBlobs)-1] != entry.Hash) {
+			rootBlobs = append(rootBlobs, entry.Hash)
+		}
+
+		if len(commitObj.ParentHashes) == 0 {
+			break
+		}
+		iteratorHash = commitObj.ParentHashes[0]
+	}
+
+	history := [][]byte{}
+	for i := len(rootBlobs) - 1; i >= 0; i-- {
+		_, contents, err := readBlob(s.repository, rootBlobs[i])
+		if err != nil {
+			return [][]byte{}, err
+		}
+		history = append(history, contents)
+	}
+	return history, nil
+}
+
+// ContainsState reports whether stateID is the state or one of the states it
+// was created from.
+func (s *State) ContainsState(stateID string) (bool, error) {
+	stateHash := plumbing.NewHash(stateID)
+	iteratorHash := s.tip
+	for !iteratorHash.IsZero() {
+		if iteratorHash == stateHash {
+			return true, nil
+		}
+		commitObj, err := s.repository.CommitObject(iteratorHash)
+		if err != nil {
+			return false, err
+		}
+		if len(commitObj.ParentHashes) == 0 {
+			break
+		}
+		iteratorHash = commitObj.ParentHashes[0]
+	}
+	return false, nil
+}
+
+/*
+MetadataRemovedSince returns the IDs of the states in which the metadata of
+the role is missing, among the state and the states it was created from after
+stateID, most recent first. The states are searched by following the first
+parent of each state.
+*/
+func (s *State) MetadataRemovedSince(stateID string, roleName string) ([]string, error) {
+	stateHash := plumbing.NewHash(stateID)
+	fileName := fmt.Sprintf("%s/%s", MetadataDir, getMetadataFileName(roleName))
+	removedIn := []string{}
+	iteratorHash := s.tip
+	for !iteratorHash.IsZero() && iteratorHash != stateHash {
+		commitObj, err := s.repository.CommitObject(iteratorHash)
+		if err != nil {
+			return []string{}, err
+		}
+		tree, err := s.repository.TreeObject(commitObj.TreeHash)
+		if err != nil {
+			return []string{}, err
+		}
+		if _, err := tree.FindEntry(fileName); err != nil {
+			if !errors.Is(err, object.ErrEntryNotFound) && !errors.Is(err, object.ErrDirectoryNotFound) {
+				return []string{}, err
+			}
+			removedIn = append(removedIn, iteratorHash.String())
+		}
+		if len(commitObj.ParentHashes) == 0 {
+			break
+		}
+		iteratorHash = commitObj.ParentHashes[0]
+	}
+	return removedIn, nil
+}
+
 func (s *State) StageMetadata(roleName string, contents []byte) {
 	s.metadataStaging[roleName] = contents
 	s.written = false
 }
 
-func (s *State) StageMetadataAndCommit(roleName string, contents []byte) error {
+func (s *State) StageMetadataAndCommit(roleName string, contents []byte, snapshotter Snapshotter) error {
 	s.StageMetadata(roleName, contents)
-	return s.Commit()
+	return s.Commit(snapshotter)
 }
 
 func (s *State) StageMultipleMetadata(metadata map[string][]byte) {
@@ -325,12 +435,12 @@ func (s *State) StageMultipleMetadata(metadata map[string][]byte) {
 	}
 }
 
-func (s *State) StageAndCommitMultipleMetadata(metadata map[string][]byte) error {
+func (s *State) StageAndCommitMultipleMetadata(metadata map[string][]byte, snapshotter Snapshotter) error {
 	s.StageMultipleMetadata(metadata)
-	return s.Commit()
+	return s.Commit(snapshotter)
 }
 
-func (s *State) StageKey(key tufdata.PublicKey) error {
+func (s *State) StageKey(key *tufdata.PublicKey) error {
 	s.written = false
 	contents, err := json.Marshal(key)
 	if err != nil {
@@ -343,15 +453,7 @@ func (s *State) StageKey(key tufdata.PublicKey) error {
 	return nil
 }
 
-func (s *State) StageKeyAndCommit(key tufdata.PublicKey) error {
-	err := s.StageKey(key)
-	if err != nil {
-		return err
-	}
-	return s.Commit()
-}
-
-func (s *State) StageKeys(keys []tufdata.PublicKey) error {
+func (s *State) StageKeys(keys []*tufdata.PublicKey) error {
 	for _, key := range keys {
 		err := s.StageKey(key)
 		if err != nil {
@@ -361,20 +463,38 @@ func (s *State) StageKeys(keys []tufdata.PublicKey) error {
 	return nil
 }
 
-func (s *State) StageKeysAndCommit(keys []tufdata.PublicKey) error {
-	err := s.StageKeys(keys)
-	if err != nil {
-		return err
-	}
-	return s.Commit()
+/*
+ReplaceKeys stages the keys as the complete set of root keys, removing any
+other keys when the state is committed. The keys tree must always match the
+keys of the root role, so this should only be used alongside a root update.
+*/
+func (s *State) ReplaceKeys(keys []*tufdata.PublicKey) error {
+	s.rootKeys = map[string]object.TreeEntry{}
+	s.keysStaging = map[string][]byte{}
+	return s.StageKeys(keys)
+}
+
+// StageSnapshot ensures the next commit writes new snapshot metadata even if
+// no other metadata is staged.
+func (s *State) StageSnapshot() {
+	s.written = false
 }
 
-func (s *State) Commit() error {
+/*
+Commit writes the staged metadata and keys to the state. The snapshotter
+creates the snapshot metadata for the new state, and may be nil for states
+that do not use snapshot metadata.
+*/
+func (s *State) Commit(snapshotter Snapshotter) error {
 	if s.Written() {
 		// Nothing to do
 		return nil
 	}
 
+	if err := s.stageSnapshot(snapshotter); err != nil {
+		return err
+	}
+
 	// We need to create a new tree that includes unchanged entries and the
 	// newly staged metadata.
 	metadataEntries := []object.TreeEntry{}
@@ -393,7 +513,7 @@ func (s *State) Commit() error {
 			return err
 		}
 		treeEntry := object.TreeEntry{
-			Name: fmt.Sprintf("%s.json", roleName),
+			Name: getMetadataFileName(roleName),
 			Mode: filemode.Regular,
 			Hash: identifier,
 		}
@@ -454,7 +574,7 @@ func (s *State) Commit() error {
 	s.tree = treeHash
 
 	// Commit to ref
-	commitHash, err := commit(s.repository, s.tip, treeHash, StateRef)
+	commitHash, err := commit(s.repository, s.tip, treeHash, StateRef, fmt.Sprintf("gittuf: Writing state tree %s", treeHash.String()))
 	if err != nil {
 		return err
 	}
@@ -465,23 +585,49 @@ func (s *State) Commit() error {
 	return nil
 }
 
-func (s *State) RemoveMetadata(roleNames []string) error {
-	s.written = false
+// stageSnapshot stages the snapshot metadata created by the snapshotter for
+// the metadata that will be committed.
+func (s *State) stageSnapshot(snapshotter Snapshotter) error {
+	if snapshotter == nil {
+		return nil
+	}
 
-	for _, role := range roleNames {
-		delete(s.metadataStaging, role)
-		delete(s.metadataIdentifiers, role)
+	metadata := map[string][]byte{}
+	for roleName, treeEntry := range s.metadataIdentifiers {
+		if _, exists := s.metadataStaging[roleName]; exists {
+			continue
+		}
+		_, contents, err := readBlob(s.repository, treeEntry.Hash)
+		if err != nil {
+			return err
+		}
+		metadata[roleName] = contents
+	}
+	for roleName, contents := range s.metadataStaging {
+		metadata[roleName] = contents
 	}
 
-	return s.Commit()
+	snapshot, err := snapshotter(metadata)
+	if err != nil {
+		return err
+	}
+	if snapshot != nil {
+		s.metadataStaging[SnapshotRole] = snapshot
+	}
+	return nil
 }
 
-func (s *State) RemoveKeys(keyIDs []string) error {
+// StageMetadataRemoval removes the metadata of the roles from the state when
+// it is next committed.
+func (s *State) StageMetadataRemoval(roleNames []string) {
+	for _, role := range roleNames {
+		delete(s.metadataStaging, role)
+		delete(s.metadataIdentifiers, role)
+	}
 	s.written = false
+}
 
-	for _, keyID := range keyIDs {
-		delete(s.keysStaging, keyID)
-		delete(s.rootKeys, keyID)
-	}
-	return s.Commit()
+func (s *State) RemoveMetadata(roleNames []string, snapshotter Snapshotter) error {
+	s.StageMetadataRemoval(roleNames)
+	return s.Commit(snapshotter)
 }
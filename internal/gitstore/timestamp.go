@@ -0,0 +1,134 @@
+package gitstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	tufdata "github.com/theupdateframework/go-tuf/data"
+)
+
+const (
+	TimestampRef  = "refs/gittuf/timestamp"
+	TimestampFile = "timestamp.json"
+)
+
+/*
+GetTimestamp returns the timestamp metadata in refs/gittuf/timestamp. The
+timestamp is kept outside the state so that it can be refreshed frequently
+without creating new states. Empty contents are returned if the repository
+has no timestamp.
+*/
+func (g *GitStore) GetTimestamp() ([]byte, error) {
+	ref, err := g.repository.Reference(plumbing.ReferenceName(TimestampRef), true)
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return []byte{}, nil
+		}
+		return []byte{}, err
+	}
+
+	commitObj, err := g.repository.CommitObject(ref.Hash())
+	if err != nil {
+		return []byte{}, err
+	}
+	tree, err := g.repository.TreeObject(commitObj.TreeHash)
+	if err != nil {
+		return []byte{}, err
+	}
+	entry, err := tree.FindEntry(TimestampFile)
+	if err != nil {
+		return []byte{}, err
+	}
+	_, contents, err := readBlob(g.repository, entry.Hash)
+	return contents, err
+}
+
+// WriteTimestamp replaces the timestamp metadata in refs/gittuf/timestamp.
+// Older timestamps are not retained.
+func (g *GitStore) WriteTimestamp(contents []byte) error {
+	blobHash, err := writeBlob(g.repository, contents)
+	if err != nil {
+		return err
+	}
+	treeHash, err := writeTree(g.repository, []object.TreeEntry{
+		{
+			Name: TimestampFile,
+			Mode: filemode.Regular,
+			Hash: blobHash,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = commit(g.repository, plumbing.ZeroHash, treeHash, TimestampRef, "gittuf: Writing timestamp")
+	return err
+}
+
+/*
+FetchTimestamp updates the timestamp from the specified remote, if the remote
+has one. Each timestamp replaces the previous one, so the remote timestamp is
+fetched with force, but it is rejected and the local timestamp is kept if its
+version is lower than that of the local timestamp.
+*/
+func (g *GitStore) FetchTimestamp(remoteName string) error {
+	currentContents, err := g.GetTimestamp()
+	if err != nil {
+		return err
+	}
+	currentRef, err := g.repository.Reference(plumbing.ReferenceName(TimestampRef), true)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return err
+	}
+
+	refSpec := config.RefSpec(fmt.Sprintf("+%s:%s", TimestampRef, TimestampRef))
+	err = g.repository.Fetch(&git.FetchOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []config.RefSpec{refSpec},
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) && !errors.Is(err, git.NoMatchingRefSpecError{}) {
+		return err
+	}
+	if len(currentContents) == 0 {
+		return nil
+	}
+
+	newContents, err := g.GetTimestamp()
+	if err != nil {
+		return err
+	}
+	currentVersion, err := getTimestampVersion(currentContents)
+	if err != nil {
+		return err
+	}
+	newVersion, err := getTimestampVersion(newContents)
+	if err != nil {
+		return err
+	}
+	if newVersion < currentVersion {
+		if err := g.repository.Storer.SetReference(currentRef); err != nil {
+			return err
+		}
+		return fmt.Errorf("timestamp on %s has version %d, lower than local version %d", remoteName, newVersion, currentVersion)
+	}
+	return nil
+}
+
+func getTimestampVersion(contents []byte) (int64, error) {
+	var mb tufdata.Signed
+	if err := json.Unmarshal(contents, &mb); err != nil {
+		return -1, err
+	}
+	var timestamp struct {
+		Version int64 `json:"version"`
+	}
+	if err := json.Unmarshal(mb.Signed, &timestamp); err != nil {
+		return -1, fmt.Errorf("unable to read timestamp metadata: %w", err)
+	}
+	return timestamp.Version, nil
+}